@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyContextKey is where apiKeyAuth leaves the caller's key for later
+// handlers.
+const apiKeyContextKey = "apiKey"
+
+var errUnauthorized = errors.New("missing or invalid API key")
+
+// apiKeyAuth rejects requests without an "Authorization: Bearer <key>"
+// header naming one of keys. With no keys configured it lets everything
+// through, so local development needs no setup.
+func apiKeyAuth(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			return
+		}
+		key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || !validAPIKey(keys, key) {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(errorResponse(401, errUnauthorized))
+			return
+		}
+		c.Set(apiKeyContextKey, key)
+	}
+}
+
+// validAPIKey compares in constant time so response timing does not leak
+// how much of a key matched.
+func validAPIKey(keys []string, key string) bool {
+	found := 0
+	for _, k := range keys {
+		found |= subtle.ConstantTimeCompare([]byte(k), []byte(key))
+	}
+	return found == 1
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	pb "my-vector-db-v1/vectordbpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withAPIKeys(t *testing.T, keys ...string) {
+	t.Helper()
+	prev := cfg.APIKeys
+	cfg.APIKeys = keys
+	t.Cleanup(func() { cfg.APIKeys = prev })
+}
+
+func authedGet(path, auth string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	useStore(t, NewVectorStore())
+	withAPIKeys(t, "key-one", "key-two")
+
+	cases := []struct {
+		name, path, auth string
+		want             int
+	}{
+		{"first key", "/count", "Bearer key-one", 200},
+		{"second key", "/count", "Bearer key-two", 200},
+		{"missing header", "/count", "", 401},
+		{"wrong key", "/count", "Bearer key-three", 401},
+		{"prefix of a key", "/count", "Bearer key-", 401},
+		{"not bearer", "/count", "Basic key-one", 401},
+		{"health is open", "/health", "", 200},
+		{"metrics need a key", "/metrics", "", 401},
+		{"metrics with a key", "/metrics", "Bearer key-one", 200},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := authedGet(tc.path, tc.auth); got != tc.want {
+				t.Fatalf("GET %s with %q = %d, want %d", tc.path, tc.auth, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPublicMetrics(t *testing.T) {
+	useStore(t, NewVectorStore())
+	withAPIKeys(t, "secret")
+	prev := cfg.PublicMetrics
+	cfg.PublicMetrics = true
+	t.Cleanup(func() { cfg.PublicMetrics = prev })
+
+	if got := authedGet("/metrics", ""); got != 200 {
+		t.Fatalf("GET /metrics with PUBLIC_METRICS = %d, want 200", got)
+	}
+	if got := authedGet("/count", ""); got != 401 {
+		t.Fatalf("GET /count with PUBLIC_METRICS = %d, want 401", got)
+	}
+}
+
+func TestAPIKeyAuthDisabled(t *testing.T) {
+	useStore(t, NewVectorStore())
+	withAPIKeys(t)
+	if got := authedGet("/count", ""); got != 200 {
+		t.Fatalf("GET /count without keys configured = %d, want 200", got)
+	}
+}
+
+func TestGRPCAPIKeyAuth(t *testing.T) {
+	useStore(t, NewVectorStore())
+	withAPIKeys(t, "secret")
+	client := grpcClient(t)
+
+	if _, err := client.Stats(context.Background(), &pb.StatsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Stats without key: got %v, want Unauthenticated", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := client.Stats(ctx, &pb.StatsRequest{}); err != nil {
+		t.Fatalf("Stats with key: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Batch queries. POST /batch_query takes an array of /query bodies and
+// answers with an array of their responses, in the same order. Every text
+// of every query is embedded first, batchEmbedConcurrency at a time; then
+// the searches run one after another, each across the store's worker
+// pool as a lone query would. A query that fails, to validate, embed or
+// search, gets an error response in its place, with the status it would
+// have been answered with alone, and the rest still run.
+// Streaming, explain and the query cache do not apply.
+
+// maxBatchQueries caps the queries in one request.
+const maxBatchQueries = 256
+
+// batchEmbedConcurrency is how many embedding requests a batch has in
+// flight at once.
+const batchEmbedConcurrency = 8
+
+func batchQueryHandler(c *gin.Context) {
+	countOp("batch_query")
+	var reqs []QueryRequest
+	if err := c.ShouldBindJSON(&reqs); err != nil {
+		c.JSON(errorResponse(400, err))
+		return
+	}
+	if len(reqs) > maxBatchQueries {
+		c.JSON(errorResponse(400, fmt.Errorf("at most %d queries per batch, got %d", maxBatchQueries, len(reqs))))
+		return
+	}
+
+	out := make([]gin.H, len(reqs))
+	vectors := make([][]Vector, len(reqs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchEmbedConcurrency)
+	var mu sync.Mutex
+	for i := range reqs {
+		req := &reqs[i]
+		if err := req.prepare(); err != nil {
+			out[i] = batchError(400, err)
+			continue
+		}
+		if err := req.Combine.validate(); err != nil {
+			out[i] = batchError(400, err)
+			continue
+		}
+		texts := req.Texts
+		if req.Text != "" || len(texts) == 0 {
+			texts = append([]string{req.Text}, texts...)
+		}
+		vectors[i] = make([]Vector, len(texts))
+		for j, text := range texts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				vec, err := embedText(c.Request.Context(), text)
+				if err != nil {
+					mu.Lock()
+					if out[i] == nil {
+						out[i] = batchError(502, err)
+					}
+					mu.Unlock()
+					return
+				}
+				vectors[i][j] = vec
+			}()
+		}
+	}
+	wg.Wait()
+	if c.Request.Context().Err() != nil {
+		return
+	}
+
+	for i, req := range reqs {
+		if out[i] != nil {
+			continue
+		}
+		var detailed []DetailedResult
+		var err error
+		if len(req.Texts) > 0 {
+			detailed, err = db.SearchMultiDetailed(vectors[i], req.Combine, req.searchOptions())
+		} else {
+			detailed, err = db.SearchDetailedContext(c.Request.Context(), vectors[i][0], req.searchOptions())
+		}
+		if err != nil {
+			out[i] = batchError(400, err)
+			continue
+		}
+		projectFields(detailed, req.Fields)
+		out[i] = req.response(detailed)
+	}
+	respond(c, 200, gin.H{"results": out})
+}
+
+// batchError is the entry for a query in a batch that failed with err.
+func batchError(status int, err error) gin.H {
+	status, body := errorResponse(status, err)
+	body["status"] = status
+	return body
+}
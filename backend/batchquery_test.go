@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// mapEmbedder embeds the texts it knows and fails on any other.
+type mapEmbedder map[string][]float32
+
+func (m mapEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if vec, ok := m[text]; ok {
+		return vec, nil
+	}
+	return nil, fmt.Errorf("cannot embed %q", text)
+}
+
+func TestBatchQuery(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("east", Vector{1, 0}, map[string]string{"kind": "a"}, "")
+	db.AddItem("north", Vector{0, 1}, map[string]string{"kind": "b"}, "")
+	db.AddItem("northeast", Vector{1, 1}, map[string]string{"kind": "a"}, "")
+	prev := embedder
+	embedder = mapEmbedder{"east": {1, 0}, "north": {0, 1}}
+	t.Cleanup(func() { embedder = prev })
+
+	w := doJSON(t, "POST", "/batch_query", []map[string]any{
+		{"text": "east", "k": 2},
+		{"text": "north", "k": 1},
+		{"text": "east", "k": 3, "filters": map[string]any{"conditions": []map[string]any{{"field": "kind", "value": "b"}}}},
+		{"text": "unknown"},
+		{"text": "east", "k": -1},
+	})
+	if w.Code != 200 {
+		t.Fatalf("POST /batch_query = %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Results []struct {
+			Results []DetailedResult `json:"results"`
+			Error   *apiError        `json:"error"`
+			Status  int              `json:"status"`
+		} `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 5 {
+		t.Fatalf("got %d entries, want 5: %s", len(resp.Results), w.Body)
+	}
+
+	for i, want := range [][]string{{"east", "northeast"}, {"north"}, {"north"}} {
+		entry := resp.Results[i]
+		var ids []string
+		for _, res := range entry.Results {
+			ids = append(ids, res.ID)
+		}
+		if entry.Error != nil || fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Errorf("query %d: results %v, error %+v; want %v", i, ids, entry.Error, want)
+		}
+	}
+	for i, want := range map[int]apiError{3: {Code: "embedding_failed"}, 4: {Code: "invalid_request"}} {
+		entry := resp.Results[i]
+		if entry.Error == nil || entry.Error.Code != want.Code || entry.Results != nil {
+			t.Errorf("query %d: want only a %s error, got %+v", i, want.Code, entry)
+		}
+	}
+	if resp.Results[3].Status != 502 || resp.Results[4].Status != 400 {
+		t.Errorf("entry statuses %d and %d, want 502 and 400", resp.Results[3].Status, resp.Results[4].Status)
+	}
+}
@@ -1,43 +1,425 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
-	"time"
 )
 
 func BenchmarkSearchSpeed(b *testing.B) {
-	// 1. Setup Database
-	store := NewVectorStore()
-	dim := 768 // Standard dimension for nomic-embed-text
-	numRecords := 10000
+	// 768 is the dimension of nomic-embed-text.
+	store, query := benchStore(10000, 768)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Search(query, 5, "default", "", "")
+	}
+}
+
+// benchSeed seeds the vectors benchmarks generate, so every run searches
+// the same data and results can be compared across runs.
+const benchSeed = 1
 
-	fmt.Printf("Generating %d dummy vectors...\n", numRecords)
-	for i := 0; i < numRecords; i++ {
-		vec := make(Vector, dim)
-		for j := 0; j < dim; j++ {
-			vec[j] = rand.Float32()
+// GenerateRandomVectors returns n vectors of dim components uniform in
+// [0, 1), the same ones for the same seed.
+func GenerateRandomVectors(n, dim int, seed int64) []Vector {
+	rng := rand.New(rand.NewSource(seed))
+	vecs := make([]Vector, n)
+	for i := range vecs {
+		vecs[i] = make(Vector, dim)
+		for j := range vecs[i] {
+			vecs[i][j] = rng.Float32()
+		}
+	}
+	return vecs
+}
+
+func TestGenerateRandomVectorsDeterministic(t *testing.T) {
+	a, b := GenerateRandomVectors(20, 8, 7), GenerateRandomVectors(20, 8, 7)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the same seed generated different vectors")
+	}
+	if reflect.DeepEqual(a, GenerateRandomVectors(20, 8, 8)) {
+		t.Error("different seeds generated the same vectors")
+	}
+	for _, v := range a {
+		for _, x := range v {
+			if x < 0 || x >= 1 {
+				t.Fatalf("component %v outside [0, 1)", x)
+			}
 		}
+	}
+}
+
+// benchStore fills a store with numRecords generated vectors in the
+// "default" namespace and returns it with one more vector to query.
+func benchStore(numRecords, dim int) (*VectorStore, Vector) {
+	store := NewVectorStore()
+	vecs := GenerateRandomVectors(numRecords+1, dim, benchSeed)
+	for i, vec := range vecs[:numRecords] {
 		store.AddItem(fmt.Sprintf("id-%d", i), vec, nil, "default")
 	}
+	return store, vecs[numRecords]
+}
+
+func BenchmarkSearchFullVsQuantized(b *testing.B) {
+	store, query := benchStore(10000, 768)
+
+	b.Run("full", func(b *testing.B) {
+		store.UseQuantized = false
+		for i := 0; i < b.N; i++ {
+			store.Search(query, 10, "default", "", "")
+		}
+	})
+	b.Run("quantized", func(b *testing.B) {
+		store.UseQuantized, store.RerankFactor = true, 0
+		for i := 0; i < b.N; i++ {
+			store.Search(query, 10, "default", "", "")
+		}
+	})
+	b.Run("quantized+rerank", func(b *testing.B) {
+		store.UseQuantized, store.RerankFactor = true, 4
+		for i := 0; i < b.N; i++ {
+			store.Search(query, 10, "default", "", "")
+		}
+	})
+}
 
-	// 2. Create a Query Vector
-	query := make(Vector, dim)
-	for j := 0; j < dim; j++ {
-		query[j] = rand.Float32()
+func BenchmarkHNSWVsScan(b *testing.B) {
+	for _, n := range []int{1000, 10000, 50000} {
+		store, query := benchStore(n, 64)
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				store.Search(query, 10, "default", "", "")
+			}
+		})
+		store.BuildHNSW(16, 100)
+		b.Run(fmt.Sprintf("hnsw/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				store.Search(query, 10, "default", "", "")
+			}
+		})
 	}
+}
 
-	// 3. Run Benchmark
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		start := time.Now()
-		results := store.Search(query, 5, "default", "", "")
-		duration := time.Since(start)
+func BenchmarkSnapshotFormats(b *testing.B) {
+	store, _ := benchStore(10000, 768)
+	dir := b.TempDir()
+	formats := []struct {
+		name string
+		save func(string) error
+	}{
+		{"json", store.SaveJSON},
+		{"binary", store.Save},
+	}
+	for _, f := range formats {
+		path := filepath.Join(dir, f.name)
+		if err := f.save(path); err != nil {
+			b.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		b.Run("load/"+f.name, func(b *testing.B) {
+			b.ReportMetric(float64(info.Size()), "file-bytes")
+			for i := 0; i < b.N; i++ {
+				NewVectorStore().Load(path)
+			}
+		})
+	}
+}
+
+// BenchmarkColdStart times Load plus a first query on a large binary
+// snapshot, read into the heap or mapped (see mmap.go).
+func BenchmarkColdStart(b *testing.B) {
+	store, query := benchStore(50000, 384)
+	path := filepath.Join(b.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		b.Fatal(err)
+	}
+	for _, mmap := range []bool{false, true} {
+		name := "read"
+		if mmap {
+			name = "mmap"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				loaded := NewVectorStore()
+				loaded.MmapSnapshots = mmap
+				if err := loaded.Load(path); err != nil {
+					b.Fatal(err)
+				}
+				loaded.Search(query, 10, "", "", "")
+			}
+		})
+	}
+}
+
+// BenchmarkSmallNamespace queries a namespace holding 1% of the records,
+// which the namespace index visits without scanning the other 99%.
+func BenchmarkSmallNamespace(b *testing.B) {
+	store := NewVectorStore()
+	vecs := GenerateRandomVectors(50001, 128, benchSeed)
+	for i, vec := range vecs[:50000] {
+		ns := "big"
+		if i%100 == 0 {
+			ns = "small"
+		}
+		store.AddItem(fmt.Sprintf("id-%d", i), vec, nil, ns)
+	}
+	query := vecs[50000]
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.Search(query, 10, "small", "", "")
+		}
+	})
+	b.Run("full-scan", func(b *testing.B) {
+		// The pre-index behavior: visit every record, skipping by namespace.
+		q := Normalize(query)
+		match := func(r *Record) bool { return r.Namespace == "small" }
+		for i := 0; i < b.N; i++ {
+			store.RLock()
+			store.scan(context.Background(), q, 10, 0, nil, match, nil, nil)
+			store.RUnlock()
+		}
+	})
+}
+
+// BenchmarkBinaryQuantized compares scanning float vectors, int8 codes and
+// sign bits, reporting the bytes each representation scans per vector.
+func BenchmarkBinaryQuantized(b *testing.B) {
+	const dim = 768
+	rng := rand.New(rand.NewSource(1))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 10000, dim) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	query := randomVectors(rng, 1, dim)[0]
+
+	modes := []struct {
+		name              string
+		quantized, binary bool
+		bytesPerVector    int
+	}{
+		{"full", false, false, 4 * dim},
+		{"int8", true, false, dim},
+		{"binary", false, true, 8 * ((dim + 63) / 64)},
+	}
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			store.UseQuantized, store.UseBinary = m.quantized, m.binary
+			b.ReportMetric(float64(m.bytesPerVector), "bytes/vector")
+			for i := 0; i < b.N; i++ {
+				store.Search(query, 10, "", "", "")
+			}
+		})
+	}
+}
+
+// BenchmarkSearchBatch compares 32 separate Search calls with one
+// SearchBatch over the same queries; each op answers all 32.
+func BenchmarkSearchBatch(b *testing.B) {
+	store, _ := benchStore(10000, 768)
+	queries := make([]Vector, 32)
+	for i := range queries {
+		_, queries[i] = benchStore(0, 768)
+	}
+
+	b.Run("separate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, q := range queries {
+				store.Search(q, 10, "", "", "")
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.SearchBatch(queries, 10, "", "", "")
+		}
+	})
+}
 
-		if i == 0 {
-			fmt.Printf("Search took: %v for %d records\n", duration, numRecords)
-			fmt.Printf("Top Result ID: %s, Score: %f\n", results[0].ID, results[0].Score)
+// BenchmarkScanWorkers runs exact scans over stores of increasing size,
+// once with the adaptive worker count and once with all eight workers
+// regardless of size, as scans used to on an eight-core machine.
+func BenchmarkScanWorkers(b *testing.B) {
+	for _, n := range []int{50, 1000, 5000, 20000, 100000} {
+		store, query := benchStore(n, 128)
+		store.MaxWorkers = 8
+		for _, mode := range []string{"adaptive", "every-cpu"} {
+			b.Run(fmt.Sprintf("n=%d/%s", n, mode), func(b *testing.B) {
+				if mode == "every-cpu" {
+					prev := minRecordsPerWorker
+					minRecordsPerWorker = 1
+					defer func() { minRecordsPerWorker = prev }()
+				}
+				for i := 0; i < b.N; i++ {
+					store.Search(query, 10, "", "", "")
+				}
+			})
 		}
 	}
 }
+
+// BenchmarkSkewedFilter searches a store whose filter matches only the
+// first tenth of the records, comparing the collected-matches scan with
+// evaluating the filter inside the scoring workers.
+func BenchmarkSkewedFilter(b *testing.B) {
+	const n = 100000
+	store := NewVectorStore()
+	store.MaxWorkers = 8
+	for i, vec := range GenerateRandomVectors(n, 256, benchSeed) {
+		meta := map[string]string{"hot": "false"}
+		if i < n/10 {
+			meta["hot"] = "true"
+		}
+		store.AddItem(fmt.Sprintf("id-%d", i), vec, meta, "")
+	}
+	_, query := benchStore(0, 256)
+	opts := SearchOptions{K: 10, Filter: Filter{Conditions: []Condition{{Field: "hot", Value: "true"}}}}
+
+	b.Run("collected", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.SearchWithOptions(query, opts)
+		}
+	})
+	b.Run("inline", func(b *testing.B) {
+		q := Normalize(query)
+		match := store.matcher(opts)
+		for i := 0; i < b.N; i++ {
+			store.RLock()
+			store.scan(context.Background(), q, opts.K, 0, nil, match, nil, nil)
+			store.RUnlock()
+		}
+	})
+}
+
+// BenchmarkPQRecall searches 768-dimensional vectors with codebooks of
+// increasing subspace count, reporting code bytes per vector and top-10
+// recall against exact search, with and without the default re-rank.
+func BenchmarkPQRecall(b *testing.B) {
+	const dim, k = 768, 10
+	rng := rand.New(rand.NewSource(1))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 5000, dim) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	queries := randomVectors(rng, 20, dim)
+	exact := make([][]SearchResult, len(queries))
+	for i, q := range queries {
+		exact[i], _ = store.Search(q, k, "", "", "")
+	}
+
+	for _, m := range []int{24, 48, 96, 192} {
+		if err := store.TrainPQ(m, 8); err != nil {
+			b.Fatal(err)
+		}
+		store.UsePQ = true
+		for _, rerank := range []int{1, 0} {
+			name := fmt.Sprintf("m=%d/codes-only", m)
+			if rerank == 0 {
+				name = fmt.Sprintf("m=%d/rerank", m)
+			}
+			b.Run(name, func(b *testing.B) {
+				store.RerankFactor = rerank
+				var recall float64
+				for i, q := range queries {
+					got, _ := store.Search(q, k, "", "", "")
+					recall += overlap(got, exact[i])
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					store.Search(queries[i%len(queries)], k, "", "", "")
+				}
+				b.ReportMetric(recall/float64(len(queries)), "recall")
+				b.ReportMetric(float64(m), "bytes/vector")
+			})
+		}
+	}
+}
+
+// BenchmarkDotProduct compares the pure Go and SIMD dot products on
+// 768-dimensional vectors.
+func BenchmarkDotProduct(b *testing.B) {
+	v := randomVectors(rand.New(rand.NewSource(1)), 2, 768)
+	impls := []struct {
+		name string
+		dot  func(a, b Vector) float32
+	}{
+		{"generic", dotGeneric},
+		{"simd", func(a, b Vector) float32 { return dotSIMD(a, b) }},
+	}
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			if impl.name == "simd" && !hasSIMD {
+				b.Skip("CPU lacks the SIMD dot product")
+			}
+			var sink float32
+			for i := 0; i < b.N; i++ {
+				sink += impl.dot(v[0], v[1])
+			}
+			_ = sink
+		})
+	}
+}
+
+// BenchmarkIndexedFilter searches for one user's records among 100000,
+// 100 per user, with and without an index on the user key.
+func BenchmarkIndexedFilter(b *testing.B) {
+	store := NewVectorStore()
+	for i, vec := range GenerateRandomVectors(100000, 128, benchSeed) {
+		store.AddItem(fmt.Sprintf("id-%d", i), vec, map[string]string{"user_id": fmt.Sprint(i % 1000)}, "")
+	}
+	_, query := benchStore(0, 128)
+	opts := SearchOptions{K: 10, Filter: Filter{Conditions: []Condition{{Field: "user_id", Value: "42"}}}}
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.SearchWithOptions(query, opts)
+		}
+	})
+	store.AddIndexedKey("user_id")
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			store.SearchWithOptions(query, opts)
+		}
+	})
+}
+
+// BenchmarkProjection compares full 768-dimensional scans with scans of
+// vectors projected to 128 dimensions, re-ranked by the default factor.
+func BenchmarkProjection(b *testing.B) {
+	const dim, k = 768, 10
+	rng := rand.New(rand.NewSource(1))
+	data := lowRankVectors(rng, 20020, dim, 32)
+	full, projected := NewVectorStore(), NewVectorStore()
+	for i, v := range data[:20000] {
+		full.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+		projected.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	if err := projected.EnableProjection(128, 1); err != nil {
+		b.Fatal(err)
+	}
+	queries := data[20000:]
+
+	for _, tc := range []struct {
+		name  string
+		store *VectorStore
+	}{{"full", full}, {"projected", projected}} {
+		b.Run(tc.name, func(b *testing.B) {
+			var recall float64
+			for _, q := range queries {
+				got, _ := tc.store.Search(q, k, "", "", "")
+				want, _ := full.Search(q, k, "", "", "")
+				recall += overlap(got, want)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tc.store.Search(queries[i%len(queries)], k, "", "", "")
+			}
+			b.ReportMetric(recall/float64(len(queries)), "recall")
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestQuantizeBinary(t *testing.T) {
+	v := make(Vector, 70)
+	for i := range v {
+		v[i] = -1
+	}
+	v[0], v[63], v[64], v[69] = 0.5, 2, 0.1, 3
+	got := QuantizeBinary(v)
+	want := []uint64{1 | 1<<63, 1 | 1<<5}
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("QuantizeBinary = %#x, want %#x", got, want)
+	}
+
+	if s := HammingScore(got, got); s != 128 {
+		t.Fatalf("self score = %d, want 128", s)
+	}
+	flipped := QuantizeBinary(append(Vector{-0.5}, v[1:]...))
+	if s := HammingScore(got, flipped); s != 127 {
+		t.Fatalf("one flipped sign scored %d, want 127", s)
+	}
+}
+
+// TestBinarySearchRecall measures recall against exact search as the
+// re-rank shortlist grows. Isotropic random vectors are the worst case for
+// sign bits; clustered real embeddings do much better.
+func TestBinarySearchRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 2000, 256) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	queries := randomVectors(rng, 20, 256)
+
+	const k = 10
+	exact := make([][]SearchResult, len(queries))
+	for i, q := range queries {
+		exact[i] = mustSearch(t, store, q, k)
+	}
+
+	store.UseBinary = true
+	prev := 0.0
+	for _, factor := range []int{2, defaultBinaryRerank, 50} {
+		store.RerankFactor = factor
+		var recall float64
+		for i, q := range queries {
+			recall += overlap(mustSearch(t, store, q, k), exact[i])
+		}
+		recall /= float64(len(queries))
+		t.Logf("rerank %2dx: top-%d recall %.2f", factor, k, recall)
+		if recall < prev {
+			t.Fatalf("recall fell from %.2f to %.2f as the shortlist grew", prev, recall)
+		}
+		prev = recall
+	}
+	if prev < 0.9 {
+		t.Fatalf("recall with a 50x shortlist = %.2f, want >= 0.9", prev)
+	}
+
+	// Results are re-ranked, so scores are exact cosines.
+	top := mustSearch(t, store, store.Records[7].Vector, 1)
+	if top[0].ID != "id-7" || top[0].Score < 0.9999 {
+		t.Fatalf("stored vector's own query returned %+v", top)
+	}
+}
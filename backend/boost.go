@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Boost blends a numeric metadata field into the ranking, e.g. recency or
+// popularity: the final score is (1-Weight)*similarity + Weight*b, where b
+// is the field min-max normalized to [0, 1] across the candidates.
+// Records without a numeric value get b = 0.
+type Boost struct {
+	Field  string
+	Weight float32
+}
+
+// boostCandidates is how many vector candidates per result a boosted
+// search re-ranks; boosting can lift records from well below the top k.
+const boostCandidates = 10
+
+var errBoostL2 = errors.New("boosting needs a similarity metric, not a distance such as l2")
+
+func (b Boost) validate(m Metric) error {
+	if b.Field == "" {
+		return errors.New("boost field must be set")
+	}
+	if b.Weight < 0 || b.Weight > 1 {
+		return fmt.Errorf("boost weight must be between 0 and 1, got %v", b.Weight)
+	}
+	if !m.HigherIsBetter() {
+		return errBoostL2
+	}
+	return nil
+}
+
+// applyBoost re-scores candidates with b and returns the new top k.
+// Callers hold the read lock.
+func (vs *VectorStore) applyBoost(candidates []SearchResult, b Boost, k int) []SearchResult {
+	values := make([]float64, len(candidates))
+	known := make([]bool, len(candidates))
+	var lo, hi float64
+	seen := false
+	for i, res := range candidates {
+		raw, ok := vs.Records[vs.IDMap[res.ID]].Metadata[b.Field]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		if !seen {
+			lo, hi, seen = v, v, true
+		}
+		values[i], known[i] = v, true
+		lo, hi = min(lo, v), max(hi, v)
+	}
+
+	top := NewResultHeap(true)
+	for i, res := range candidates {
+		// With a single distinct value every known record gets the
+		// full boost.
+		var norm float32
+		switch {
+		case known[i] && hi > lo:
+			norm = float32((values[i] - lo) / (hi - lo))
+		case known[i]:
+			norm = 1
+		}
+		res.Score = (1-b.Weight)*res.Score + b.Weight*norm
+		top.Offer(res, k)
+	}
+	return top.Drain()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBoostPromotesPopularRecord(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("close", Vector{1, 0.1}, map[string]string{"popularity": "1"}, "")
+	store.AddItem("popular", Vector{1, 0.5}, map[string]string{"popularity": "900"}, "")
+	store.AddItem("unscored", Vector{1, 0.2}, nil, "")
+	store.AddItem("far", Vector{0, 1}, map[string]string{"popularity": "1000"}, "")
+	query := Vector{1, 0}
+
+	plain, _ := store.SearchWithOptions(query, SearchOptions{K: 2})
+	if plain[0].ID != "close" {
+		t.Fatalf("unboosted top = %v", resultIDs(plain))
+	}
+
+	boosted, err := store.SearchWithOptions(query, SearchOptions{K: 2, Boost: &Boost{Field: "popularity", Weight: 0.3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(boosted); len(got) != 2 || got[0] != "popular" || got[1] == "far" {
+		t.Fatalf("boosted = %v (%+v)", got, boosted)
+	}
+
+	if _, err := store.SearchWithOptions(query, SearchOptions{K: 2, Boost: &Boost{Field: "popularity", Weight: 2}}); err == nil {
+		t.Fatal("weight above 1 accepted")
+	}
+	store.Metric = MetricL2
+	if _, err := store.SearchWithOptions(query, SearchOptions{K: 2, Boost: &Boost{Field: "popularity", Weight: 0.3}}); err == nil {
+		t.Fatal("boost accepted under l2")
+	}
+}
+
+func TestQueryBoostFields(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("close", Vector{1, 0.1}, map[string]string{"recency": "0"}, "")
+	db.AddItem("recent", Vector{1, 0.5}, map[string]string{"recency": "10"}, "")
+
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "x", BoostField: "recency", BoostWeight: 0.5})
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 2 || resp.Results[0].ID != "recent" || resp.Results[0].Distance != nil {
+		t.Fatalf("boosted query: %s", w.Body)
+	}
+}
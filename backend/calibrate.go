@@ -0,0 +1,175 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Threshold calibration. Given queries labeled with the IDs that should
+// match them, Calibrate searches each one and sweeps the min_score
+// threshold over the scores returned, measuring at every candidate
+// threshold the precision (returned results that are relevant) and recall
+// (relevant IDs returned) across all queries. The suggested threshold is
+// the one with the best F1. Relevant IDs outside a query's top K count as
+// missed at every threshold, so K bounds the recall that can be reached.
+
+// CalibrationQuery is a query vector and the IDs relevant to it.
+type CalibrationQuery struct {
+	Vector   Vector
+	Relevant []string
+}
+
+// CalibrationPoint is the quality of one threshold.
+type CalibrationPoint struct {
+	Threshold float32 `json:"threshold"`
+	Precision float32 `json:"precision"`
+	Recall    float32 `json:"recall"`
+	F1        float32 `json:"f1"`
+}
+
+// Calibration is the suggested threshold, with its scores embedded, and
+// the curve over every threshold tried, strictest first.
+type Calibration struct {
+	CalibrationPoint
+	Curve []CalibrationPoint `json:"curve"`
+}
+
+var errNoRelevant = errors.New("calibration: no relevant ID was returned by any query")
+
+// Calibrate suggests a MinScore for searches like opts, which sets K,
+// the namespaces and the filter; MinScore itself is ignored. The
+// threshold is inclusive, as MinScore is, and under MetricL2 it is a
+// maximum distance.
+func (vs *VectorStore) Calibrate(queries []CalibrationQuery, opts SearchOptions) (Calibration, error) {
+	if len(queries) == 0 {
+		return Calibration{}, errors.New("calibration: no queries")
+	}
+	vectors := make([]Vector, len(queries))
+	wanted := 0
+	for i, q := range queries {
+		if len(q.Relevant) == 0 {
+			return Calibration{}, fmt.Errorf("calibration: query %d has no relevant IDs", i)
+		}
+		vectors[i] = q.Vector
+		wanted += len(q.Relevant)
+	}
+	opts.MinScore = nil
+	results, err := vs.SearchBatchWithOptions(vectors, opts)
+	if err != nil {
+		return Calibration{}, err
+	}
+
+	type hit struct {
+		score    float32
+		relevant bool
+	}
+	var hits []hit
+	for i, res := range results {
+		for _, r := range res {
+			hits = append(hits, hit{r.Score, slices.Contains(queries[i].Relevant, r.ID)})
+		}
+	}
+	higherIsBetter := vs.Metric.HigherIsBetter()
+	slices.SortStableFunc(hits, func(a, b hit) int {
+		if higherIsBetter {
+			return cmp.Compare(b.score, a.score)
+		}
+		return cmp.Compare(a.score, b.score)
+	})
+
+	var cal Calibration
+	kept, relevant := 0, 0
+	for i, h := range hits {
+		kept++
+		if h.relevant {
+			relevant++
+		}
+		// Every result scoring the same passes or fails a threshold
+		// together, so only the last of a run is a point.
+		if i+1 < len(hits) && hits[i+1].score == h.score {
+			continue
+		}
+		p := CalibrationPoint{
+			Threshold: h.score,
+			Precision: float32(relevant) / float32(kept),
+			Recall:    float32(relevant) / float32(wanted),
+		}
+		if relevant > 0 {
+			p.F1 = 2 * p.Precision * p.Recall / (p.Precision + p.Recall)
+		}
+		cal.Curve = append(cal.Curve, p)
+		if p.F1 > cal.F1 {
+			cal.CalibrationPoint = p
+		}
+	}
+	if relevant == 0 {
+		return Calibration{}, errNoRelevant
+	}
+	return cal, nil
+}
+
+// calibrateRequest is the body of POST /calibrate. Each query gives text
+// to embed or its own vector.
+type calibrateRequest struct {
+	Queries []struct {
+		Text     string   `json:"text"`
+		Vector   Vector   `json:"vector"`
+		Relevant []string `json:"relevant"`
+	} `json:"queries"`
+	K         int     `json:"k"`
+	Namespace string  `json:"namespace"`
+	Filters   *Filter `json:"filters"`
+}
+
+// calibrateHandler answers POST /calibrate with a Calibration.
+func calibrateHandler(c *gin.Context) {
+	countOp("calibrate")
+	var req calibrateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(errorResponse(400, err))
+		return
+	}
+	if req.K == 0 {
+		req.K = 10
+	}
+	if cfg.MaxK > 0 && req.K > cfg.MaxK {
+		c.JSON(errorResponse(400, fmt.Errorf("k must be at most %d", cfg.MaxK)))
+		return
+	}
+	if err := checkNamespace(req.Namespace); err != nil {
+		c.JSON(errorResponse(400, err))
+		return
+	}
+	queries := make([]CalibrationQuery, len(req.Queries))
+	for i, q := range req.Queries {
+		queries[i] = CalibrationQuery{Vector: q.Vector, Relevant: q.Relevant}
+		if len(q.Vector) > 0 {
+			continue
+		}
+		if q.Text == "" {
+			c.JSON(errorResponse(400, fmt.Errorf("query %d needs text or a vector", i)))
+			return
+		}
+		vec, err := embedText(c.Request.Context(), q.Text)
+		if err != nil {
+			c.JSON(errorResponse(502, err))
+			return
+		}
+		queries[i].Vector = vec
+	}
+
+	opts := SearchOptions{K: req.K, Namespace: req.Namespace}
+	if req.Filters != nil {
+		opts.Filter = *req.Filters
+	}
+	cal, err := db.Calibrate(queries, opts)
+	if err != nil {
+		c.JSON(errorResponse(400, err))
+		return
+	}
+	c.JSON(200, cal)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// calibrationStore holds two clusters, around the x and the y axis.
+func calibrationStore(metric Metric) *VectorStore {
+	store := NewVectorStore()
+	store.Metric = metric
+	store.AddItem("x1", Vector{1, 0.1}, nil, "")
+	store.AddItem("x2", Vector{1, 0.2}, nil, "")
+	store.AddItem("x3", Vector{1, 0.6}, nil, "")
+	store.AddItem("y1", Vector{0.1, 1}, nil, "")
+	store.AddItem("y2", Vector{0.2, 1}, nil, "")
+	return store
+}
+
+func TestCalibrate(t *testing.T) {
+	// x3 sits between the clusters and is labeled relevant to neither.
+	queries := []CalibrationQuery{
+		{Vector: Vector{1, 0}, Relevant: []string{"x1", "x2"}},
+		{Vector: Vector{0, 1}, Relevant: []string{"y1", "y2"}},
+	}
+	for _, metric := range []Metric{MetricCosine, MetricL2} {
+		t.Run(string(metric), func(t *testing.T) {
+			store := calibrationStore(metric)
+			cal, err := store.Calibrate(queries, SearchOptions{K: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cal.F1 != 1 || cal.Precision != 1 || cal.Recall != 1 {
+				t.Fatalf("best point %+v, want a perfect split", cal.CalibrationPoint)
+			}
+			// The threshold keeps both clusters and nothing else.
+			for _, q := range queries {
+				results, _ := store.SearchWithOptions(q.Vector, SearchOptions{K: 5, MinScore: &cal.Threshold})
+				if got := resultIDs(results); len(got) != 2 || !containsAll(q.Relevant, got) {
+					t.Errorf("threshold %v returns %v for %v", cal.Threshold, got, q.Relevant)
+				}
+			}
+			// The clusters mirror each other, so their scores pair up
+			// into one point each.
+			if len(cal.Curve) != 6 || cal.Curve[len(cal.Curve)-1].Recall != 1 || cal.Curve[len(cal.Curve)-1].Precision != 0.4 {
+				t.Errorf("curve %+v", cal.Curve)
+			}
+		})
+	}
+
+	store := calibrationStore(MetricCosine)
+	if _, err := store.Calibrate(nil, SearchOptions{K: 5}); err == nil {
+		t.Error("no queries accepted")
+	}
+	if _, err := store.Calibrate([]CalibrationQuery{{Vector: Vector{1, 0}}}, SearchOptions{K: 5}); err == nil {
+		t.Error("query without relevant IDs accepted")
+	}
+	_, err := store.Calibrate([]CalibrationQuery{{Vector: Vector{1, 0}, Relevant: []string{"y2"}}}, SearchOptions{K: 1})
+	if !errors.Is(err, errNoRelevant) {
+		t.Errorf("err = %v, want errNoRelevant", err)
+	}
+}
+
+func containsAll(set, items []string) bool {
+	for _, it := range items {
+		found := false
+		for _, s := range set {
+			found = found || s == it
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCalibrateEndpoint(t *testing.T) {
+	useStore(t, calibrationStore(MetricCosine))
+	staticEmbedding(t, Vector{1, 0})
+
+	body := map[string]any{"queries": []map[string]any{
+		{"text": "x axis", "relevant": []string{"x1", "x2"}},
+		{"vector": Vector{0, 1}, "relevant": []string{"y1", "y2"}},
+	}}
+	w := doJSON(t, "POST", "/calibrate", body)
+	var cal Calibration
+	json.Unmarshal(w.Body.Bytes(), &cal)
+	if w.Code != 200 || cal.F1 != 1 || len(cal.Curve) == 0 {
+		t.Fatalf("calibrate: %d %s", w.Code, w.Body)
+	}
+
+	w = doJSON(t, "POST", "/calibrate", map[string]any{"queries": []map[string]any{{"relevant": []string{"x1"}}}})
+	if w.Code != 400 {
+		t.Fatalf("query without text or vector: %d %s", w.Code, w.Body)
+	}
+}
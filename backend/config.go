@@ -0,0 +1,245 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds deployment settings resolved from the environment.
+type Config struct {
+	// EmbedProvider is "ollama" or "openai".
+	EmbedProvider string
+	EmbedModel    string
+	// OllamaURL is the base URL of the Ollama server, without the API path.
+	OllamaURL string
+	// OpenAIURL is the base of an OpenAI-compatible API, e.g.
+	// https://api.openai.com/v1; OpenAIKey is sent as a Bearer token.
+	OpenAIURL string
+	OpenAIKey string
+	// EmbedTimeout bounds each embedding request; transient failures are
+	// retried EmbedRetries times.
+	EmbedTimeout time.Duration
+	EmbedRetries int
+
+	// ListenAddr is a TCP address, or "unix:/path/to.sock" for a socket.
+	ListenAddr string
+	// GRPCListenAddr serves the gRPC API, addressed like ListenAddr; "off"
+	// disables it.
+	GRPCListenAddr  string
+	ShutdownTimeout time.Duration
+	// DataPath is the snapshot file loaded at startup and saved on exit,
+	// and every SnapshotInterval in between if the store has changed.
+	DataPath         string
+	SnapshotInterval time.Duration
+	// PerNamespaceFiles makes DataPath a directory with one snapshot per
+	// namespace; LoadNamespaces then limits which are loaded, when set.
+	PerNamespaceFiles bool
+	LoadNamespaces    []string
+	// MmapSnapshot maps the snapshot into memory at startup instead of
+	// reading it, for a faster cold start (see mmap.go).
+	MmapSnapshot bool
+	// ExpirySweepInterval is how often records past their TTL are deleted.
+	ExpirySweepInterval time.Duration
+	// APIKeys, when non-empty, are the bearer tokens the HTTP API accepts.
+	APIKeys []string
+	// PublicMetrics serves /metrics without the API key, for scrapers
+	// that cannot send one. The operation counts and store size it
+	// exposes are then readable by anyone who can reach the port.
+	PublicMetrics bool
+	// RateLimit caps the endpoints that call the embedder at this many
+	// requests per second per client, with bursts up to RateBurst; 0
+	// disables limiting.
+	RateLimit float64
+	RateBurst int
+	// SearchWorkers caps the goroutines per brute-force search; 0 uses
+	// one per CPU.
+	SearchWorkers int
+	// SanitizeVectors zeroes NaN and infinite vector components rather
+	// than rejecting the vector.
+	SanitizeVectors bool
+	// NormalizeVectors stores unit-length vectors for cosine similarity;
+	// off, magnitudes are kept and count towards scores.
+	NormalizeVectors bool
+	// StrictDimensions makes startup fail on a snapshot with records of
+	// more than one dimension, rather than dropping the odd ones out.
+	StrictDimensions bool
+	// SoftDelete makes deletes leave tombstones, reclaimed by POST
+	// /compact or, when CompactThreshold is positive, once that many
+	// accumulate.
+	SoftDelete       bool
+	CompactThreshold int
+	// SparseStorage stores mostly-zero vectors sparsely (see sparse.go).
+	SparseStorage bool
+	// MaxRecords, when positive, caps the stored records, evicting by
+	// EvictionPolicy, "fifo" or "lru", beyond it.
+	MaxRecords     int
+	EvictionPolicy EvictionPolicy
+	// DisableSIMD forces the pure Go dot product on CPUs with AVX2.
+	DisableSIMD bool
+	// MaxK caps the k a query may ask for; larger result sets are paged.
+	// 0 means no cap.
+	MaxK int
+	// MaxDim caps the dimensions of any vector accepted, inserted or
+	// queried; 0 means no cap.
+	MaxDim int
+	// ScorePrecision, when positive, rounds the scores in query responses
+	// to that many decimal places; requests may override it.
+	ScorePrecision int
+	// IndexedKeys are metadata keys given an inverted index for equality
+	// filters (see AddIndexedKey).
+	IndexedKeys []string
+	// DefaultNamespace is where records added without a namespace go.
+	DefaultNamespace string
+	// EmbedCacheSize, when positive, keeps that many text embeddings in
+	// memory so repeated texts skip the provider.
+	EmbedCacheSize int
+	// QueryCacheSize, when positive, caches that many /query results for
+	// up to QueryCacheTTL, or until the store changes.
+	QueryCacheSize int
+	QueryCacheTTL  time.Duration
+	// QueryLogSize, when positive, keeps that many recent queries for GET
+	// /debug/queries. Off by default, since query text may be sensitive.
+	QueryLogSize int
+	// PendingQueuePath, when set, is the file /add requests the embedder
+	// failed on are queued in, to be retried every PendingRetryPeriod
+	// (see pending.go).
+	PendingQueuePath   string
+	PendingRetryPeriod time.Duration
+	// ReadySkipEmbedding makes /ready ignore the embedding backend.
+	ReadySkipEmbedding bool
+
+	// WALPath is the write-ahead log file, folded into the snapshot every
+	// WALCompactInterval.
+	WALPath            string
+	WALCompactInterval time.Duration
+}
+
+func LoadConfig() Config {
+	provider := envOr("EMBED_PROVIDER", "ollama")
+	defaultModel := "nomic-embed-text"
+	if provider == "openai" {
+		defaultModel = "text-embedding-3-small"
+	}
+	return Config{
+		EmbedProvider:       provider,
+		EmbedModel:          envOr("EMBED_MODEL", defaultModel),
+		OllamaURL:           envOr("OLLAMA_URL", "http://localhost:11434"),
+		OpenAIURL:           envOr("OPENAI_URL", "https://api.openai.com/v1"),
+		OpenAIKey:           envOr("OPENAI_API_KEY", ""),
+		EmbedTimeout:        envDuration("EMBED_TIMEOUT", 30*time.Second),
+		EmbedRetries:        envInt("EMBED_RETRIES", 2),
+		ListenAddr:          envOr("LISTEN_ADDR", ":8080"),
+		GRPCListenAddr:      envOr("GRPC_LISTEN_ADDR", ":9090"),
+		ShutdownTimeout:     envDuration("SHUTDOWN_TIMEOUT", 5*time.Second),
+		DataPath:            envOr("DATA_PATH", "vectors.json"),
+		SnapshotInterval:    envDuration("SNAPSHOT_INTERVAL", time.Minute),
+		PerNamespaceFiles:   envOr("PER_NAMESPACE_FILES", "") == "true",
+		LoadNamespaces:      envList("LOAD_NAMESPACES"),
+		MmapSnapshot:        envOr("MMAP_SNAPSHOT", "") == "true",
+		ExpirySweepInterval: envDuration("EXPIRY_SWEEP_INTERVAL", time.Minute),
+		APIKeys:             envList("API_KEYS"),
+		PublicMetrics:       envOr("PUBLIC_METRICS", "") == "true",
+		RateLimit:           envFloat("RATE_LIMIT_RPS", 0),
+		RateBurst:           envInt("RATE_LIMIT_BURST", 10),
+		SearchWorkers:       envInt("SEARCH_WORKERS", 0),
+		SanitizeVectors:     envOr("SANITIZE_VECTORS", "") == "true",
+		NormalizeVectors:    envOr("NORMALIZE_VECTORS", "true") == "true",
+		StrictDimensions:    envOr("STRICT_DIMENSIONS", "") == "true",
+		SoftDelete:          envOr("SOFT_DELETE", "") == "true",
+		CompactThreshold:    envInt("COMPACT_THRESHOLD", 0),
+		SparseStorage:       envOr("SPARSE_STORAGE", "") == "true",
+		MaxRecords:          envInt("MAX_RECORDS", 0),
+		EvictionPolicy:      EvictionPolicy(envOr("EVICTION_POLICY", string(EvictFIFO))),
+		DisableSIMD:         envOr("DISABLE_SIMD", "") == "true",
+		MaxK:                envInt("MAX_K", 1000),
+		ScorePrecision:      envInt("SCORE_PRECISION", 0),
+		MaxDim:              envInt("MAX_DIM", 8192),
+		IndexedKeys:         envList("INDEXED_KEYS"),
+		DefaultNamespace:    envOr("DEFAULT_NAMESPACE", ""),
+		EmbedCacheSize:      envInt("EMBED_CACHE_SIZE", 0),
+		QueryCacheSize:      envInt("QUERY_CACHE_SIZE", 0),
+		QueryCacheTTL:       envDuration("QUERY_CACHE_TTL", 30*time.Second),
+		QueryLogSize:        envInt("QUERY_LOG_SIZE", 0),
+		PendingQueuePath:    envOr("PENDING_QUEUE_PATH", ""),
+		PendingRetryPeriod:  envDuration("PENDING_RETRY_INTERVAL", 30*time.Second),
+		ReadySkipEmbedding:  envOr("READY_SKIP_EMBEDDING", "") == "true",
+		WALPath:             envOr("WAL_PATH", "vectors.wal"),
+		WALCompactInterval:  envDuration("WAL_COMPACT_INTERVAL", 5*time.Minute),
+	}
+}
+
+// embedURL is the base URL of the selected provider, for logging.
+func (c Config) embedURL() string {
+	if c.EmbedProvider == "openai" {
+		return c.OpenAIURL
+	}
+	return c.OllamaURL
+}
+
+// envOr returns the value of the environment variable key, or def if unset.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// envFloat parses the environment variable key as a non-negative number,
+// falling back to def when it is unset or malformed.
+func envFloat(key string, def float64) float64 {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Printf("config: ignoring invalid %s=%q", key, v)
+		return def
+	}
+	return f
+}
+
+// envList splits a comma-separated environment variable, dropping blank
+// entries.
+func envList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(envOr(key, ""), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envDuration parses the environment variable key as a time.Duration,
+// falling back to def when it is unset or malformed.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("config: ignoring invalid %s=%q", key, v)
+		return def
+	}
+	return d
+}
+
+// envInt parses the environment variable key as a non-negative integer,
+// falling back to def when it is unset or malformed.
+func envInt(key string, def int) int {
+	v := envOr(key, "")
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("config: ignoring invalid %s=%q", key, v)
+		return def
+	}
+	return n
+}
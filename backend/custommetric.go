@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// customMetric is a scoring function added with RegisterMetric.
+type customMetric struct {
+	score          func(a, b Vector) float32
+	higherIsBetter bool
+}
+
+// customMetrics maps registered names to their functions. Lookups sit on
+// the scan's hot path while registration is rare, so the map is replaced
+// rather than modified and read without a lock.
+var (
+	customMetrics atomic.Pointer[map[Metric]customMetric]
+	registerMu    sync.Mutex
+)
+
+var errMetricDefinition = errors.New("metric needs a name and a scoring function")
+
+// RegisterMetric makes name usable as a store's Metric, scoring a query a
+// against a stored vector b with fn. higherIsBetter says whether fn is a
+// similarity, ranked largest first, or a distance, ranked smallest first.
+// Vectors are stored and queried as given, and searches under a custom
+// metric are always exact: the quantized, PQ and projected modes assume
+// the built-in scores. An HNSW graph does work, ordering by fn, though
+// its recall depends on fn behaving like a distance. Registering a name
+// again replaces its function; the built-in names cannot be registered.
+func RegisterMetric(name string, fn func(a, b Vector) float32, higherIsBetter bool) error {
+	m := Metric(name)
+	switch {
+	case name == "" || fn == nil:
+		return errMetricDefinition
+	case m.builtin():
+		return fmt.Errorf("metric %q is built in", name)
+	}
+
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	next := make(map[Metric]customMetric)
+	if old := customMetrics.Load(); old != nil {
+		maps.Copy(next, *old)
+	}
+	next[m] = customMetric{score: fn, higherIsBetter: higherIsBetter}
+	customMetrics.Store(&next)
+	return nil
+}
+
+// builtin reports whether m is one of the metrics defined in this package;
+// empty means MetricCosine.
+func (m Metric) builtin() bool {
+	return m == "" || m == MetricCosine || m == MetricDot || m == MetricL2 || m == MetricAngular
+}
+
+// custom returns the registered definition of m.
+func (m Metric) custom() (customMetric, bool) {
+	registered := customMetrics.Load()
+	if registered == nil {
+		return customMetric{}, false
+	}
+	c, ok := (*registered)[m]
+	return c, ok
+}
+
+// check reports metrics that are neither built in nor registered.
+func (m Metric) check() error {
+	if _, ok := m.custom(); !ok && !m.builtin() {
+		return fmt.Errorf("unknown metric %q", m)
+	}
+	return nil
+}
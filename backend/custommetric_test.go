@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func manhattan(a, b Vector) float32 {
+	var sum float32
+	for i := range a {
+		sum += float32(math.Abs(float64(a[i] - b[i])))
+	}
+	return sum
+}
+
+func TestRegisterMetric(t *testing.T) {
+	if err := RegisterMetric("cosine", manhattan, false); err == nil {
+		t.Fatal("registered over a built-in metric")
+	}
+	if err := RegisterMetric("nothing", nil, true); err == nil {
+		t.Fatal("registered a nil function")
+	}
+	if err := RegisterMetric("test-manhattan", manhattan, false); err != nil {
+		t.Fatalf("RegisterMetric: %v", err)
+	}
+	// Only the first dimension counts.
+	first := func(a, b Vector) float32 { return a[0] * b[0] }
+	if err := RegisterMetric("test-first", first, true); err != nil {
+		t.Fatalf("RegisterMetric: %v", err)
+	}
+
+	store := NewVectorStore()
+	store.Metric = "test-manhattan"
+	store.AddItem("near", Vector{1, 1}, nil, "")
+	store.AddItem("diagonal", Vector{2, 2}, nil, "")
+	store.AddItem("far", Vector{5, 0}, nil, "")
+	// Manhattan distances from {1, 2}: near 1, diagonal 1, far 6.
+	got := mustSearch(t, store, Vector{1, 2}, 3)
+	if want := []SearchResult{{"diagonal", 1}, {"near", 1}, {"far", 6}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("manhattan search = %v, want %v", got, want)
+	}
+
+	store.Metric = "test-first"
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	if got := resultIDs(mustSearch(t, store, Vector{1, 0}, 3)); !reflect.DeepEqual(got, []string{"far", "diagonal", "near"}) {
+		t.Fatalf("similarity search = %v", got)
+	}
+
+	store.Metric = "unregistered"
+	if _, err := store.SearchWithOptions(Vector{1, 0}, SearchOptions{K: 1}); err == nil {
+		t.Fatal("searched with an unknown metric")
+	}
+}
+
+// TestCustomMetricHNSW checks that the graph orders by a custom metric and
+// that approximate modes fall back to exact scoring under one.
+func TestCustomMetricHNSW(t *testing.T) {
+	if err := RegisterMetric("test-manhattan", manhattan, false); err != nil {
+		t.Fatalf("RegisterMetric: %v", err)
+	}
+	rng := rand.New(rand.NewSource(3))
+	store := NewVectorStore()
+	store.Metric = "test-manhattan"
+	for i, v := range randomVectors(rng, 300, 8) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	queries := randomVectors(rng, 10, 8)
+	exact := make([][]SearchResult, len(queries))
+	for i, q := range queries {
+		exact[i] = mustSearch(t, store, q, 5)
+	}
+
+	store.UseBinary, store.UseQuantized = true, true
+	for i, q := range queries {
+		if got := mustSearch(t, store, q, 5); !reflect.DeepEqual(got, exact[i]) {
+			t.Fatalf("approximate modes changed custom metric results: %v, want %v", got, exact[i])
+		}
+	}
+
+	store.BuildHNSW(8, 64)
+	var recall float64
+	for i, q := range queries {
+		recall += overlap(mustSearch(t, store, q, 5), exact[i])
+	}
+	if recall /= float64(len(queries)); recall < 0.9 {
+		t.Fatalf("HNSW recall under a custom metric: %.2f", recall)
+	}
+}
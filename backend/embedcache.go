@@ -0,0 +1,76 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"sync"
+)
+
+// CachingEmbedder wraps an Embedder with a fixed-size LRU from text to
+// vector, so re-adding or re-querying the same text skips the provider.
+// Unlike the query cache it never goes stale: a text's embedding only
+// changes with the model, which takes a restart. Failures are not cached.
+// Concurrent misses for the same text may each call the provider.
+type CachingEmbedder struct {
+	next  Embedder
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type embedCacheEntry struct {
+	text string
+	vec  []float32
+}
+
+// NewCachingEmbedder caches up to size embeddings from e.
+func NewCachingEmbedder(e Embedder, size int) *CachingEmbedder {
+	return &CachingEmbedder{
+		next:  e,
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Embed returns a copy of the cached vector for text, or embeds it and
+// caches the result.
+func (c *CachingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	c.mu.Lock()
+	if el, ok := c.items[text]; ok {
+		c.order.MoveToFront(el)
+		vec := slices.Clone(el.Value.(*embedCacheEntry).vec)
+		c.mu.Unlock()
+		embedCacheHits.Inc()
+		return vec, nil
+	}
+	c.mu.Unlock()
+	embedCacheMisses.Inc()
+
+	vec, err := c.next.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	c.put(text, slices.Clone(vec))
+	return vec, nil
+}
+
+// put caches vec under text, evicting the least recently used entry when
+// full.
+func (c *CachingEmbedder) put(text string, vec []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[text]; ok {
+		el.Value.(*embedCacheEntry).vec = vec
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[text] = c.order.PushFront(&embedCacheEntry{text: text, vec: vec})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*embedCacheEntry).text)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingEmbedder embeds like lengthEmbedder, counting calls, and fails
+// while fail is set.
+type countingEmbedder struct {
+	calls atomic.Int32
+	fail  atomic.Bool
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.calls.Add(1)
+	if e.fail.Load() {
+		return nil, errors.New("provider down")
+	}
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func TestCachingEmbedder(t *testing.T) {
+	upstream := &countingEmbedder{}
+	cache := NewCachingEmbedder(upstream, 2)
+	ctx := context.Background()
+
+	first, _ := cache.Embed(ctx, "hello")
+	first[0] = -1 // callers own the returned slice
+	second, err := cache.Embed(ctx, "hello")
+	if err != nil || second[0] != 5 {
+		t.Fatalf("cached embedding = %v, %v", second, err)
+	}
+	if n := upstream.calls.Load(); n != 1 {
+		t.Fatalf("%d upstream calls for a repeated text, want 1", n)
+	}
+
+	// "hello" was used last, so "a" is evicted by "bb".
+	cache.Embed(ctx, "a")
+	cache.Embed(ctx, "hello")
+	cache.Embed(ctx, "bb")
+	calls := upstream.calls.Load()
+	cache.Embed(ctx, "hello")
+	if upstream.calls.Load() != calls {
+		t.Fatal("recently used entry was evicted")
+	}
+	cache.Embed(ctx, "a")
+	if upstream.calls.Load() != calls+1 {
+		t.Fatal("least recently used entry was not evicted")
+	}
+
+	upstream.fail.Store(true)
+	if _, err := cache.Embed(ctx, "new"); err == nil {
+		t.Fatal("provider error not returned")
+	}
+	upstream.fail.Store(false)
+	if _, err := cache.Embed(ctx, "new"); err != nil {
+		t.Fatalf("failure was cached: %v", err)
+	}
+}
+
+// TestEmbedCacheSharedByEndpoints adds and then queries the same text and
+// expects one call to the provider, counted on /metrics.
+func TestEmbedCacheSharedByEndpoints(t *testing.T) {
+	useStore(t, NewVectorStore())
+	var calls atomic.Int32
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"embedding":[1,0]}`))
+	})
+	embedder = NewCachingEmbedder(embedder, 10)
+
+	if w := doJSON(t, "POST", "/add", AddRequest{ID: "a", Text: "same text"}); w.Code != 200 {
+		t.Fatalf("add: %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, "POST", "/query", QueryRequest{Text: "same text"}); w.Code != 200 {
+		t.Fatalf("query: %d %s", w.Code, w.Body)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("embedding provider called %d times, want 1", n)
+	}
+	body := doJSON(t, "GET", "/metrics", nil).Body.String()
+	for _, want := range []string{"vectordb_embedding_cache_hits_total", "vectordb_embedding_cache_misses_total"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Embedder turns text into a vector. Implementations must give up when ctx
+// is cancelled.
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// embedBackoff is the wait before the first retry; it doubles each attempt.
+var embedBackoff = 200 * time.Millisecond
+
+// HTTPOptions is the transport behaviour shared by the HTTP providers.
+type HTTPOptions struct {
+	// Client bounds each attempt through its Timeout; nil means
+	// http.DefaultClient, which never times out.
+	Client *http.Client
+	// Retries is how many extra attempts a transient failure (connection
+	// refused or a 5xx) gets.
+	Retries int
+}
+
+// NewEmbedder builds the provider selected by cfg.EmbedProvider.
+func NewEmbedder(cfg Config) (Embedder, error) {
+	opts := HTTPOptions{
+		Client:  &http.Client{Timeout: cfg.EmbedTimeout},
+		Retries: cfg.EmbedRetries,
+	}
+	switch cfg.EmbedProvider {
+	case "ollama":
+		return &OllamaEmbedder{URL: cfg.OllamaURL, Model: cfg.EmbedModel, HTTPOptions: opts}, nil
+	case "openai":
+		return &OpenAIEmbedder{URL: cfg.OpenAIURL, Model: cfg.EmbedModel, APIKey: cfg.OpenAIKey, HTTPOptions: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.EmbedProvider)
+	}
+}
+
+// OllamaEmbedder calls Ollama's /api/embeddings.
+type OllamaEmbedder struct {
+	// URL is the server's base URL, without the API path.
+	URL   string
+	Model string
+	HTTPOptions
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, text string) (_ []float32, err error) {
+	defer finishEmbedding(ctx, "ollama", time.Now(), &err)
+	var res struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	body := map[string]string{"model": e.Model, "prompt": text}
+	if err := e.postJSON(ctx, e.URL+"/api/embeddings", nil, body, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Embedding) == 0 {
+		return nil, errors.New("embedding response contained no vector")
+	}
+	return res.Embedding, nil
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint.
+type OpenAIEmbedder struct {
+	// URL is the API base, e.g. https://api.openai.com/v1.
+	URL    string
+	Model  string
+	APIKey string
+	HTTPOptions
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, text string) (_ []float32, err error) {
+	defer finishEmbedding(ctx, "openai", time.Now(), &err)
+	var res struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	headers := map[string]string{}
+	if e.APIKey != "" {
+		headers["Authorization"] = "Bearer " + e.APIKey
+	}
+	body := map[string]string{"model": e.Model, "input": text}
+	if err := e.postJSON(ctx, e.URL+"/embeddings", headers, body, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) == 0 || len(res.Data[0].Embedding) == 0 {
+		return nil, errors.New("embedding response contained no vector")
+	}
+	return res.Data[0].Embedding, nil
+}
+
+// finishEmbedding logs and counts the outcome of an Embed call that began
+// at start; use with defer.
+func finishEmbedding(ctx context.Context, provider string, start time.Time, err *error) {
+	logger := loggerFrom(ctx).With("provider", provider, "latency", time.Since(start))
+	if *err != nil {
+		embeddingErrors.Inc()
+		logger.Error("embedding failed", "error", *err)
+		return
+	}
+	logger.Debug("embedding done")
+}
+
+// postJSON sends body as JSON and decodes a 200 response into out,
+// retrying transient failures with exponential backoff. Any other status is
+// an error carrying the start of the response body.
+func (o HTTPOptions) postJSON(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	backoff := embedBackoff
+	for attempt := 0; ; attempt++ {
+		err = o.post(ctx, url, headers, jsonData, out)
+		if err == nil || attempt >= o.Retries || !isTransient(err) {
+			return err
+		}
+		loggerFrom(ctx).Warn("embedding attempt failed, retrying",
+			"attempt", attempt+1, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// statusError is a non-200 reply from the embedding backend.
+type statusError struct {
+	code   int
+	status string
+	body   []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("embedding request failed: %s: %s", e.status, e.body)
+}
+
+// isTransient reports whether a failed attempt is worth repeating.
+func isTransient(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func (o HTTPOptions) post(ctx context.Context, url string, headers map[string]string, jsonData []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{code: resp.StatusCode, status: resp.Status, body: bytes.TrimSpace(msg)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding embedding response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOllamaEmbedderUsesConfiguredModel(t *testing.T) {
+	var gotPath, gotModel string
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		gotPath, gotModel = r.URL.Path, body["model"]
+		w.Write([]byte(`{"embedding":[0.1,0.2,0.3]}`))
+	})
+
+	vec, err := embedder.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if gotPath != "/api/embeddings" || gotModel != "test-model" {
+		t.Fatalf("request went to %q with model %q", gotPath, gotModel)
+	}
+	if len(vec) != 3 {
+		t.Fatalf("got %d-dim embedding, want 3", len(vec))
+	}
+}
+
+func TestOllamaEmbedderErrors(t *testing.T) {
+	cases := map[string]http.HandlerFunc{
+		"server error": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"model not found"}`, http.StatusInternalServerError)
+		},
+		"malformed body": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"embedding":[0.1,`))
+		},
+		"empty embedding": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"embedding":[]}`))
+		},
+	}
+	for name, handler := range cases {
+		t.Run(name, func(t *testing.T) {
+			fakeOllama(t, handler)
+			if vec, err := embedder.Embed(context.Background(), "hello"); err == nil {
+				t.Fatalf("Embed returned %v, want error", vec)
+			}
+		})
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	var gotPath, gotAuth, gotModel, gotInput string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		gotModel, gotInput = body["model"], body["input"]
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.5,0.25]}]}`))
+	}))
+	defer srv.Close()
+
+	e := &OpenAIEmbedder{URL: srv.URL + "/v1", Model: "text-embedding-3-small", APIKey: "sk-test"}
+	vec, err := e.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if gotPath != "/v1/embeddings" || gotAuth != "Bearer sk-test" {
+		t.Fatalf("request went to %q with auth %q", gotPath, gotAuth)
+	}
+	if gotModel != "text-embedding-3-small" || gotInput != "hello" {
+		t.Fatalf("request body had model %q input %q", gotModel, gotInput)
+	}
+	if len(vec) != 2 || vec[0] != 0.5 {
+		t.Fatalf("got embedding %v", vec)
+	}
+}
+
+func TestOpenAIEmbedderEmptyData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	e := &OpenAIEmbedder{URL: srv.URL, Model: "m"}
+	if vec, err := e.Embed(context.Background(), "hello"); err == nil {
+		t.Fatalf("Embed returned %v, want error", vec)
+	}
+}
+
+func TestNewEmbedderRejectsUnknownProvider(t *testing.T) {
+	if _, err := NewEmbedder(Config{EmbedProvider: "cohere"}); err == nil {
+		t.Fatal("expected an error for an unknown provider")
+	}
+}
+
+func TestEmbedTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	e := &OllamaEmbedder{URL: srv.URL, Model: "m", HTTPOptions: HTTPOptions{
+		Client: &http.Client{Timeout: 50 * time.Millisecond},
+	}}
+	start := time.Now()
+	_, err := e.Embed(context.Background(), "hello")
+	if err == nil {
+		t.Fatal("Embed succeeded against a hung server")
+	}
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("got %v, want a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Embed took %v to time out", elapsed)
+	}
+}
+
+func TestEmbedHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	e := &OllamaEmbedder{URL: srv.URL, Model: "m"}
+	if _, err := e.Embed(ctx, "hello"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestEmbedRetriesTransientFailures(t *testing.T) {
+	prev := embedBackoff
+	embedBackoff = time.Millisecond
+	t.Cleanup(func() { embedBackoff = prev })
+
+	cases := []struct {
+		name      string
+		failures  int
+		status    int
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"5xx recovers", 2, http.StatusServiceUnavailable, 2, 3, false},
+		{"5xx exhausts retries", 3, http.StatusBadGateway, 2, 3, true},
+		{"4xx is not retried", 1, http.StatusBadRequest, 2, 1, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(calls.Add(1)) <= tc.failures {
+					http.Error(w, "busy", tc.status)
+					return
+				}
+				w.Write([]byte(`{"embedding":[1,2]}`))
+			}))
+			defer srv.Close()
+
+			e := &OllamaEmbedder{URL: srv.URL, Model: "m", HTTPOptions: HTTPOptions{Retries: tc.retries}}
+			_, err := e.Embed(context.Background(), "hello")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Embed error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got := int(calls.Load()); got != tc.wantCalls {
+				t.Fatalf("server saw %d calls, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestEmbedRetriesConnectionRefused(t *testing.T) {
+	prev := embedBackoff
+	embedBackoff = time.Millisecond
+	t.Cleanup(func() { embedBackoff = prev })
+
+	// Grab a free port and close it so nothing is listening.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	e := &OllamaEmbedder{URL: "http://" + addr, Model: "m", HTTPOptions: HTTPOptions{Retries: 1}}
+	if _, err := e.Embed(context.Background(), "hello"); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("got %v, want connection refused", err)
+	}
+}
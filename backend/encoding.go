@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Response encoding. Clients fetching large result sets, especially with
+// vectors, can send Accept: application/msgpack to get them as MessagePack
+// instead of JSON, which roughly halves the size of float arrays. Field
+// names follow the json tags. Only the bulk read endpoints negotiate, and
+// their errors are always JSON.
+
+const (
+	mimeMsgPack  = "application/msgpack"
+	mimeXMsgPack = "application/x-msgpack"
+)
+
+// wantsMsgPack reports whether the client prefers MessagePack to JSON.
+func wantsMsgPack(c *gin.Context) bool {
+	switch c.NegotiateFormat(gin.MIMEJSON, mimeMsgPack, mimeXMsgPack) {
+	case mimeMsgPack, mimeXMsgPack:
+		return true
+	}
+	return false
+}
+
+// respond writes obj as JSON or, if the client asked for it, MessagePack.
+func respond(c *gin.Context, code int, obj any) {
+	if wantsMsgPack(c) {
+		c.Render(code, render.MsgPack{Data: obj})
+		return
+	}
+	c.JSON(code, obj)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+// getMsgPack requests path with an Accept header asking for MessagePack.
+func getMsgPack(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", mimeMsgPack)
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), mimeMsgPack) {
+		t.Fatalf("%s %s: %d %q %s", method, path, w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	return w
+}
+
+func TestMsgPackResponses(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("a", Vector{3, 4}, map[string]string{"k": "v"}, "")
+	db.AddItem("b", Vector{0, 1}, nil, "")
+
+	var query struct {
+		Results []DetailedResult `json:"results"`
+	}
+	w := getMsgPack(t, "POST", "/query", `{"text": "q", "k": 2}`)
+	if err := codec.NewDecoderBytes(w.Body.Bytes(), new(codec.MsgpackHandle)).Decode(&query); err != nil {
+		t.Fatal(err)
+	}
+	if len(query.Results) != 2 || query.Results[0].ID != "a" || query.Results[0].Metadata["k"] != "v" || query.Results[0].Score < 0.5 {
+		t.Fatalf("query decoded as %+v", query.Results)
+	}
+
+	var list struct {
+		Records []struct {
+			ID     string `json:"id"`
+			Vector Vector `json:"vector"`
+		} `json:"records"`
+	}
+	w = getMsgPack(t, "GET", "/list?include_vector=true", "")
+	if err := codec.NewDecoderBytes(w.Body.Bytes(), new(codec.MsgpackHandle)).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Records) != 2 || list.Records[0].ID != "a" || !approxEqual(list.Records[0].Vector, Vector{3, 4}) {
+		t.Fatalf("list decoded as %+v", list.Records)
+	}
+
+	w = getMsgPack(t, "GET", "/export", "")
+	dec := codec.NewDecoder(bytes.NewReader(w.Body.Bytes()), new(codec.MsgpackHandle))
+	var ids []string
+	for {
+		var line importLine
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, line.ID)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("export decoded %v", ids)
+	}
+
+	// JSON stays the default.
+	if w := doJSON(t, "POST", "/query", QueryRequest{Text: "q"}); !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("default Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+}
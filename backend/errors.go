@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error responses. Every failed request is answered with
+//
+//	{"error": {"code": "not_found", "message": "record not found: a"}}
+//
+// where code is a stable, machine-readable name and message is for
+// people. The store's sentinel errors each have a fixed status and code;
+// anything else keeps the status its handler chose and is coded by it.
+
+// ErrEmbedding wraps an error from the embedding backend, so callers can
+// tell a failed embedding from a bad request.
+var ErrEmbedding = errors.New("embedding failed")
+
+// errorCodes maps the sentinel errors to their status and code; the first
+// match wins.
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrNotFound, 404, "not_found"},
+	{ErrDimensionMismatch, 400, "dimension_mismatch"},
+	{ErrVectorTooLarge, 400, "vector_too_large"},
+	{ErrNonFinite, 400, "non_finite_vector"},
+	{ErrInvalidK, 400, "invalid_k"},
+	{ErrVersionConflict, 409, "version_conflict"},
+	{ErrNamespaceNotLoaded, 409, "namespace_not_loaded"},
+	{ErrEmbedding, 502, "embedding_failed"},
+	{ErrClosed, 503, "store_closed"},
+}
+
+// statusCodes names the errors that match no sentinel by their status.
+var statusCodes = map[int]string{
+	400: "invalid_request",
+	401: "unauthorized",
+	404: "not_found",
+	409: "conflict",
+	429: "rate_limited",
+	502: "bad_gateway",
+	503: "unavailable",
+	504: "timeout",
+}
+
+// apiError is the value of "error" in an error response.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorResponse returns the status and body answering err: the
+// sentinel's status, if err wraps one, otherwise status. Callers may add
+// fields to the body before sending it.
+func errorResponse(status int, err error) (int, gin.H) {
+	code := ""
+	for _, ec := range errorCodes {
+		if errors.Is(err, ec.err) {
+			status, code = ec.status, ec.code
+			break
+		}
+	}
+	if code == "" {
+		code = statusCodes[status]
+	}
+	if code == "" {
+		code = "internal"
+	}
+	return status, gin.H{"error": apiError{Code: code, Message: err.Error()}}
+}
+
+// embedText embeds text with the package-level embedder, wrapping any
+// failure but a cancelled request in ErrEmbedding.
+func embedText(ctx context.Context, text string) (Vector, error) {
+	vec, err := embedder.Embed(ctx, text)
+	if err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w: %w", ErrEmbedding, err)
+	}
+	return Vector(vec), err
+}
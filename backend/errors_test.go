@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		err    error
+		want   int
+		code   string
+	}{
+		{400, fmt.Errorf("%w: a", ErrNotFound), 404, "not_found"},
+		{400, fmt.Errorf("query 2: %w: got 3, want 2", ErrDimensionMismatch), 400, "dimension_mismatch"},
+		{500, fmt.Errorf("%w: connection refused", ErrEmbedding), 502, "embedding_failed"},
+		{400, ErrClosed, 503, "store_closed"},
+		{400, ErrVersionConflict, 409, "version_conflict"},
+		{400, errors.New("k must be positive"), 400, "invalid_request"},
+		{429, errRateLimited, 429, "rate_limited"},
+		{504, errors.New("timed out after 5s"), 504, "timeout"},
+		{500, errors.New("disk full"), 500, "internal"},
+	} {
+		status, body := errorResponse(tc.status, tc.err)
+		got, _ := body["error"].(apiError)
+		if status != tc.want || got.Code != tc.code || got.Message != tc.err.Error() {
+			t.Errorf("errorResponse(%d, %q) = %d %+v, want %d %s", tc.status, tc.err, status, got, tc.want, tc.code)
+		}
+	}
+}
+
+// TestErrorResponses checks the handlers answer the store's errors with
+// their status and the shared body shape.
+func TestErrorResponses(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("a", Vector{1, 0}, nil, "")
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) { http.Error(w, "model not found", 404) })
+
+	closed := NewVectorStore()
+	closed.Close()
+	for _, tc := range []struct {
+		name   string
+		store  *VectorStore
+		method string
+		path   string
+		body   any
+		status int
+		code   string
+	}{
+		{"unknown id", db, "GET", "/item/missing", nil, 404, "not_found"},
+		{"unknown similar", db, "GET", "/similar/missing", nil, 404, "not_found"},
+		{"wrong dimension", db, "POST", "/query_vector", map[string]any{"vector": Vector{1, 0, 0}}, 400, "dimension_mismatch"},
+		{"embedding down", db, "POST", "/query", map[string]any{"text": "q"}, 502, "embedding_failed"},
+		{"diagnostic embedding down", db, "GET", "/diag/embedding", nil, 502, "embedding_failed"},
+		{"closed store", closed, "POST", "/optimize", nil, 503, "store_closed"},
+		{"bad request", db, "POST", "/query", map[string]any{"text": "q", "k": -1}, 400, "invalid_request"},
+	} {
+		useStore(t, tc.store)
+		w := doJSON(t, tc.method, tc.path, tc.body)
+		var resp struct{ Error apiError }
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v in %s", tc.name, err, w.Body)
+		}
+		if w.Code != tc.status || resp.Error.Code != tc.code || resp.Error.Message == "" {
+			t.Errorf("%s: %d %s, want %d %s", tc.name, w.Code, w.Body, tc.status, tc.code)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// With MaxRecords set, writes that take the store past it evict records
+// until it is back at the limit, oldest first by the Eviction policy. A
+// single counter orders events: every add stamps the record's Seq, and
+// under EvictLRU every search result is stamped too, in a side map kept
+// apart from the records since searches only hold the read lock. Access
+// times are not saved, so after a restart LRU starts over from the write
+// order. Evictions are logged as deletes, so a replayed log arrives at the
+// same records without evicting again.
+
+// EvictionPolicy picks which records go once MaxRecords is exceeded.
+type EvictionPolicy string
+
+const (
+	// EvictFIFO evicts the records added, or last replaced, longest ago.
+	EvictFIFO EvictionPolicy = "fifo"
+	// EvictLRU evicts the records neither added nor returned by a search
+	// for longest.
+	EvictLRU EvictionPolicy = "lru"
+)
+
+func (p EvictionPolicy) validate() error {
+	switch p {
+	case "", EvictFIFO, EvictLRU:
+		return nil
+	}
+	return fmt.Errorf("unknown eviction policy %q", p)
+}
+
+// tracksAccess reports whether searches need to stamp their results.
+func (vs *VectorStore) tracksAccess() bool {
+	return vs.MaxRecords > 0 && vs.Eviction == EvictLRU
+}
+
+// touch stamps results as just used. Callers hold at least the read lock.
+func (vs *VectorStore) touch(results []SearchResult) {
+	if !vs.tracksAccess() || len(results) == 0 {
+		return
+	}
+	vs.accessMu.Lock()
+	defer vs.accessMu.Unlock()
+	if vs.lastAccess == nil {
+		vs.lastAccess = make(map[string]uint64)
+	}
+	for _, res := range results {
+		vs.lastAccess[res.ID] = vs.tick.Add(1)
+	}
+}
+
+// forget drops id's access stamp. Callers hold the write lock.
+func (vs *VectorStore) forget(id string) {
+	vs.accessMu.Lock()
+	delete(vs.lastAccess, id)
+	vs.accessMu.Unlock()
+}
+
+// lastUsedLocked is when rec was last added or, under EvictLRU,
+// returned by a search. Callers hold the write lock.
+func (vs *VectorStore) lastUsedLocked(rec *Record) uint64 {
+	used := rec.Seq
+	if vs.Eviction == EvictLRU {
+		if t := vs.lastAccess[rec.ID]; t > used {
+			used = t
+		}
+	}
+	return used
+}
+
+// evictLocked deletes the least recently used records, or the oldest
+// under EvictFIFO, while there are more than MaxRecords, and returns how
+// many went. Callers hold the write lock and sync the log.
+func (vs *VectorStore) evictLocked() int {
+	excess := len(vs.Records) - vs.tombstones - vs.MaxRecords
+	if vs.MaxRecords <= 0 || excess <= 0 {
+		return 0
+	}
+	vs.accessMu.Lock()
+	victims := make([]*Record, 0, len(vs.Records)-vs.tombstones)
+	for i := range vs.Records {
+		if !vs.Records[i].Deleted {
+			victims = append(victims, &vs.Records[i])
+		}
+	}
+	// Stable, so records saved before Seq existed go in slice order.
+	slices.SortStableFunc(victims, func(a, b *Record) int {
+		return cmp.Compare(vs.lastUsedLocked(a), vs.lastUsedLocked(b))
+	})
+	vs.accessMu.Unlock()
+
+	// Deleting moves records around, so take the IDs first.
+	ids := make([]string, excess)
+	for i := range ids {
+		ids[i] = victims[i].ID
+	}
+	for _, id := range ids {
+		vs.deleteLocked(id)
+	}
+	evictions.Add(float64(len(ids)))
+	return len(ids)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// storedIDs returns the live record IDs, sorted.
+func storedIDs(vs *VectorStore) []string {
+	var ids []string
+	for _, rec := range vs.Records {
+		if !rec.Deleted {
+			ids = append(ids, rec.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestEvictFIFO(t *testing.T) {
+	for _, soft := range []bool{false, true} {
+		t.Run(fmt.Sprintf("soft=%t", soft), func(t *testing.T) {
+			store := NewVectorStore()
+			store.MaxRecords, store.SoftDelete = 3, soft
+			store.AddIndexedKey("k")
+			for i := range 5 {
+				store.AddItem(fmt.Sprintf("id-%d", i), Vector{1, float32(i)}, map[string]string{"k": "v"}, "")
+			}
+			if got, want := storedIDs(store), []string{"id-2", "id-3", "id-4"}; !slices.Equal(got, want) {
+				t.Fatalf("kept %v, want %v", got, want)
+			}
+			// Replacing a record counts as adding it again.
+			store.AddItem("id-2", Vector{1, 2}, nil, "")
+			store.AddItem("id-5", Vector{1, 5}, nil, "")
+			if got, want := storedIDs(store), []string{"id-2", "id-4", "id-5"}; !slices.Equal(got, want) {
+				t.Fatalf("kept %v, want %v", got, want)
+			}
+			store.Compact()
+			checkIndexes(t, store)
+			checkMetaIndex(t, store)
+		})
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	store := NewVectorStore()
+	store.MaxRecords, store.Eviction = 3, EvictLRU
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	store.AddItem("b", Vector{0, 1}, nil, "")
+	store.AddItem("c", Vector{-1, 0}, nil, "")
+
+	// Searching for a keeps it; b is then the least recently used.
+	if _, err := store.SearchWithOptions(Vector{1, 0}, SearchOptions{K: 1}); err != nil {
+		t.Fatal(err)
+	}
+	store.AddItem("d", Vector{0, -1}, nil, "")
+	if got, want := storedIDs(store), []string{"a", "c", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("kept %v, want %v", got, want)
+	}
+	checkIndexes(t, store)
+
+	errs := store.BatchAddItem([]Record{{ID: "e", Vector: Vector{1, 1}}, {ID: "f", Vector: Vector{1, -1}}})
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a's search came before d was added.
+	if got, want := storedIDs(store), []string{"d", "e", "f"}; !slices.Equal(got, want) {
+		t.Fatalf("after batch kept %v, want %v", got, want)
+	}
+	if len(store.lastAccess) != 0 {
+		t.Errorf("access stamps kept for %d evicted records", len(store.lastAccess))
+	}
+	checkIndexes(t, store)
+}
+
+func TestEvictionSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	snapshot, wal := filepath.Join(dir, "vectors.db"), filepath.Join(dir, "vectors.wal")
+	store := NewVectorStore()
+	store.MaxRecords = 2
+	if err := store.EnableWAL(wal); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Load(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	store.AddItem("b", Vector{0, 1}, nil, "")
+	if err := store.Save(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	store.AddItem("c", Vector{1, 1}, nil, "")
+
+	// The snapshot holds a and b, the log adds c and evicts a.
+	replayed := NewVectorStore()
+	replayed.MaxRecords = 2
+	if err := replayed.EnableWAL(wal); err != nil {
+		t.Fatal(err)
+	}
+	if err := replayed.Load(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := storedIDs(replayed), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("after replay kept %v, want %v", got, want)
+	}
+
+	// A lower limit applies on load, evicting the oldest.
+	lowered := NewVectorStore()
+	lowered.MaxRecords = 1
+	if err := lowered.Load(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := storedIDs(lowered), []string{"b"}; !slices.Equal(got, want) {
+		t.Fatalf("with a lower limit kept %v, want %v", got, want)
+	}
+	checkIndexes(t, lowered)
+}
+
+func TestEvictionPolicyValidate(t *testing.T) {
+	for _, p := range []EvictionPolicy{"", EvictFIFO, EvictLRU} {
+		if err := p.validate(); err != nil {
+			t.Errorf("%q: %v", p, err)
+		}
+	}
+	if err := EvictionPolicy("random").validate(); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+// Explain reports how a search arrived at its results, for debugging
+// filters and "why is my document missing". Set SearchOptions.Explain to
+// have a search fill one in. The counters come from a separate exact pass
+// over the searched records, made under the same read lock as the search,
+// so they do not depend on HNSW or the approximate modes and roughly
+// double the cost of the query.
+type Explain struct {
+	// Namespaces lists the namespaces searched; empty means all.
+	Namespaces []string `json:"namespaces"`
+	// Scanned counts the stored records in those namespaces, and among
+	// the IDs searched if the search was limited to some.
+	Scanned int `json:"scanned"`
+	// Expired counts scanned records past their expiry, which never match.
+	Expired int `json:"expired"`
+	// Conditions gives, per filter condition, how many unexpired scanned
+	// records satisfy it on its own.
+	Conditions []ConditionExplain `json:"conditions,omitempty"`
+	// Matched counts the records passing the whole filter: the candidates
+	// the top K is drawn from.
+	Matched int `json:"matched"`
+	// Returned is the number of results, after MinScore.
+	Returned int `json:"returned"`
+	// Scores summarizes the matched records' exact scores; nil when none
+	// matched.
+	Scores *ScoreSummary `json:"scores,omitempty"`
+}
+
+// ConditionExplain is one filter condition and the records passing it.
+type ConditionExplain struct {
+	Condition
+	Passed int `json:"passed"`
+}
+
+// ScoreSummary describes a score distribution.
+type ScoreSummary struct {
+	Min  float32 `json:"min"`
+	Max  float32 `json:"max"`
+	Mean float32 `json:"mean"`
+}
+
+// explainLocked fills ex for the search of prepared query q under opts
+// that returned results. Callers hold the read lock.
+func (vs *VectorStore) explainLocked(ex *Explain, q Vector, opts SearchOptions, results []SearchResult) {
+	namespaces := opts.namespaces()
+	*ex = Explain{Namespaces: append([]string{}, namespaces...), Returned: len(results)}
+	for _, c := range opts.Filter.Conditions {
+		ex.Conditions = append(ex.Conditions, ConditionExplain{Condition: c})
+	}
+
+	now := vs.clock()
+	inScope := opts.idScope()
+	subset := vs.subset(namespaces)
+	total := len(vs.Records)
+	if subset != nil {
+		total = len(subset)
+	}
+	var sum float64
+	for j := range total {
+		idx := j
+		if subset != nil {
+			idx = subset[j]
+		}
+		rec := &vs.Records[idx]
+		if rec.Deleted || !inScope(rec.ID) {
+			continue
+		}
+		ex.Scanned++
+		if rec.expired(now) {
+			ex.Expired++
+			continue
+		}
+		for i := range ex.Conditions {
+			if ex.Conditions[i].matches(rec.Metadata, rec.Tags) {
+				ex.Conditions[i].Passed++
+			}
+		}
+		if !opts.Filter.Matches(rec.Metadata, rec.Tags) {
+			continue
+		}
+		ex.Matched++
+		s := vs.scoreRecord(q, rec)
+		sum += float64(s)
+		if ex.Scores == nil {
+			ex.Scores = &ScoreSummary{Min: s, Max: s}
+		}
+		ex.Scores.Min = min(ex.Scores.Min, s)
+		ex.Scores.Max = max(ex.Scores.Max, s)
+	}
+	if ex.Scores != nil {
+		ex.Scores.Mean = float32(sum / float64(ex.Matched))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExplainCounters(t *testing.T) {
+	store := NewVectorStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	for i := range 10 {
+		color := "blue"
+		if i%3 == 0 {
+			color = "red" // 0, 3, 6, 9
+		}
+		rec := Record{ID: fmt.Sprintf("id-%d", i), Vector: Vector{1, float32(i)}, Metadata: map[string]string{"color": color, "n": fmt.Sprint(i)}}
+		if i == 9 {
+			rec.ExpiresAt = now.Add(-time.Second)
+		}
+		store.AddRecord(rec)
+	}
+	store.AddItem("elsewhere", Vector{1, 0}, map[string]string{"color": "red"}, "other")
+
+	var ex Explain
+	opts := SearchOptions{K: 2, Explain: &ex, Filter: Filter{Conditions: []Condition{
+		{Field: "color", Value: "red"},
+		{Field: "n", Op: OpLt, Value: "8"},
+	}}}
+	results, err := store.SearchWithOptions(Vector{1, 0}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results", len(results))
+	}
+	// 11 records, one expired; red: 0, 3, 6 and "elsewhere"; n < 8: 0-7.
+	if ex.Scanned != 11 || ex.Expired != 1 || ex.Matched != 3 || ex.Returned != 2 {
+		t.Fatalf("explain = %+v", ex)
+	}
+	if len(ex.Conditions) != 2 || ex.Conditions[0].Passed != 4 || ex.Conditions[1].Passed != 8 {
+		t.Fatalf("condition counts = %+v", ex.Conditions)
+	}
+	if ex.Scores == nil || ex.Scores.Max != results[0].Score || ex.Scores.Min > results[1].Score {
+		t.Fatalf("scores = %+v for results %+v", ex.Scores, results)
+	}
+
+	ex = Explain{}
+	opts.Namespace = "other"
+	if _, err := store.SearchWithOptions(Vector{1, 0}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if ex.Scanned != 1 || ex.Matched != 0 || ex.Returned != 0 || ex.Scores != nil || len(ex.Namespaces) != 1 {
+		t.Fatalf("namespaced explain = %+v", ex)
+	}
+}
+
+func TestQueryExplainEndpoint(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("a", Vector{1, 0}, map[string]string{"kind": "x"}, "")
+	db.AddItem("b", Vector{1, 1}, map[string]string{"kind": "y"}, "")
+
+	req := QueryRequest{Text: "q", K: 5, Filters: &Filter{Conditions: []Condition{{Field: "kind", Value: "x"}}}}
+	w := doJSON(t, "POST", "/query?explain=true", req)
+	var resp struct {
+		Results []DetailedResult
+		Explain *Explain
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp.Explain == nil || resp.Explain.Scanned != 2 || resp.Explain.Matched != 1 || len(resp.Results) != 1 {
+		t.Fatalf("explain query: %d %s", w.Code, w.Body)
+	}
+
+	w = doJSON(t, "POST", "/query", req)
+	var plain map[string]any
+	if json.Unmarshal(w.Body.Bytes(), &plain); plain["explain"] != nil {
+		t.Fatalf("explain without ?explain=true: %s", w.Body)
+	}
+}
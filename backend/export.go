@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// exportChunkSize is how many records GET /export copies per read lock.
+const exportChunkSize = 500
+
+// exportHandler streams every record, or those in ?namespace=, as JSONL:
+// one object per line with the vector as inserted, in the same shape
+// POST /import accepts, so an export can be loaded back without
+// re-embedding. Asked for MessagePack (see encoding.go), it streams the
+// same objects as consecutive MessagePack values instead.
+func exportHandler(c *gin.Context) {
+	countOp("export")
+	var enc interface{ Encode(any) error }
+	if wantsMsgPack(c) {
+		// MessagePack values are self-delimiting, so they follow one
+		// another without separators.
+		c.Header("Content-Type", mimeMsgPack)
+		enc = codec.NewEncoder(c.Writer, new(codec.MsgpackHandle))
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		enc = json.NewEncoder(c.Writer)
+	}
+	c.Status(200)
+
+	err := db.ForEachChunk(c.Query("namespace"), exportChunkSize, func(chunk []Record) error {
+		for _, rec := range chunk {
+			line := importLine{
+				AddRequest: AddRequest{ID: rec.ID, Namespace: rec.Namespace, Metadata: rec.Metadata, Tags: rec.Tags},
+				Vector:     rec.Vector,
+				Sparse:     rec.Sparse,
+				ExpiresAt:  rec.ExpiresAt,
+			}
+			if err := enc.Encode(line); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// The status is already sent; the client sees a truncated body.
+		loggerFrom(c.Request.Context()).Warn("export aborted", "error", err)
+	}
+}
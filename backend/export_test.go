@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	src := NewVectorStore()
+	for i, id := range []string{"a", "b", "c"} {
+		src.AddItem(id, Vector{float32(i + 1), 4, 0}, map[string]string{"text": id, "n": id + id}, "docs")
+	}
+	src.AddItem("other", Vector{0, 0, 1}, nil, "misc")
+	useStore(t, src)
+
+	w := doJSON(t, "GET", "/export", nil)
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/x-ndjson") {
+		t.Fatalf("export: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	dump := w.Body.String()
+	lines := 0
+	for sc := bufio.NewScanner(strings.NewReader(dump)); sc.Scan(); {
+		lines++
+	}
+	if lines != 4 {
+		t.Fatalf("exported %d lines, want 4:\n%s", lines, dump)
+	}
+	if w := doJSON(t, "GET", "/export?namespace=docs", nil); strings.Count(w.Body.String(), "\n") != 3 {
+		t.Fatalf("namespace export:\n%s", w.Body)
+	}
+
+	// Reloading the export must not need the embedder: leave none set.
+	useStore(t, NewVectorStore())
+	prev := embedder
+	embedder = nil
+	t.Cleanup(func() { embedder = prev })
+
+	req := httptest.NewRequest("POST", "/import", strings.NewReader(dump))
+	rw := httptest.NewRecorder()
+	setupRouter().ServeHTTP(rw, req)
+	if rw.Code != 200 || !strings.Contains(rw.Body.String(), `"imported":4`) {
+		t.Fatalf("re-import: %d %s", rw.Code, rw.Body)
+	}
+
+	want := src.Snapshot()
+	if db.Len() != len(want) {
+		t.Fatalf("re-imported %d records, want %d", db.Len(), len(want))
+	}
+	for _, rec := range want {
+		got, ok := recordByID(rec.ID)
+		if !ok || got.Namespace != rec.Namespace || len(got.Metadata) != len(rec.Metadata) {
+			t.Fatalf("%s: got %+v, want %+v", rec.ID, got, rec)
+		}
+		for k, v := range rec.Metadata {
+			if got.Metadata[k] != v {
+				t.Fatalf("%s: metadata %q = %q, want %q", rec.ID, k, got.Metadata[k], v)
+			}
+		}
+		orig, back := rec.Original(), got.Original()
+		for i := range orig {
+			if math.Abs(float64(orig[i]-back[i])) > 1e-5 {
+				t.Fatalf("%s: vector %v, want %v", rec.ID, back, orig)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Filter operators understood by Condition.
+const (
+	OpEq  = "eq"
+	OpIn  = "in"
+	OpGt  = "gt"
+	OpGte = "gte"
+	OpLt  = "lt"
+	OpLte = "lte"
+	// OpContains and OpContainsAny test a record's tag list (Record.Tags)
+	// for Value, or for any of Values.
+	OpContains    = "contains"
+	OpContainsAny = "contains_any"
+)
+
+// FilterValue is a condition operand. Metadata is stored as strings, but
+// JSON numbers are accepted too so range filters can be written naturally.
+type FilterValue string
+
+func (v *FilterValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = FilterValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("filter value must be a string or number: %s", data)
+	}
+	*v = FilterValue(n)
+	return nil
+}
+
+// Condition matches a single metadata field, or a tag list for the
+// contains operators.
+type Condition struct {
+	Field string `json:"field"`
+	// Op defaults to OpEq when empty.
+	Op     string      `json:"op,omitempty"`
+	Value  FilterValue `json:"value,omitempty"`
+	Values []string    `json:"values,omitempty"` // for OpIn and OpContainsAny
+}
+
+func (c Condition) matches(meta map[string]string, tags map[string][]string) bool {
+	val, ok := meta[c.Field]
+	switch c.Op {
+	case OpContains:
+		return slices.Contains(tags[c.Field], string(c.Value))
+	case OpContainsAny:
+		for _, v := range c.Values {
+			if slices.Contains(tags[c.Field], v) {
+				return true
+			}
+		}
+		return false
+	case OpIn:
+		for _, v := range c.Values {
+			if ok && val == v {
+				return true
+			}
+		}
+		return false
+	case OpGt, OpGte, OpLt, OpLte:
+		// Non-numeric metadata never satisfies a range.
+		x, err := strconv.ParseFloat(val, 64)
+		if !ok || err != nil {
+			return false
+		}
+		bound, _ := strconv.ParseFloat(string(c.Value), 64)
+		switch c.Op {
+		case OpGt:
+			return x > bound
+		case OpGte:
+			return x >= bound
+		case OpLt:
+			return x < bound
+		default:
+			return x <= bound
+		}
+	default:
+		if val == string(c.Value) {
+			return true
+		}
+		// "10" and "10.0" are equal when both sides are numeric.
+		x, errX := strconv.ParseFloat(val, 64)
+		y, errY := strconv.ParseFloat(string(c.Value), 64)
+		return ok && errX == nil && errY == nil && x == y
+	}
+}
+
+// Filter combines metadata conditions with AND (the default) or OR. The
+// zero Filter matches every record.
+type Filter struct {
+	// Mode is "and" or "or"; empty means "and".
+	Mode       string      `json:"mode,omitempty"`
+	Conditions []Condition `json:"conditions"`
+}
+
+// UnmarshalJSON accepts either the full object form or a bare array of
+// conditions, which are ANDed.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		*f = Filter{}
+		return json.Unmarshal(data, &f.Conditions)
+	}
+	type plain Filter
+	return json.Unmarshal(data, (*plain)(f))
+}
+
+// Validate reports unknown modes or operators before a search starts.
+func (f Filter) Validate() error {
+	if f.Mode != "" && f.Mode != "and" && f.Mode != "or" {
+		return fmt.Errorf("unknown filter mode %q", f.Mode)
+	}
+	for _, c := range f.Conditions {
+		if c.Field == "" {
+			return fmt.Errorf("filter condition missing field")
+		}
+		switch c.Op {
+		case "", OpEq, OpIn, OpContains, OpContainsAny:
+		case OpGt, OpGte, OpLt, OpLte:
+			if _, err := strconv.ParseFloat(string(c.Value), 64); err != nil {
+				return fmt.Errorf("filter op %q on field %q needs a numeric value", c.Op, c.Field)
+			}
+		default:
+			return fmt.Errorf("unknown filter op %q on field %q", c.Op, c.Field)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a record with metadata meta and tag lists tags
+// satisfies the filter.
+func (f Filter) Matches(meta map[string]string, tags map[string][]string) bool {
+	if len(f.Conditions) == 0 {
+		return true
+	}
+	// AND fails on the first miss; OR succeeds on the first hit.
+	or := f.Mode == "or"
+	for _, c := range f.Conditions {
+		if c.matches(meta, tags) == or {
+			return or
+		}
+	}
+	return !or
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func filterStore() *VectorStore {
+	store := NewVectorStore()
+	docs := []struct {
+		id, category, lang, status string
+	}{
+		{"news-en", "news", "en", "active"},
+		{"news-fr", "news", "fr", "pending"},
+		{"blog-en", "blog", "en", "archived"},
+		{"blog-de", "blog", "de", "active"},
+		{"wiki-en", "wiki", "en", "pending"},
+	}
+	for i, d := range docs {
+		vec := Vector{1, float32(i)}
+		store.AddItem(d.id, vec, map[string]string{"category": d.category, "lang": d.lang, "status": d.status}, "")
+	}
+	return store
+}
+
+func searchIDs(t *testing.T, store *VectorStore, f Filter) []string {
+	t.Helper()
+	results, err := store.SearchWithOptions(Vector{1, 1}, SearchOptions{K: 10, Filter: f})
+	if err != nil {
+		t.Fatalf("SearchWithOptions: %v", err)
+	}
+	ids := resultIDs(results)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestFilterCombinations(t *testing.T) {
+	store := filterStore()
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"none", Filter{}, []string{"blog-de", "blog-en", "news-en", "news-fr", "wiki-en"}},
+		{"and", Filter{Conditions: []Condition{
+			{Field: "category", Value: "news"},
+			{Field: "lang", Value: "en"},
+		}}, []string{"news-en"}},
+		{"or", Filter{Mode: "or", Conditions: []Condition{
+			{Field: "category", Value: "wiki"},
+			{Field: "lang", Value: "de"},
+		}}, []string{"blog-de", "wiki-en"}},
+		{"in", Filter{Conditions: []Condition{
+			{Field: "status", Op: OpIn, Values: []string{"active", "pending"}},
+			{Field: "lang", Value: "en"},
+		}}, []string{"news-en", "wiki-en"}},
+		{"missing field", Filter{Conditions: []Condition{
+			{Field: "author", Op: OpIn, Values: []string{""}},
+		}}, []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := searchIDs(t, store, tc.filter)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("got %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterValidateAndJSON(t *testing.T) {
+	store := filterStore()
+	if _, err := store.SearchWithOptions(Vector{1, 1}, SearchOptions{K: 1, Filter: Filter{Mode: "xor"}}); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+
+	var f Filter
+	if err := json.Unmarshal([]byte(`[{"field":"lang","value":"en"},{"field":"category","value":"blog"}]`), &f); err != nil {
+		t.Fatalf("array form: %v", err)
+	}
+	if got := searchIDs(t, store, f); len(got) != 1 || got[0] != "blog-en" {
+		t.Fatalf("array form matched %v", got)
+	}
+	if err := json.Unmarshal([]byte(`{"mode":"or","conditions":[{"field":"lang","value":"fr"}]}`), &f); err != nil || f.Mode != "or" {
+		t.Fatalf("object form: %+v, %v", f, err)
+	}
+}
+
+func TestNumericRangeFilters(t *testing.T) {
+	store := NewVectorStore()
+	prices := map[string]string{"cheap": "5", "mid": "10", "pricey": "49.5", "luxury": "120", "unknown": "n/a"}
+	i := 0
+	for id, price := range prices {
+		store.AddItem(id, Vector{1, float32(i)}, map[string]string{"price": price}, "")
+		i++
+	}
+	store.AddItem("unpriced", Vector{1, 9}, map[string]string{}, "")
+
+	var between Filter
+	if err := json.Unmarshal([]byte(`[{"field":"price","op":"gte","value":10},{"field":"price","op":"lte","value":50}]`), &between); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"gte and lte", between, []string{"mid", "pricey"}},
+		{"gt", Filter{Conditions: []Condition{{Field: "price", Op: OpGt, Value: "49.5"}}}, []string{"luxury"}},
+		{"lt", Filter{Conditions: []Condition{{Field: "price", Op: OpLt, Value: "10"}}}, []string{"cheap"}},
+		{"numeric eq", Filter{Conditions: []Condition{{Field: "price", Value: "10.0"}}}, []string{"mid"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := searchIDs(t, store, tc.filter)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("got %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+
+	bad := Filter{Conditions: []Condition{{Field: "price", Op: OpGt, Value: "ten"}}}
+	if _, err := store.SearchWithOptions(Vector{1, 1}, SearchOptions{K: 1, Filter: bad}); err == nil {
+		t.Fatal("non-numeric range bound accepted")
+	}
+}
+
+func TestTagFilters(t *testing.T) {
+	store := NewVectorStore()
+	for i, d := range []struct {
+		id   string
+		tags []string
+	}{
+		{"go", []string{"lang", "go"}},
+		{"rust", []string{"lang", "rust"}},
+		{"recipe", []string{"food"}},
+		{"untagged", nil},
+	} {
+		rec := Record{ID: d.id, Vector: Vector{1, float32(i)}, Metadata: map[string]string{"tags": "go"}}
+		if d.tags != nil {
+			rec.Tags = map[string][]string{"tags": d.tags}
+		}
+		store.AddRecord(rec)
+	}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"contains", Filter{Conditions: []Condition{{Field: "tags", Op: OpContains, Value: "lang"}}}, []string{"go", "rust"}},
+		{"contains_any", Filter{Conditions: []Condition{
+			{Field: "tags", Op: OpContainsAny, Values: []string{"rust", "food"}},
+		}}, []string{"recipe", "rust"}},
+		{"and metadata", Filter{Conditions: []Condition{
+			{Field: "tags", Op: OpContains, Value: "lang"},
+			{Field: "tags", Value: "go"},
+		}}, []string{"go", "rust"}},
+		{"or", Filter{Mode: "or", Conditions: []Condition{
+			{Field: "tags", Op: OpContains, Value: "go"},
+			{Field: "tags", Op: OpContains, Value: "food"},
+		}}, []string{"go", "recipe"}},
+		// A metadata string is not a tag list.
+		{"metadata value", Filter{Conditions: []Condition{{Field: "tags", Op: OpContains, Value: "go"}}}, []string{"go"}},
+		{"no values", Filter{Conditions: []Condition{{Field: "tags", Op: OpContainsAny}}}, []string{}},
+	}
+	check := func(store *VectorStore) {
+		t.Helper()
+		for _, tc := range cases {
+			if err := tc.filter.Validate(); err != nil {
+				t.Fatalf("%s: Validate: %v", tc.name, err)
+			}
+			got := searchIDs(t, store, tc.filter)
+			if len(got) != len(tc.want) {
+				t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+				}
+			}
+		}
+	}
+	check(store)
+
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	check(loaded)
+}
+
+func TestIDScope(t *testing.T) {
+	store := NewVectorStore()
+	for i, id := range []string{"user1:a", "user1:b", "user2:a", "user2:b", "other"} {
+		ns := ""
+		if i%2 == 1 {
+			ns = "odd"
+		}
+		store.AddItem(id, Vector{1, float32(i)}, map[string]string{"n": fmt.Sprint(i)}, ns)
+	}
+
+	cases := []struct {
+		name string
+		opts SearchOptions
+		want []string
+	}{
+		{"prefix", SearchOptions{IDPrefix: "user1:"}, []string{"user1:a", "user1:b"}},
+		{"set", SearchOptions{IDs: []string{"user2:b", "other", "missing", "other"}}, []string{"other", "user2:b"}},
+		{"set and prefix", SearchOptions{IDPrefix: "user2:", IDs: []string{"user2:b", "other"}}, []string{"user2:b"}},
+		{"set and namespace", SearchOptions{Namespace: "odd", IDs: []string{"user1:a", "user1:b"}}, []string{"user1:b"}},
+		{"set and filter", SearchOptions{IDs: []string{"user1:a", "user1:b"}, Filter: Filter{Conditions: []Condition{{Field: "n", Value: "0"}}}}, []string{"user1:a"}},
+		{"empty set", SearchOptions{IDs: []string{}}, []string{}},
+	}
+	check := func() {
+		t.Helper()
+		for _, tc := range cases {
+			tc.opts.K = 10
+			results, err := store.SearchWithOptions(Vector{1, 1}, tc.opts)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			got := resultIDs(results)
+			sort.Strings(got)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			}
+		}
+	}
+	check()
+	store.BuildHNSW(8, 32)
+	check()
+}
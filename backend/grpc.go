@@ -0,0 +1,181 @@
+package main
+
+//go:generate protoc -I proto --go_out=. --go_opt=module=my-vector-db-v1 --go-grpc_out=. --go-grpc_opt=module=my-vector-db-v1 vectordb.proto
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+
+	pb "my-vector-db-v1/vectordbpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the VectorDB service (proto/vectordb.proto) over
+// the same package-level store and embedder as the REST handlers. Vectors
+// travel as packed floats, which avoids JSON's cost for bulk payloads.
+type grpcServer struct {
+	pb.UnimplementedVectorDBServer
+}
+
+// startGRPC serves the gRPC API on addr in the background.
+func startGRPC(addr string) (*grpc.Server, net.Listener, error) {
+	ln, err := listen(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv := newGRPCServer()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Fatalf("grpc serve: %v", err)
+		}
+	}()
+	return srv, ln, nil
+}
+
+// newGRPCServer registers the service behind the API key check.
+func newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := grpcAuth(ctx, cfg.APIKeys); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := grpcAuth(ss.Context(), cfg.APIKeys); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	pb.RegisterVectorDBServer(srv, &grpcServer{})
+	return srv
+}
+
+// grpcAuth applies the HTTP API's bearer-key check to the "authorization"
+// request metadata.
+func grpcAuth(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if key, ok := strings.CutPrefix(v, "Bearer "); ok && validAPIKey(keys, key) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid API key")
+}
+
+// embedOrVector returns vec when the caller supplied one and embeds text
+// otherwise.
+func embedOrVector(ctx context.Context, text string, vec []float32) (Vector, error) {
+	if len(vec) > 0 {
+		return Vector(vec), nil
+	}
+	out, err := embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "embedding: %v", err)
+	}
+	return Vector(out), nil
+}
+
+func (s *grpcServer) Add(ctx context.Context, req *pb.AddRequest) (*pb.AddResponse, error) {
+	countOp("add")
+	vec, err := embedOrVector(ctx, req.Text, req.Vector)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := storeNamespace(req.Namespace)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	meta := req.Metadata
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	if req.Text != "" {
+		meta["text"] = req.Text
+	}
+	if err := db.AddItem(req.Id, vec, meta, ns); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pending.remove(req.Id)
+	return &pb.AddResponse{Total: int64(db.Len())}, nil
+}
+
+func (s *grpcServer) Query(req *pb.QueryRequest, stream grpc.ServerStreamingServer[pb.QueryResult]) error {
+	countOp("query")
+	k := int(req.K)
+	if k == 0 {
+		k = 5
+	}
+	if k < 0 {
+		return status.Error(codes.InvalidArgument, "k must be positive")
+	}
+	if cfg.MaxK > 0 && k > cfg.MaxK {
+		return status.Errorf(codes.InvalidArgument, "k must be at most %d", cfg.MaxK)
+	}
+	if err := checkNamespace(req.Namespace); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	query, err := embedOrVector(stream.Context(), req.Text, req.Vector)
+	if err != nil {
+		return err
+	}
+
+	opts := SearchOptions{K: k, Namespace: req.Namespace, MinScore: req.MinScore}
+	if f := req.Filters; f != nil {
+		opts.Filter.Mode = f.Mode
+		for _, c := range f.Conditions {
+			opts.Filter.Conditions = append(opts.Filter.Conditions, Condition{
+				Field: c.Field, Op: c.Op, Value: FilterValue(c.Value), Values: c.Values,
+			})
+		}
+	}
+	results, err := db.SearchDetailedContext(stream.Context(), query, opts)
+	if ctxErr := stream.Context().Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	for _, res := range results {
+		err := stream.Send(&pb.QueryResult{
+			Id: res.ID, Score: res.Score, Distance: res.Distance, Metadata: res.Metadata,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	countOp("delete")
+	if queued := pending.remove(req.Id); !db.DeleteItem(req.Id) && !queued {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &pb.DeleteResponse{Total: int64(db.Len())}, nil
+}
+
+func (s *grpcServer) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	stats := db.Stats()
+	out := &pb.StatsResponse{
+		Total:       int64(stats.Total),
+		Namespaces:  make(map[string]int64, len(stats.Namespaces)),
+		Dim:         int64(stats.Dim),
+		MemoryBytes: int64(stats.MemoryBytes),
+	}
+	for ns, n := range stats.Namespaces {
+		out.Namespaces[ns] = int64(n)
+	}
+	return out, nil
+}
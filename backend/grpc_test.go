@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	pb "my-vector-db-v1/vectordbpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcClient serves the gRPC API in-process over an in-memory listener.
+func grpcClient(t *testing.T) pb.VectorDBClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	srv := newGRPCServer()
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewVectorDBClient(conn)
+}
+
+func collect(t *testing.T, stream grpc.ServerStreamingClient[pb.QueryResult]) ([]*pb.QueryResult, error) {
+	t.Helper()
+	var out []*pb.QueryResult
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, res)
+	}
+}
+
+func TestGRPCRoundTrip(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{0, 0, 1})
+	client := grpcClient(t)
+	ctx := context.Background()
+
+	adds := []*pb.AddRequest{
+		{Id: "a", Vector: []float32{1, 0, 0}, Namespace: "docs", Metadata: map[string]string{"lang": "en"}},
+		{Id: "b", Vector: []float32{0, 1, 0}, Namespace: "docs", Metadata: map[string]string{"lang": "fr"}},
+		{Id: "c", Text: "embedded server-side", Namespace: "notes"},
+	}
+	for _, req := range adds {
+		if _, err := client.Add(ctx, req); err != nil {
+			t.Fatalf("Add %s: %v", req.Id, err)
+		}
+	}
+
+	stream, err := client.Query(ctx, &pb.QueryRequest{Vector: []float32{1, 0.1, 0}, K: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := collect(t, stream)
+	if err != nil || len(results) != 2 || results[0].Id != "a" || results[1].Id != "b" {
+		t.Fatalf("query: %v, %v", results, err)
+	}
+	if results[0].Metadata["lang"] != "en" || results[0].Distance == nil {
+		t.Fatalf("result missing metadata or distance: %v", results[0])
+	}
+
+	// Text queries go through the embedder, and filters apply as in REST.
+	stream, _ = client.Query(ctx, &pb.QueryRequest{Text: "anything", K: 1})
+	results, _ = collect(t, stream)
+	if len(results) != 1 || results[0].Id != "c" || math.Abs(float64(results[0].Score)-1) > 1e-5 {
+		t.Fatalf("text query: %v", results)
+	}
+	stream, _ = client.Query(ctx, &pb.QueryRequest{
+		Vector:  []float32{1, 0, 0},
+		Filters: &pb.Filter{Conditions: []*pb.Condition{{Field: "lang", Value: "fr"}}},
+	})
+	results, _ = collect(t, stream)
+	if len(results) != 1 || results[0].Id != "b" {
+		t.Fatalf("filtered query: %v", results)
+	}
+
+	stats, err := client.Stats(ctx, &pb.StatsRequest{})
+	if err != nil || stats.Total != 3 || stats.Namespaces["docs"] != 2 || stats.Dim != 3 {
+		t.Fatalf("stats: %v, %v", stats, err)
+	}
+
+	if _, err := client.Delete(ctx, &pb.DeleteRequest{Id: "a"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := client.Delete(ctx, &pb.DeleteRequest{Id: "a"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("second Delete: got %v, want NotFound", err)
+	}
+}
+
+func TestGRPCInvalidArguments(t *testing.T) {
+	useStore(t, NewVectorStore())
+	client := grpcClient(t)
+	ctx := context.Background()
+	client.Add(ctx, &pb.AddRequest{Id: "a", Vector: []float32{1, 0}})
+
+	if _, err := client.Add(ctx, &pb.AddRequest{Id: "b", Vector: []float32{1, 0, 0}}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("wrong-dimension Add: got %v", err)
+	}
+	for _, req := range []*pb.QueryRequest{
+		{Vector: []float32{1, 0}, K: -1},
+		{Vector: []float32{1, 0, 0}},
+	} {
+		stream, err := client.Query(ctx, req)
+		if err == nil {
+			_, err = collect(t, stream)
+		}
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Query(%v): got %v, want InvalidArgument", req, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness gates /ready: the snapshot must be loaded and, unless skipped,
+// the embedding backend must answer. Backend checks are cached for
+// CheckTTL so probes don't hammer it.
+type Readiness struct {
+	loaded atomic.Bool
+
+	SkipEmbedding bool
+	CheckTTL      time.Duration
+	Check         func() error
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+}
+
+func newReadiness() *Readiness {
+	return &Readiness{
+		CheckTTL: 5 * time.Second,
+		Check: func() error {
+			_, err := embedder.Embed(context.Background(), "readiness probe")
+			return err
+		},
+	}
+}
+
+// MarkLoaded records that the initial Load has finished.
+func (r *Readiness) MarkLoaded() { r.loaded.Store(true) }
+
+// Ready reports nil once the server can take traffic, or the reason it
+// cannot.
+func (r *Readiness) Ready() error {
+	if !r.loaded.Load() {
+		return errNotLoaded
+	}
+	if r.SkipEmbedding || r.Check == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.checkedAt.IsZero() || time.Since(r.checkedAt) >= r.CheckTTL {
+		r.lastErr = r.Check()
+		r.checkedAt = time.Now()
+	}
+	return r.lastErr
+}
+
+var errNotLoaded = errors.New("store not loaded")
+
+// diagEmbedTimeout bounds the /diag/embedding probe, well below the
+// embedder's own timeout so a hung backend shows up quickly.
+const diagEmbedTimeout = 5 * time.Second
+
+// diagEmbedding answers GET /diag/embedding: it embeds a fixed string and
+// reports how long that took and the dimension returned, or the error,
+// alongside the configured backend. Unlike /ready it always calls out, so
+// it goes around the embedding cache, and it leaves the readiness check's
+// cached result alone.
+func diagEmbedding(c *gin.Context) {
+	e := embedder
+	if cached, ok := e.(*CachingEmbedder); ok {
+		e = cached.next
+	}
+	diag := gin.H{"provider": cfg.EmbedProvider, "model": cfg.EmbedModel, "url": cfg.embedURL()}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), diagEmbedTimeout)
+	defer cancel()
+	start := time.Now()
+	vec, err := e.Embed(ctx, "embedding diagnostic")
+	diag["latency_ms"] = time.Since(start).Milliseconds()
+	if err != nil {
+		status, resp := errorResponse(502, fmt.Errorf("%w: %w", ErrEmbedding, err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			status, resp = errorResponse(504, errors.New("timed out after "+diagEmbedTimeout.String()))
+		}
+		maps.Copy(resp, diag)
+		resp["status"] = "error"
+		c.JSON(status, resp)
+		return
+	}
+	diag["status"], diag["dim"] = "ok", len(vec)
+	c.JSON(200, diag)
+}
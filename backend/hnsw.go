@@ -0,0 +1,280 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswCandidate pairs a graph node with its distance to the query. Inside
+// the graph smaller is always closer; similarity metrics are negated.
+type hnswCandidate struct {
+	node int32
+	dist float32
+}
+
+// candidateHeap is a min-heap of candidates by distance, or a max-heap
+// when max is set.
+type candidateHeap struct {
+	items []hnswCandidate
+	max   bool
+}
+
+func (h candidateHeap) Len() int { return len(h.items) }
+func (h candidateHeap) Less(i, j int) bool {
+	if h.max {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+func (h candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x any)   { h.items = append(h.items, x.(hnswCandidate)) }
+func (h *candidateHeap) Pop() any {
+	old := h.items
+	n := len(old)
+	x := old[n-1]
+	h.items = old[0 : n-1]
+	return x
+}
+
+type hnswNode struct {
+	id  string
+	vec Vector
+	// friends holds the neighbor list for each layer the node lives on;
+	// layer 0 is the densest.
+	friends [][]int32
+	deleted bool
+}
+
+// HNSW is a Hierarchical Navigable Small World graph (Malkov & Yashunin)
+// layered over the store's records. Nodes are never physically removed:
+// deletes and overwrites tombstone the old node, which keeps routing
+// searches but is never returned.
+type HNSW struct {
+	M              int
+	EfConstruction int
+	// EfSearch is the candidate list size at query time; raised to k
+	// when smaller.
+	EfSearch int
+
+	metric    Metric
+	levelMult float64
+	nodes     []hnswNode
+	byID      map[string]int32
+	entry     int32
+	maxLevel  int
+	rng       *rand.Rand
+}
+
+func newHNSW(metric Metric, m, efConstruction int) *HNSW {
+	m = max(m, 2)
+	efConstruction = max(efConstruction, m)
+	return &HNSW{
+		M:              m,
+		EfConstruction: efConstruction,
+		EfSearch:       max(efConstruction, 64),
+		metric:         metric,
+		levelMult:      1 / math.Log(float64(m)),
+		byID:           make(map[string]int32),
+		entry:          -1,
+		// Fixed seed so the same inserts always build the same graph.
+		rng: rand.New(rand.NewSource(1)),
+	}
+}
+
+// BuildHNSW indexes every record in an HNSW graph with M links per node
+// (2*M on the base layer). Once built, Search uses the graph and AddItem
+// and DeleteItem keep it up to date.
+func (vs *VectorStore) BuildHNSW(M, efConstruction int) {
+	vs.Lock()
+	defer vs.Unlock()
+
+	h := newHNSW(vs.Metric, M, efConstruction)
+	for i := range vs.Records {
+		if !vs.Records[i].Deleted {
+			h.insert(vs.Records[i].ID, vs.Records[i].dense())
+		}
+	}
+	vs.hnsw = h
+}
+
+// dist is the graph's internal distance: squared L2, which orders like L2
+// but skips the sqrt, a negated similarity (the cosine under
+// MetricAngular, which orders the same), or a custom metric's score,
+// negated if it is a similarity.
+func (h *HNSW) dist(a, b Vector) float32 {
+	if h.metric == MetricL2 {
+		return SquaredEuclidean(a, b)
+	}
+	if c, ok := h.metric.custom(); ok {
+		if c.higherIsBetter {
+			return -c.score(a, b)
+		}
+		return c.score(a, b)
+	}
+	return -DotProduct(a, b)
+}
+
+// score converts an internal distance back to the store's score scale.
+func (h *HNSW) score(dist float32) float32 {
+	if h.metric == MetricL2 {
+		return float32(math.Sqrt(float64(dist)))
+	}
+	if h.metric == MetricAngular {
+		return AngularDistance(-dist)
+	}
+	if !h.metric.HigherIsBetter() {
+		return dist
+	}
+	return -dist
+}
+
+func (h *HNSW) insert(id string, vec Vector) {
+	h.remove(id)
+
+	level := int(-math.Log(1-h.rng.Float64()) * h.levelMult)
+	n := int32(len(h.nodes))
+	h.nodes = append(h.nodes, hnswNode{id: id, vec: vec, friends: make([][]int32, level+1)})
+	h.byID[id] = n
+	if h.entry < 0 {
+		h.entry, h.maxLevel = n, level
+		return
+	}
+
+	ep := h.entry
+	epDist := h.dist(vec, h.nodes[ep].vec)
+	for lc := h.maxLevel; lc > level; lc-- {
+		ep, epDist = h.greedy(vec, ep, epDist, lc)
+	}
+	for lc := min(level, h.maxLevel); lc >= 0; lc-- {
+		found := h.searchLayer(vec, ep, epDist, h.EfConstruction, lc, nil)
+		for _, nb := range found[:min(h.M, len(found))] {
+			h.nodes[n].friends[lc] = append(h.nodes[n].friends[lc], nb.node)
+			h.link(nb.node, n, lc)
+		}
+		ep, epDist = found[0].node, found[0].dist
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = n, level
+	}
+}
+
+// link adds to as a neighbor of from, pruning from's list back to its
+// closest neighbors when it overflows.
+func (h *HNSW) link(from, to int32, layer int) {
+	node := &h.nodes[from]
+	node.friends[layer] = append(node.friends[layer], to)
+
+	limit := h.M
+	if layer == 0 {
+		limit = 2 * h.M
+	}
+	if len(node.friends[layer]) <= limit {
+		return
+	}
+	cands := make([]hnswCandidate, len(node.friends[layer]))
+	for i, f := range node.friends[layer] {
+		cands[i] = hnswCandidate{node: f, dist: h.dist(node.vec, h.nodes[f].vec)}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].dist < cands[j].dist })
+	node.friends[layer] = node.friends[layer][:0]
+	for _, c := range cands[:limit] {
+		node.friends[layer] = append(node.friends[layer], c.node)
+	}
+}
+
+func (h *HNSW) remove(id string) {
+	if n, ok := h.byID[id]; ok {
+		h.nodes[n].deleted = true
+		delete(h.byID, id)
+	}
+}
+
+// greedy walks a single layer towards q, returning the closest node found.
+func (h *HNSW) greedy(q Vector, ep int32, epDist float32, layer int) (int32, float32) {
+	for changed := true; changed; {
+		changed = false
+		for _, f := range h.nodes[ep].friends[layer] {
+			if d := h.dist(q, h.nodes[f].vec); d < epDist {
+				ep, epDist, changed = f, d, true
+			}
+		}
+	}
+	return ep, epDist
+}
+
+// searchLayer is a best-first beam search of width ef on one layer. Every
+// reachable node guides the walk, but only nodes passing accept (all
+// nodes when nil) enter the result set. Results are returned closest first.
+func (h *HNSW) searchLayer(q Vector, ep int32, epDist float32, ef, layer int, accept func(int32) bool) []hnswCandidate {
+	visited := map[int32]struct{}{ep: {}}
+	cands := &candidateHeap{}
+	heap.Push(cands, hnswCandidate{node: ep, dist: epDist})
+	found := &candidateHeap{max: true}
+	if accept == nil || accept(ep) {
+		heap.Push(found, hnswCandidate{node: ep, dist: epDist})
+	}
+
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(hnswCandidate)
+		if found.Len() >= ef && c.dist > found.items[0].dist {
+			break
+		}
+		for _, f := range h.nodes[c.node].friends[layer] {
+			if _, seen := visited[f]; seen {
+				continue
+			}
+			visited[f] = struct{}{}
+			d := h.dist(q, h.nodes[f].vec)
+			if found.Len() < ef || d < found.items[0].dist {
+				heap.Push(cands, hnswCandidate{node: f, dist: d})
+				if accept == nil || accept(f) {
+					heap.Push(found, hnswCandidate{node: f, dist: d})
+					if found.Len() > ef {
+						heap.Pop(found)
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]hnswCandidate, found.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(found).(hnswCandidate)
+	}
+	return out
+}
+
+// search returns up to k live records passing match and ranking behind
+// after, if set, best first, from a candidate list of at least EfSearch
+// and candidates nodes.
+func (h *HNSW) search(vs *VectorStore, q Vector, k, candidates int, match func(*Record) bool, after *SearchResult) []SearchResult {
+	if h.entry < 0 || k <= 0 {
+		return nil
+	}
+
+	ep := h.entry
+	epDist := h.dist(q, h.nodes[ep].vec)
+	for lc := h.maxLevel; lc > 0; lc-- {
+		ep, epDist = h.greedy(q, ep, epDist, lc)
+	}
+
+	accept := func(n int32) bool {
+		node := &h.nodes[n]
+		if node.deleted {
+			return false
+		}
+		idx, ok := vs.IDMap[node.id]
+		return ok && match(&vs.Records[idx])
+	}
+	found := h.searchLayer(q, ep, epDist, max(h.EfSearch, k, candidates), 0, accept)
+
+	// Rank through a ResultHeap so ties break by ID as in the scan.
+	top := NewResultHeap(vs.Metric.HigherIsBetter())
+	top.After = after
+	for _, c := range found {
+		top.Offer(SearchResult{ID: h.nodes[c.node].id, Score: h.score(c.dist)}, k)
+	}
+	return top.Drain()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestHNSWRecallAgainstBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	indexed, exact := NewVectorStore(), NewVectorStore()
+	for i, v := range randomVectors(rng, 3000, 32) {
+		id := fmt.Sprintf("id-%d", i)
+		indexed.AddItem(id, v, nil, "")
+		exact.AddItem(id, v, nil, "")
+	}
+	indexed.BuildHNSW(16, 100)
+
+	const k = 10
+	var recall float64
+	queries := randomVectors(rng, 50, 32)
+	for _, q := range queries {
+		recall += overlap(mustSearch(t, indexed, q, k), mustSearch(t, exact, q, k))
+	}
+	recall /= float64(len(queries))
+	if recall < 0.9 {
+		t.Fatalf("recall@%d = %.3f, want >= 0.9", k, recall)
+	}
+}
+
+func TestHNSWTracksInsertsAndDeletes(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("x", Vector{1, 0, 0}, nil, "")
+	store.AddItem("y", Vector{0, 1, 0}, nil, "")
+	store.BuildHNSW(4, 16)
+
+	store.AddItem("z", Vector{0, 0, 1}, nil, "")
+	assertIDs(t, mustSearch(t, store, Vector{0, 0.1, 1}, 1), "z")
+
+	store.DeleteItem("z")
+	assertIDs(t, mustSearch(t, store, Vector{0, 0.1, 1}, 1), "y")
+
+	// Overwriting an ID moves it in the graph rather than duplicating it.
+	store.AddItem("x", Vector{0, 0.2, 1}, nil, "")
+	assertIDs(t, mustSearch(t, store, Vector{0, 0.1, 1}, 2), "x", "y")
+}
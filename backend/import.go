@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bulk import. POST /import takes JSONL, one importLine per line, or CSV
+// with a header row naming id, text and optionally namespace; any other
+// CSV column becomes metadata. The body is either the raw data or a
+// multipart upload in a part named "file", and is parsed as it streams in.
+// The format comes from ?format=csv|jsonl, else the content type or file
+// name, else JSONL.
+//
+// A JSONL line that carries a vector or a sparse vector, as GET /export
+// writes, is stored as given and its text, if any, is not embedded.
+
+const (
+	// importBatchSize is how many parsed lines are embedded and stored
+	// per store lock.
+	importBatchSize = 100
+	// importMaxLine bounds a single JSONL line.
+	importMaxLine = 1 << 20
+	// importMaxErrors caps the per-record errors kept for the summary.
+	importMaxErrors = 100
+)
+
+// errMalformed marks an input line that could not be parsed.
+var errMalformed = errors.New("malformed line")
+
+// importSummary is the result of an import, also sent as progress.
+type importSummary struct {
+	Imported  int         `json:"imported"`
+	Malformed int         `json:"malformed"`
+	Failed    int         `json:"failed"`
+	Errors    []itemError `json:"errors"`
+}
+
+// importLine is one JSONL import record. ExpiresAt, as exported, takes
+// precedence over TTL.
+type importLine struct {
+	AddRequest
+	Vector    Vector        `json:"vector,omitempty"`
+	Sparse    *SparseVector `json:"sparse,omitempty"`
+	ExpiresAt time.Time     `json:"expires_at,omitzero"`
+}
+
+// importReader yields one record per call and io.EOF at the end.
+type importReader interface {
+	next() (importLine, error)
+}
+
+type jsonlReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), importMaxLine)
+	return &jsonlReader{sc: sc}
+}
+
+func (r *jsonlReader) next() (importLine, error) {
+	for r.sc.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.sc.Text())
+		if line == "" {
+			continue
+		}
+		var item importLine
+		if err := json.Unmarshal([]byte(line), &item); err != nil || item.ID == "" || (item.Text == "" && len(item.Vector) == 0 && item.Sparse == nil) {
+			return importLine{}, fmt.Errorf("%w %d", errMalformed, r.line)
+		}
+		return item, nil
+	}
+	if err := r.sc.Err(); err != nil {
+		return importLine{}, err
+	}
+	return importLine{}, io.EOF
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	if !slices.Contains(header, "id") || !slices.Contains(header, "text") {
+		return nil, errors.New("CSV header must name id and text columns")
+	}
+	return &csvReader{r: cr, header: header}, nil
+}
+
+func (r *csvReader) next() (importLine, error) {
+	row, err := r.r.Read()
+	if err == io.EOF {
+		return importLine{}, io.EOF
+	}
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		return importLine{}, fmt.Errorf("%w %d", errMalformed, pe.Line)
+	}
+	if err != nil {
+		return importLine{}, err
+	}
+	// FieldPos is only valid after a successful Read.
+	line, _ := r.r.FieldPos(0)
+	if len(row) != len(r.header) {
+		return importLine{}, fmt.Errorf("%w %d", errMalformed, line)
+	}
+	req := AddRequest{Metadata: make(map[string]string)}
+	for i, col := range r.header {
+		switch col {
+		case "id":
+			req.ID = row[i]
+		case "text":
+			req.Text = row[i]
+		case "namespace":
+			req.Namespace = row[i]
+		default:
+			req.Metadata[col] = row[i]
+		}
+	}
+	if req.ID == "" || req.Text == "" {
+		return importLine{}, fmt.Errorf("%w %d", errMalformed, line)
+	}
+	return importLine{AddRequest: req}, nil
+}
+
+// importBody finds the upload in the request and picks its format.
+func importBody(c *gin.Context) (io.Reader, string, error) {
+	format := c.Query("format")
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if format == "" && mediaType == "text/csv" {
+			format = "csv"
+		}
+		return c.Request.Body, format, nil
+	}
+
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", errors.New(`multipart upload has no "file" part`)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		if format == "" && (strings.HasSuffix(part.FileName(), ".csv") || part.Header.Get("Content-Type") == "text/csv") {
+			format = "csv"
+		}
+		return part, format, nil
+	}
+}
+
+func importHandler(c *gin.Context) {
+	countOp("import")
+	body, format, err := importBody(c)
+	if err != nil {
+		c.JSON(errorResponse(400, err))
+		return
+	}
+	var src importReader
+	switch format {
+	case "", "jsonl":
+		src = newJSONLReader(body)
+	case "csv":
+		if src, err = newCSVReader(body); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+	default:
+		c.JSON(errorResponse(400, fmt.Errorf("unknown import format %q", format)))
+		return
+	}
+
+	stream := c.Query("stream") == "true"
+	if stream {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	var sum importSummary
+	sum.Errors = []itemError{}
+	var texts []AddRequest
+	var vectors []Record
+	flush := func() {
+		added, failures := addBatch(c.Request.Context(), texts, vectors)
+		sum.Imported += added
+		sum.Failed += len(failures)
+		for _, f := range failures {
+			if len(sum.Errors) < importMaxErrors {
+				sum.Errors = append(sum.Errors, f)
+			}
+		}
+		texts, vectors = texts[:0], vectors[:0]
+		if stream {
+			c.SSEvent("progress", sum)
+			c.Writer.Flush()
+		}
+	}
+
+	for {
+		item, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errMalformed) {
+			sum.Malformed++
+			continue
+		}
+		if err != nil {
+			// The body itself failed, e.g. a line over importMaxLine or a
+			// dropped connection; report what was imported so far.
+			flush()
+			status, body := errorResponse(400, err)
+			body["summary"] = sum
+			if stream {
+				c.SSEvent("error", body)
+				return
+			}
+			c.JSON(status, body)
+			return
+		}
+		if err := item.normalize(); err != nil {
+			sum.Failed++
+			if len(sum.Errors) < importMaxErrors {
+				sum.Errors = append(sum.Errors, itemError{ID: item.ID, Error: err.Error()})
+			}
+			continue
+		}
+		if len(item.Vector) > 0 || item.Sparse != nil {
+			rec := Record{ID: item.ID, Vector: item.Vector, Sparse: item.Sparse, Metadata: item.Metadata, Tags: item.Tags, Namespace: item.Namespace, ExpiresAt: item.ExpiresAt}
+			if rec.ExpiresAt.IsZero() && item.TTL > 0 {
+				rec.ExpiresAt = time.Now().Add(time.Duration(item.TTL) * time.Second)
+			}
+			vectors = append(vectors, rec)
+		} else {
+			texts = append(texts, item.AddRequest)
+		}
+		if len(texts)+len(vectors) == importBatchSize {
+			flush()
+		}
+	}
+	if len(texts)+len(vectors) > 0 {
+		flush()
+	}
+
+	if stream {
+		c.SSEvent("summary", sum)
+		return
+	}
+	c.JSON(200, sum)
+}
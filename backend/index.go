@@ -0,0 +1,216 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+)
+
+// Secondary indices over vs.Records. All helpers expect the write lock,
+// except filterCandidates, which only reads.
+//
+// nsIndex maps each namespace to the positions of its records, so a
+// namespaced search only visits that namespace. nsPos[i] is the offset of
+// record i inside its namespace's list, which makes removal O(1).
+
+// rebuildIndexesLocked recomputes IDMap, the namespace index and the
+// metadata index from scratch, e.g. after Load or a bulk removal.
+func (vs *VectorStore) rebuildIndexesLocked() {
+	vs.IDMap = make(map[string]int, len(vs.Records))
+	vs.nsIndex = make(map[string][]int)
+	vs.nsPos = make([]int, len(vs.Records))
+	for key := range vs.metaIndex {
+		vs.metaIndex[key] = make(map[string][]int)
+	}
+	for i := range vs.Records {
+		vs.IDMap[vs.Records[i].ID] = i
+		ns := vs.Records[i].Namespace
+		vs.nsPos[i] = len(vs.nsIndex[ns])
+		vs.nsIndex[ns] = append(vs.nsIndex[ns], i)
+		vs.indexMetadata(i)
+	}
+}
+
+// indexNamespace adds record idx to its namespace list.
+func (vs *VectorStore) indexNamespace(idx int) {
+	ns := vs.Records[idx].Namespace
+	for len(vs.nsPos) <= idx {
+		vs.nsPos = append(vs.nsPos, 0)
+	}
+	vs.nsPos[idx] = len(vs.nsIndex[ns])
+	vs.nsIndex[ns] = append(vs.nsIndex[ns], idx)
+}
+
+// unindexNamespace removes record idx from its namespace list by moving
+// the list's tail into its slot.
+func (vs *VectorStore) unindexNamespace(idx int) {
+	ns := vs.Records[idx].Namespace
+	list := vs.nsIndex[ns]
+	pos := vs.nsPos[idx]
+	tail := list[len(list)-1]
+	list[pos] = tail
+	vs.nsPos[tail] = pos
+	if len(list) == 1 {
+		delete(vs.nsIndex, ns)
+	} else {
+		vs.nsIndex[ns] = list[:len(list)-1]
+	}
+}
+
+// moveNamespaceEntry repoints the index after record from was copied to
+// slot to.
+func (vs *VectorStore) moveNamespaceEntry(from, to int) {
+	pos := vs.nsPos[from]
+	vs.nsIndex[vs.Records[to].Namespace][pos] = to
+	vs.nsPos[to] = pos
+}
+
+// metaIndex maps each declared metadata key to its values' record
+// positions, so an equality filter on the key only visits the records
+// holding the value. Values are indexed in metaIndexValue's canonical
+// form, which makes a posting list a superset of the records a condition
+// matches; the filter is still applied to every candidate.
+
+// AddIndexedKey maintains an inverted index on the metadata key from now
+// on, building it from the current records. Searches whose filter has an
+// eq or in condition on the key then visit only the records holding the
+// value. Each update to an indexed record walks its value's posting list,
+// so index selective keys such as user IDs rather than ones that split
+// the store into a few large groups.
+func (vs *VectorStore) AddIndexedKey(key string) {
+	vs.Lock()
+	defer vs.Unlock()
+
+	if _, ok := vs.metaIndex[key]; ok {
+		return
+	}
+	if vs.metaIndex == nil {
+		vs.metaIndex = make(map[string]map[string][]int)
+	}
+	postings := make(map[string][]int)
+	for i := range vs.Records {
+		if val, ok := vs.Records[i].Metadata[key]; ok {
+			v := metaIndexValue(val)
+			postings[v] = append(postings[v], i)
+		}
+	}
+	vs.metaIndex[key] = postings
+}
+
+// metaIndexValue canonicalizes val so values an eq condition considers
+// equal, such as "10" and "10.0", share a posting list.
+func metaIndexValue(val string) string {
+	x, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return val
+	}
+	if x == 0 {
+		x = 0 // -0 == 0
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// indexMetadata adds record idx to the posting lists of its indexed keys.
+func (vs *VectorStore) indexMetadata(idx int) {
+	for key, postings := range vs.metaIndex {
+		if val, ok := vs.Records[idx].Metadata[key]; ok {
+			v := metaIndexValue(val)
+			postings[v] = append(postings[v], idx)
+		}
+	}
+}
+
+// unindexMetadata removes record idx from its posting lists.
+func (vs *VectorStore) unindexMetadata(idx int) {
+	for key, postings := range vs.metaIndex {
+		val, ok := vs.Records[idx].Metadata[key]
+		if !ok {
+			continue
+		}
+		v := metaIndexValue(val)
+		list := postings[v]
+		if pos := slices.Index(list, idx); pos >= 0 {
+			list[pos] = list[len(list)-1]
+			list = list[:len(list)-1]
+		}
+		if len(list) == 0 {
+			delete(postings, v)
+		} else {
+			postings[v] = list
+		}
+	}
+}
+
+// moveMetadataEntry repoints the posting lists after record from was
+// copied to slot to.
+func (vs *VectorStore) moveMetadataEntry(from, to int) {
+	for key, postings := range vs.metaIndex {
+		if val, ok := vs.Records[to].Metadata[key]; ok {
+			list := postings[metaIndexValue(val)]
+			if pos := slices.Index(list, from); pos >= 0 {
+				list[pos] = to
+			}
+		}
+	}
+}
+
+// filterCandidates returns the positions of every record that can match
+// filter according to the metadata index, never nil, or false when no
+// indexed key narrows it. An AND filter uses its most selective indexed
+// condition; an OR filter needs every condition indexed.
+func (vs *VectorStore) filterCandidates(filter Filter) ([]int, bool) {
+	if len(vs.metaIndex) == 0 || len(filter.Conditions) == 0 {
+		return nil, false
+	}
+	lookup := func(c Condition) ([]int, bool) {
+		postings, ok := vs.metaIndex[c.Field]
+		if !ok {
+			return nil, false
+		}
+		switch c.Op {
+		case "", OpEq:
+			if c.Value == "" {
+				// A record without the key matches too, and is in no
+				// posting list.
+				return nil, false
+			}
+			return postings[metaIndexValue(string(c.Value))], true
+		case OpIn:
+			var out []int
+			seen := make(map[string]bool, len(c.Values))
+			for _, val := range c.Values {
+				if v := metaIndexValue(val); !seen[v] {
+					seen[v] = true
+					out = append(out, postings[v]...)
+				}
+			}
+			return out, true
+		}
+		return nil, false
+	}
+
+	var best []int
+	found := false
+	if filter.Mode == "or" {
+		for _, c := range filter.Conditions {
+			list, ok := lookup(c)
+			if !ok {
+				return nil, false
+			}
+			best = append(best, list...)
+		}
+		// A record matching several conditions is listed once per match.
+		slices.Sort(best)
+		best, found = slices.Compact(best), true
+	} else {
+		for _, c := range filter.Conditions {
+			if list, ok := lookup(c); ok && (!found || len(list) < len(best)) {
+				best, found = list, true
+			}
+		}
+	}
+	if found && best == nil {
+		// A nil subset would mean every record.
+		best = []int{}
+	}
+	return best, found
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// checkIndexes verifies IDMap and the namespace index against Records.
+func checkIndexes(t *testing.T, vs *VectorStore) {
+	t.Helper()
+	if len(vs.IDMap) != len(vs.Records) {
+		t.Fatalf("IDMap has %d entries for %d records", len(vs.IDMap), len(vs.Records))
+	}
+	for id, idx := range vs.IDMap {
+		if vs.Records[idx].ID != id {
+			t.Fatalf("IDMap[%s] = %d holds %s", id, idx, vs.Records[idx].ID)
+		}
+	}
+	indexed := 0
+	for ns, list := range vs.nsIndex {
+		for pos, idx := range list {
+			if vs.Records[idx].Namespace != ns || vs.nsPos[idx] != pos {
+				t.Fatalf("nsIndex[%q][%d] = %d is inconsistent", ns, pos, idx)
+			}
+		}
+		indexed += len(list)
+	}
+	if indexed != len(vs.Records) {
+		t.Fatalf("namespace index covers %d of %d records", indexed, len(vs.Records))
+	}
+}
+
+// bruteForce ranks every record in namespace without any index.
+func bruteForce(vs *VectorStore, q Vector, k int, namespace string) []SearchResult {
+	q = Normalize(q)
+	var all []SearchResult
+	for _, rec := range vs.Records {
+		if namespace == "" || rec.Namespace == namespace {
+			all = append(all, SearchResult{ID: rec.ID, Score: DotProduct(q, rec.Vector)})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	return all[:min(k, len(all))]
+}
+
+func TestNamespaceIndexMatchesScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	store := NewVectorStore()
+	vecs := randomVectors(rng, 600, 8)
+	for i, v := range vecs {
+		store.AddItem(fmt.Sprintf("id-%d", i%400), v, nil, fmt.Sprintf("ns-%d", rng.Intn(4)))
+		if i%5 == 0 {
+			store.DeleteItem(fmt.Sprintf("id-%d", rng.Intn(400)))
+		}
+	}
+	checkIndexes(t, store)
+
+	for _, ns := range []string{"ns-0", "ns-3", "missing"} {
+		q := randomVectors(rng, 1, 8)[0]
+		got, err := store.SearchWithOptions(q, SearchOptions{K: 10, Namespace: ns})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := bruteForce(store, q, 10, ns)
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d results, want %d", ns, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID {
+				t.Fatalf("%s: got %v, want %v", ns, resultIDs(got), resultIDs(want))
+			}
+		}
+	}
+}
+
+// checkMetaIndex verifies that every posting list entry holds its value
+// and that every indexed value is listed.
+func checkMetaIndex(t *testing.T, vs *VectorStore) {
+	t.Helper()
+	for key, postings := range vs.metaIndex {
+		listed := 0
+		for v, list := range postings {
+			for _, idx := range list {
+				if metaIndexValue(vs.Records[idx].Metadata[key]) != v {
+					t.Fatalf("metaIndex[%q][%q] lists %d holding %q", key, v, idx, vs.Records[idx].Metadata[key])
+				}
+			}
+			listed += len(list)
+		}
+		holding := 0
+		for _, rec := range vs.Records {
+			if _, ok := rec.Metadata[key]; ok {
+				holding++
+			}
+		}
+		if listed != holding {
+			t.Fatalf("metaIndex[%q] lists %d records, %d hold the key", key, listed, holding)
+		}
+	}
+}
+
+func TestMetadataIndexMatchesScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	plain, indexed := NewVectorStore(), NewVectorStore()
+	indexed.AddIndexedKey("user")
+	apply := func(fn func(*VectorStore)) { fn(plain); fn(indexed) }
+
+	for i, v := range randomVectors(rng, 800, 8) {
+		meta := map[string]string{"user": fmt.Sprint(rng.Intn(40)), "lang": []string{"en", "de"}[i%2]}
+		if i%9 == 0 {
+			meta["user"] += ".0"
+		}
+		if i%13 == 0 {
+			delete(meta, "user")
+		}
+		id := fmt.Sprintf("id-%d", rng.Intn(500))
+		apply(func(vs *VectorStore) { vs.AddItem(id, v, meta, fmt.Sprintf("ns-%d", i%3)) })
+		switch i % 7 {
+		case 0:
+			victim := fmt.Sprintf("id-%d", rng.Intn(500))
+			apply(func(vs *VectorStore) { vs.DeleteItem(victim) })
+		case 1:
+			patch := map[string]string{"user": fmt.Sprint(rng.Intn(40))}
+			apply(func(vs *VectorStore) { vs.UpdateMetadata(id, patch, true) })
+		}
+	}
+	apply(func(vs *VectorStore) {
+		vs.DeleteByFilter("", Filter{Conditions: []Condition{{Field: "user", Value: "39"}}})
+	})
+	// Declaring a key on a populated store builds its index in one pass.
+	indexed.AddIndexedKey("lang")
+	checkIndexes(t, indexed)
+	checkMetaIndex(t, indexed)
+
+	filters := []Filter{
+		{Conditions: []Condition{{Field: "user", Value: "7"}}},
+		{Conditions: []Condition{{Field: "user", Value: "7.00"}}},
+		{Conditions: []Condition{{Field: "user", Value: "39"}}},
+		{Conditions: []Condition{{Field: "user", Op: OpIn, Values: []string{"3", "4", "3.0"}}}},
+		{Conditions: []Condition{{Field: "user", Value: "5"}, {Field: "lang", Value: "de"}}},
+		{Mode: "or", Conditions: []Condition{{Field: "user", Value: "5"}, {Field: "user", Value: "6"}}},
+		{Mode: "or", Conditions: []Condition{{Field: "user", Value: "5"}, {Field: "other", Value: "x"}}},
+		{Conditions: []Condition{{Field: "user", Op: OpGt, Value: "30"}}},
+		// An empty value also matches the records without the key.
+		{Conditions: []Condition{{Field: "user", Value: ""}}},
+		{Conditions: []Condition{{Field: "user", Value: ""}, {Field: "lang", Value: "en"}}},
+		{Mode: "or", Conditions: []Condition{{Field: "user", Value: ""}, {Field: "user", Value: "5"}}},
+	}
+	if c, ok := indexed.filterCandidates(filters[0]); !ok || len(c) == 0 || len(c) > 50 {
+		t.Fatalf("user filter candidates = %d, %t", len(c), ok)
+	}
+	q := randomVectors(rng, 1, 8)[0]
+	for _, f := range filters {
+		for _, ns := range []string{"", "ns-1"} {
+			opts := SearchOptions{K: 20, Namespace: ns, Filter: f}
+			want, _ := plain.SearchWithOptions(q, opts)
+			got, _ := indexed.SearchWithOptions(q, opts)
+			if fmt.Sprint(resultIDs(got)) != fmt.Sprint(resultIDs(want)) {
+				t.Fatalf("filter %+v in %q: indexed %v, scan %v", f, ns, resultIDs(got), resultIDs(want))
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func requestWithID(t *testing.T, path, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(`{"text":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	return w
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+
+	generated := requestWithID(t, "/query", "").Header().Get(requestIDHeader)
+	if len(generated) != 16 {
+		t.Fatalf("generated request ID %q, want 16 hex chars", generated)
+	}
+	if other := requestWithID(t, "/query", "").Header().Get(requestIDHeader); other == generated {
+		t.Fatal("two requests got the same ID")
+	}
+	if got := requestWithID(t, "/query", "client-abc-123").Header().Get(requestIDHeader); got != "client-abc-123" {
+		t.Fatalf("provided ID came back as %q", got)
+	}
+	if got := requestWithID(t, "/query", "bad id\twith spaces").Header().Get(requestIDHeader); got == "bad id\twith spaces" || got == "" {
+		t.Fatalf("unsafe ID was echoed as %q", got)
+	}
+}
+
+func TestEmbeddingFailureLogsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	useStore(t, NewVectorStore())
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusBadRequest)
+	})
+	if w := requestWithID(t, "/query", "trace-42"); w.Code != 502 {
+		t.Fatalf("query with failing embedder = %d, want 502", w.Code)
+	}
+
+	var failure, access string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		switch {
+		case strings.Contains(line, `"msg":"embedding failed"`):
+			failure = line
+		case strings.Contains(line, `"msg":"request"`):
+			access = line
+		}
+	}
+	for name, line := range map[string]string{"embedding failure": failure, "access": access} {
+		if !strings.Contains(line, `"request_id":"trace-42"`) || !strings.Contains(line, `"latency"`) {
+			t.Fatalf("%s log line lacks request ID or latency: %q", name, line)
+		}
+	}
+}
@@ -1,121 +1,981 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
-var db *VectorStore
+var (
+	db       *VectorStore
+	cfg      Config
+	embedder Embedder
+	ready    = newReadiness()
+)
 
 type AddRequest struct {
 	ID        string            `json:"id"`
 	Text      string            `json:"text"`
 	Namespace string            `json:"namespace"`
 	Metadata  map[string]string `json:"metadata"`
+	// Tags are list-valued metadata, matched by the contains filters.
+	Tags map[string][]string `json:"tags,omitempty"`
+	// TTL, in seconds, makes the record expire that long after it is
+	// written; 0 keeps it until deleted.
+	TTL int `json:"ttl,omitempty"`
+}
+
+var errNegativeTTL = errors.New("ttl must be a non-negative number of seconds")
+
+// normalize validates the request and fills in the default namespace.
+func (req *AddRequest) normalize() error {
+	if req.TTL < 0 {
+		return errNegativeTTL
+	}
+	var err error
+	req.Namespace, err = storeNamespace(req.Namespace)
+	return err
+}
+
+// record builds the Record to store for req with the embedded vector vec,
+// keeping the source text in the metadata.
+func (req AddRequest) record(vec Vector) Record {
+	meta := req.Metadata
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	meta["text"] = req.Text
+	rec := Record{ID: req.ID, Vector: vec, Metadata: meta, Tags: req.Tags, Namespace: req.Namespace}
+	if req.TTL > 0 {
+		rec.ExpiresAt = time.Now().Add(time.Duration(req.TTL) * time.Second)
+	}
+	return rec
 }
 
 type QueryRequest struct {
 	Text      string `json:"text"`
 	K         int    `json:"k"`
 	Namespace string `json:"namespace"`
-	FilterKey string `json:"filter_key"`
-	FilterVal string `json:"filter_val"`
+	// Namespaces searches several namespaces at once, alongside
+	// Namespace if that is set too.
+	Namespaces []string `json:"namespaces"`
+	// Filters takes precedence over the legacy FilterKey/FilterVal pair.
+	Filters   *Filter `json:"filters"`
+	FilterKey string  `json:"filter_key"`
+	FilterVal string  `json:"filter_val"`
+	// IDPrefix and IDs scope the search to matching IDs; IDs, when
+	// present, is an allow-list, and an empty one matches nothing.
+	IDPrefix string   `json:"id_prefix,omitempty"`
+	IDs      []string `json:"ids"`
+	// MinScore drops weaker matches; under l2 it is a maximum distance.
+	MinScore *float32 `json:"min_score"`
+	// Rerank overrides the store's re-ranking factor for approximate
+	// search; 1 disables re-ranking.
+	Rerank int `json:"rerank"`
+	// BoostField names a numeric metadata field blended into the score
+	// with BoostWeight, between 0 and 1 (see Boost).
+	BoostField  string  `json:"boost_field"`
+	BoostWeight float32 `json:"boost_weight"`
+	// PageToken continues from the next_page_token of an earlier response
+	// to the same query.
+	PageToken string `json:"page_token,omitempty"`
+	// NormalizeScores adds a normalized_score to each result: "minmax"
+	// or "softmax" (see ScoreNormalization).
+	NormalizeScores ScoreNormalization `json:"normalize_scores,omitempty"`
+	// Texts expands the query with more phrasings, searched along with
+	// Text, if set, and combined by Combine: "mean" (the default) or
+	// "max" (see QueryCombine).
+	Texts   []string     `json:"texts,omitempty"`
+	Combine QueryCombine `json:"combine,omitempty"`
+	// Fields, when present, limits the metadata and tag keys returned
+	// with each result to these; an empty list returns none.
+	Fields []string `json:"fields"`
+	// IncludeVectors returns each result's vector with it; see
+	// SearchOptions.IncludeVectors for what that costs.
+	IncludeVectors bool `json:"include_vectors,omitempty"`
+	// Precision, when set, rounds the scores in the response to that
+	// many decimal places, overriding cfg.ScorePrecision. Ranking and
+	// paging still use the full scores.
+	Precision *int `json:"precision,omitempty"`
+
+	// after is the decoded PageToken.
+	after *SearchResult
+}
+
+// VectorQueryRequest is a QueryRequest that supplies its own embedding
+// instead of text.
+type VectorQueryRequest struct {
+	QueryRequest
+	Vector Vector `json:"vector"`
+	// Vector64 is an alternative to Vector for float64 sources; it is
+	// downcast with Float64ToVector.
+	Vector64 []float64 `json:"vector64"`
+}
+
+// queryVector returns whichever of Vector or Vector64 was supplied. A
+// float64 value too large for float32 is rejected rather than searched as
+// ±Inf.
+func (req VectorQueryRequest) queryVector() (Vector, error) {
+	switch {
+	case len(req.Vector) > 0 && len(req.Vector64) > 0:
+		return nil, errors.New("set only one of vector and vector64")
+	case len(req.Vector64) > 0:
+		v := Float64ToVector(req.Vector64)
+		for i, x := range v {
+			if math.IsInf(float64(x), 0) {
+				return nil, fmt.Errorf("vector64[%d] overflows float32", i)
+			}
+		}
+		return v, nil
+	case len(req.Vector) > 0:
+		return req.Vector, nil
+	}
+	return nil, errors.New("vector is required")
+}
+
+// Bounds for limitVectorBody: a float in JSON, with its separator, takes
+// well under vectorComponentBytes, and the rest of a request under
+// vectorBodySlack.
+const (
+	vectorComponentBytes = 32
+	vectorBodySlack      = 1 << 20
+)
+
+// limitVectorBody caps the body of a request carrying a vector at what a
+// cfg.MaxDim one can take, so a vector of millions of components fails
+// while it is read rather than after it has been decoded into memory.
+func limitVectorBody(c *gin.Context) {
+	if cfg.MaxDim > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(cfg.MaxDim)*vectorComponentBytes+vectorBodySlack)
+	}
+}
+
+// normalize applies the default k and decodes the page token, or answers
+// 400 and reports false when k is negative or above cfg.MaxK, a namespace
+// is invalid, or the token is malformed.
+func (req *QueryRequest) normalize(c *gin.Context) bool {
+	if err := req.prepare(); err != nil {
+		c.JSON(errorResponse(400, err))
+		return false
+	}
+	return true
+}
+
+// prepare is normalize without the response: it defaults K, validates the
+// request and decodes its page token.
+func (req *QueryRequest) prepare() error {
+	if req.K == 0 {
+		req.K = 5
+	}
+	if req.K < 0 {
+		return errors.New("k must be positive")
+	}
+	if cfg.MaxK > 0 && req.K > cfg.MaxK {
+		return fmt.Errorf("k must be at most %d; use page_token to fetch more", cfg.MaxK)
+	}
+	for _, ns := range append([]string{req.Namespace}, req.Namespaces...) {
+		if err := checkNamespace(ns); err != nil {
+			return err
+		}
+	}
+	if p := req.Precision; p != nil && (*p < 0 || *p > maxScorePrecision) {
+		return fmt.Errorf("precision must be between 0 and %d", maxScorePrecision)
+	}
+	if req.PageToken != "" {
+		after, err := decodePageToken(req.PageToken)
+		if err != nil {
+			return err
+		}
+		req.after = after
+	}
+	return nil
+}
+
+// maxScorePrecision is the most decimal places worth keeping: a float32
+// carries only about 7 significant digits.
+const maxScorePrecision = 7
+
+// scorePrecision is the number of decimal places scores are rounded to
+// in the response, or -1 to leave them whole.
+func (req QueryRequest) scorePrecision() int {
+	switch {
+	case req.Precision != nil:
+		return *req.Precision
+	case cfg.ScorePrecision > 0:
+		return min(cfg.ScorePrecision, maxScorePrecision)
+	}
+	return -1
+}
+
+// errBadPageToken rejects a page_token this server did not issue.
+var errBadPageToken = errors.New("malformed page_token")
+
+// encodePageToken makes the opaque cursor for the page after last.
+func encodePageToken(last SearchResult) string {
+	data, _ := json.Marshal(last)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(token string) (*SearchResult, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errBadPageToken
+	}
+	var after SearchResult
+	if err := json.Unmarshal(data, &after); err != nil || after.ID == "" {
+		return nil, errBadPageToken
+	}
+	return &after, nil
+}
+
+// queryResponse is the body answering a query for k results, with scores
+// rounded to precision decimal places unless it is negative. A full page
+// may not be the last, so it carries a next_page_token, made from the
+// full score so the next page starts exactly where this one ended.
+func queryResponse(results []DetailedResult, k, precision int) gin.H {
+	resp := gin.H{"results": roundScores(results, precision)}
+	if len(results) > 0 && len(results) == k {
+		resp["next_page_token"] = encodePageToken(results[len(results)-1].SearchResult)
+	}
+	return resp
+}
+
+// response is queryResponse for req. Max-combined results cannot be
+// paged, so they are answered without a next_page_token.
+func (req QueryRequest) response(results []DetailedResult) gin.H {
+	if len(req.Texts) > 0 && req.Combine == CombineMax {
+		return gin.H{"results": roundScores(results, req.scorePrecision())}
+	}
+	return queryResponse(results, req.K, req.scorePrecision())
+}
+
+// roundScores returns results with their scores, distances and normalized
+// scores rounded to precision decimal places, or results itself when
+// precision is negative. The results are copied, not rounded in place, as
+// they may be cached.
+func roundScores(results []DetailedResult, precision int) []DetailedResult {
+	if precision < 0 {
+		return results
+	}
+	out := slices.Clone(results)
+	for i := range out {
+		res := &out[i]
+		res.Score = roundScore(res.Score, precision)
+		if res.Distance != nil {
+			d := roundScore(*res.Distance, precision)
+			res.Distance = &d
+		}
+		if res.Normalized != nil {
+			n := roundScore(*res.Normalized, precision)
+			res.Normalized = &n
+		}
+	}
+	return out
+}
+
+func roundScore(x float32, precision int) float32 {
+	scale := math.Pow10(precision)
+	return float32(math.Round(float64(x)*scale) / scale)
+}
+
+// projectFields trims each result's metadata and tags to the keys in
+// fields, unless fields is nil. The maps are shared with the store, so
+// trimmed results get copies.
+func projectFields(results []DetailedResult, fields []string) {
+	if fields == nil {
+		return
+	}
+	for i := range results {
+		res := &results[i]
+		meta := make(map[string]string)
+		var tags map[string][]string
+		for _, f := range fields {
+			if v, ok := res.Metadata[f]; ok {
+				meta[f] = v
+			}
+			if v, ok := res.Tags[f]; ok {
+				if tags == nil {
+					tags = make(map[string][]string)
+				}
+				tags[f] = v
+			}
+		}
+		res.Metadata, res.Tags = meta, tags
+	}
 }
 
-func getEmbedding(text string) ([]float32, error) {
-	reqBody := map[string]string{"model": "nomic-embed-text", "prompt": text}
-	jsonData, _ := json.Marshal(reqBody)
-	resp, err := http.Post("http://localhost:11434/api/embeddings", "application/json", bytes.NewBuffer(jsonData))
+// searchOptions translates the request into store search options.
+func (req QueryRequest) searchOptions() SearchOptions {
+	opts := SearchOptions{K: req.K, Namespace: req.Namespace, Namespaces: req.Namespaces, IDPrefix: req.IDPrefix, IDs: req.IDs, MinScore: req.MinScore, Rerank: req.Rerank, After: req.after, NormalizeScores: req.NormalizeScores, IncludeVectors: req.IncludeVectors}
+	if req.BoostField != "" {
+		opts.Boost = &Boost{Field: req.BoostField, Weight: req.BoostWeight}
+	}
+	if req.Filters != nil {
+		opts.Filter = *req.Filters
+	} else if req.FilterKey != "" {
+		opts.Filter.Conditions = []Condition{{Field: req.FilterKey, Value: FilterValue(req.FilterVal)}}
+	}
+	return opts
+}
+
+// ifMatchVersion parses an If-Match header holding the record version a
+// write expects, e.g. `If-Match: 3` or `If-Match: "3"`; 0 asks for the ID
+// to be new. ok is false when the header is absent.
+func ifMatchVersion(c *gin.Context) (version int, ok bool, err error) {
+	h := c.GetHeader("If-Match")
+	if h == "" {
+		return 0, false, nil
+	}
+	version, err = strconv.Atoi(strings.Trim(h, `"`))
+	if err != nil || version < 0 {
+		return 0, false, fmt.Errorf("If-Match must be a record version, got %q", h)
+	}
+	return version, true, nil
+}
+
+// itemError reports why one record of a bulk request was not stored.
+type itemError struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// addBatch embeds each request's text and stores the results, along with
+// any ready-made records, under one lock, returning how many were added
+// and why the rest were not.
+func addBatch(ctx context.Context, reqs []AddRequest, records []Record) (int, []itemError) {
+	failures := []itemError{}
+	total := len(reqs) + len(records)
+	for _, req := range reqs {
+		if err := req.normalize(); err != nil {
+			failures = append(failures, itemError{ID: req.ID, Error: err.Error()})
+			continue
+		}
+		vec, err := embedText(ctx, req.Text)
+		if err != nil {
+			failures = append(failures, itemError{ID: req.ID, Error: err.Error()})
+			continue
+		}
+		records = append(records, req.record(vec))
+	}
+
+	for i, err := range db.BatchAddItem(records) {
+		if err != nil {
+			failures = append(failures, itemError{ID: records[i].ID, Error: err.Error()})
+			continue
+		}
+		pending.remove(records[i].ID)
+	}
+	return total - len(failures), failures
+}
+
+// runQuery searches for query and writes the results, as SSE when the
+// request asks for ?stream=true. With ?explain=true the response also
+// carries the search's Explain counters. The JSON results are also
+// returned, for the query cache; streamed, explained or failed searches
+// return nil.
+func runQuery(c *gin.Context, query Vector, req QueryRequest) []DetailedResult {
+	countOp("query")
+	opts := req.searchOptions()
+	explain := c.Query("explain") == "true"
+	if explain {
+		opts.Explain = &Explain{}
+	}
+	if c.Query("stream") == "true" {
+		streamQuery(c, query, opts, req)
+		return nil
+	}
+	detailed, err := db.SearchDetailedContext(c.Request.Context(), query, opts)
+	if c.Request.Context().Err() != nil {
+		// The client has gone; there is no one to answer.
+		return nil
+	}
+	if err != nil {
+		c.JSON(errorResponse(400, err))
+		return nil
+	}
+	projectFields(detailed, req.Fields)
+	resp := queryResponse(detailed, opts.K, req.scorePrecision())
+	if explain {
+		resp["explain"] = opts.Explain
+	}
+	respond(c, 200, resp)
+	if explain {
+		return nil
+	}
+	return detailed
+}
+
+// runMultiQuery embeds each of the request's texts and writes the results
+// of searching them together, which it returns like runQuery.
+func runMultiQuery(c *gin.Context, req QueryRequest) []DetailedResult {
+	countOp("query")
+	if c.Query("stream") == "true" || c.Query("explain") == "true" {
+		c.JSON(errorResponse(400, errors.New("stream and explain take a single text")))
+		return nil
+	}
+	if err := req.Combine.validate(); err != nil {
+		c.JSON(errorResponse(400, err))
+		return nil
+	}
+	texts := req.Texts
+	if req.Text != "" {
+		texts = append([]string{req.Text}, texts...)
+	}
+	queries := make([]Vector, len(texts))
+	for i, text := range texts {
+		vec, err := embedText(c.Request.Context(), text)
+		if err != nil {
+			c.JSON(errorResponse(502, err))
+			return nil
+		}
+		queries[i] = vec
+	}
+	detailed, err := db.SearchMultiDetailed(queries, req.Combine, req.searchOptions())
 	if err != nil {
-		return nil, err
+		c.JSON(errorResponse(400, err))
+		return nil
 	}
-	defer resp.Body.Close()
+	projectFields(detailed, req.Fields)
+	respond(c, 200, req.response(detailed))
+	return detailed
+}
 
-	var res struct {
-		Embedding []float32 `json:"embedding"`
+// streamQuery answers a query as server-sent events: a "candidates" event
+// for each batch of per-worker results as it arrives, then, if requested,
+// an "explain" event, and a single "results" event with the final ordered
+// top-K. Every score sent is rounded to the request's precision.
+func streamQuery(c *gin.Context, query Vector, opts SearchOptions, req QueryRequest) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	precision := req.scorePrecision()
+	opts.OnCandidates = func(batch []SearchResult) {
+		if precision >= 0 {
+			// The batch is the worker's own; the merge still reads it.
+			batch = slices.Clone(batch)
+			for i := range batch {
+				batch[i].Score = roundScore(batch[i].Score, precision)
+			}
+		}
+		c.SSEvent("candidates", batch)
+		c.Writer.Flush()
 	}
-	json.NewDecoder(resp.Body).Decode(&res)
-	return res.Embedding, nil
+	results, err := db.SearchDetailedContext(c.Request.Context(), query, opts)
+	if err != nil {
+		_, body := errorResponse(400, err)
+		c.SSEvent("error", body)
+		return
+	}
+	projectFields(results, req.Fields)
+	if opts.Explain != nil {
+		c.SSEvent("explain", opts.Explain)
+	}
+	c.SSEvent("results", roundScores(results, precision))
+	c.Writer.Flush()
 }
 
 func main() {
+	// Structured logs throughout; the standard log package is routed here
+	// too.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	cfg = LoadConfig()
+	if err := checkNamespace(cfg.DefaultNamespace); err != nil {
+		log.Fatalf("DEFAULT_NAMESPACE: %v", err)
+	}
+	if err := cfg.EvictionPolicy.validate(); err != nil {
+		log.Fatalf("EVICTION_POLICY: %v", err)
+	}
+	var err error
+	if embedder, err = NewEmbedder(cfg); err != nil {
+		log.Fatalf("embeddings: %v", err)
+	}
+	log.Printf("embeddings: provider=%s model=%s url=%s", cfg.EmbedProvider, cfg.EmbedModel, cfg.embedURL())
+	if cfg.EmbedCacheSize > 0 {
+		embedder = NewCachingEmbedder(embedder, cfg.EmbedCacheSize)
+	}
+
+	useSIMD = hasSIMD && !cfg.DisableSIMD
+	log.Printf("search: simd=%t", useSIMD)
 	db = NewVectorStore()
-	db.Load("vectors.json")
+	db.MaxWorkers = cfg.SearchWorkers
+	db.SanitizeNonFinite = cfg.SanitizeVectors
+	db.Normalize = cfg.NormalizeVectors
+	db.StrictDimensions = cfg.StrictDimensions
+	db.MaxDim = cfg.MaxDim
+	db.SoftDelete, db.CompactThreshold = cfg.SoftDelete, cfg.CompactThreshold
+	db.SparseStorage = cfg.SparseStorage
+	db.MaxRecords, db.Eviction = cfg.MaxRecords, cfg.EvictionPolicy
+	db.PerNamespaceFiles, db.LoadNamespaces = cfg.PerNamespaceFiles, cfg.LoadNamespaces
+	db.MmapSnapshots = cfg.MmapSnapshot
+	for _, key := range cfg.IndexedKeys {
+		db.AddIndexedKey(key)
+	}
+	if cfg.QueryCacheSize > 0 {
+		queryCache = newResultCache(cfg.QueryCacheSize, cfg.QueryCacheTTL)
+	}
+	if cfg.QueryLogSize > 0 {
+		queryLog = newQueryRing(cfg.QueryLogSize)
+	}
+	if cfg.PendingQueuePath != "" {
+		if pending, err = openPendingQueue(cfg.PendingQueuePath); err != nil {
+			log.Fatalf("pending queue: %v", err)
+		}
+	}
+	if err := db.EnableWAL(cfg.WALPath); err != nil {
+		log.Fatalf("wal: %v", err)
+	}
+	if err := db.Load(cfg.DataPath); errors.Is(err, ErrDimensionMismatch) {
+		// Carrying on would save the empty store over the snapshot.
+		log.Fatalf("load: %v", err)
+	} else if err != nil {
+		log.Printf("load: %v", err)
+	}
+	ready.SkipEmbedding = cfg.ReadySkipEmbedding
+	ready.MarkLoaded()
+	stopCompaction := db.StartWALCompaction(cfg.DataPath, cfg.WALCompactInterval)
+	stopSnapshots := db.StartSnapshots(cfg.DataPath, cfg.SnapshotInterval)
+	stopSweeper := db.StartExpirySweeper(cfg.ExpirySweepInterval)
+	stopRetries := func() {}
+	if pending != nil {
+		stopRetries = pending.start(cfg.PendingRetryPeriod, db, embedder)
+	}
+
+	srv, ln, err := startServer(cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+	log.Printf("listening on %s", ln.Addr())
+	var grpcSrv *grpc.Server
+	if cfg.GRPCListenAddr != "off" {
+		var gln net.Listener
+		if grpcSrv, gln, err = startGRPC(cfg.GRPCListenAddr); err != nil {
+			log.Fatalf("grpc listen: %v", err)
+		}
+		log.Printf("grpc listening on %s", gln.Addr())
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
 
-	r := gin.Default()
+	// Drain in-flight requests before the final save so none are lost.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() { grpcSrv.GracefulStop(); close(stopped) }()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcSrv.Stop()
+		}
+	}
+	stopRetries()
+	stopSweeper()
+	stopCompaction()
+	stopSnapshots()
+	if err := db.Close(); err != nil {
+		log.Printf("save: %v", err)
+	}
+}
+
+// listen opens addr, which is either a TCP address or "unix:" followed by
+// a socket path. A stale socket file from a previous run is removed.
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// startServer serves the API on addr in the background.
+func startServer(addr string) (*http.Server, net.Listener, error) {
+	ln, err := listen(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv := &http.Server{Handler: setupRouter()}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("serve: %v", err)
+		}
+	}()
+	return srv, ln, nil
+}
+
+// setupRouter registers the HTTP API against the package-level store.
+func setupRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), requestLogger())
+
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
 
-	r.POST("/add", func(c *gin.Context) {
+	// Everything but the liveness probe sits behind the API key check,
+	// and so does /metrics unless PUBLIC_METRICS opens it to scrapers.
+	api := r.Group("/", apiKeyAuth(cfg.APIKeys))
+	if cfg.PublicMetrics {
+		r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	} else {
+		api.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
+	// Endpoints that call the embedder are rate limited per client.
+	embedding := api
+	if cfg.RateLimit > 0 {
+		embedding = api.Group("/", newRateLimiter(cfg.RateLimit, cfg.RateBurst).middleware())
+	}
+
+	api.GET("/ready", func(c *gin.Context) {
+		if err := ready.Ready(); err != nil {
+			status, body := errorResponse(503, err)
+			body["status"] = "not ready"
+			c.JSON(status, body)
+			return
+		}
+		c.JSON(200, gin.H{"status": "ready"})
+	})
+	embedding.GET("/diag/embedding", diagEmbedding)
+
+	embedding.POST("/add", func(c *gin.Context) {
+		countOp("add")
 		var req AddRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		if err := req.normalize(); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		version, ifMatch, err := ifMatchVersion(c)
+		if err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+
+		vec, err := embedText(c.Request.Context(), req.Text)
+		if err != nil && pending != nil && !ifMatch && isTransient(err) {
+			qerr := pending.enqueue(req, err)
+			if qerr == nil {
+				c.JSON(202, gin.H{"status": "pending", "total": db.Len()})
+				return
+			}
+			log.Printf("pending queue: %v", qerr)
+		}
+		if err != nil {
+			c.JSON(errorResponse(502, err))
 			return
 		}
 
-		vec, err := getEmbedding(req.Text)
+		// This request supersedes any queued one for the ID.
+		pending.remove(req.ID)
+		rec := req.record(vec)
+		if ifMatch {
+			err = db.AddRecordIfVersion(rec, version)
+		} else {
+			err = db.AddRecord(rec)
+		}
+		if errors.Is(err, ErrVersionConflict) {
+			status, body := errorResponse(409, err)
+			body["version"] = db.Version(req.ID)
+			c.JSON(status, body)
+			return
+		}
 		if err != nil {
-			c.JSON(500, gin.H{"error": "Embedding error"})
+			c.JSON(errorResponse(400, err))
 			return
 		}
+		c.JSON(200, gin.H{"status": "success", "total": db.Len(), "version": db.Version(req.ID)})
+	})
 
-		if req.Metadata == nil {
-			req.Metadata = make(map[string]string)
+	embedding.POST("/batch_add", func(c *gin.Context) {
+		countOp("batch_add")
+		var reqs []AddRequest
+		if err := c.ShouldBindJSON(&reqs); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
 		}
-		req.Metadata["text"] = req.Text
 
-		db.AddItem(req.ID, Vector(vec), req.Metadata, req.Namespace)
-		c.JSON(200, gin.H{"status": "success", "total": len(db.Records)})
+		added, failures := addBatch(c.Request.Context(), reqs, nil)
+		c.JSON(200, gin.H{
+			"added":  added,
+			"failed": len(failures),
+			"errors": failures,
+		})
 	})
 
-	r.POST("/query", func(c *gin.Context) {
+	embedding.POST("/import", importHandler)
+	embedding.POST("/reembed", reembedHandler)
+	embedding.POST("/calibrate", calibrateHandler)
+	api.GET("/reembed", reembedStatusHandler)
+	api.GET("/pending", pendingHandler)
+	api.GET("/debug/queries", debugQueries)
+
+	embedding.POST("/batch_query", batchQueryHandler)
+
+	embedding.POST("/query", func(c *gin.Context) {
 		var req QueryRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+			c.JSON(errorResponse(400, err))
 			return
 		}
-		if req.K == 0 {
-			req.K = 5
+		if !req.normalize(c) {
+			return
 		}
+		start := time.Now()
+		var results []DetailedResult
+		cached := false
+		defer func() { logQuery(c, req, start, results, cached) }()
 
-		queryVec, _ := getEmbedding(req.Text)
-		results := db.Search(Vector(queryVec), req.K, req.Namespace, req.FilterKey, req.FilterVal)
+		cache := queryCache
+		if c.Query("stream") == "true" || c.Query("explain") == "true" {
+			cache = nil
+		}
+		// Read before searching: a write racing the search moves the
+		// generation on, so the entry stored below is never served.
+		var key string
+		var gen uint64
+		if cache != nil {
+			key, gen = req.cacheKey(), db.Generation()
+			if results, cached = cache.get(key, db, gen); cached {
+				countOp("query")
+				respond(c, 200, req.response(results))
+				return
+			}
+		}
 
-		// O(1) Metadata Retrieval
-		type DetailedResult struct {
-			SearchResult
-			Metadata map[string]string `json:"metadata"`
+		if len(req.Texts) > 0 {
+			results = runMultiQuery(c, req)
+		} else {
+			queryVec, err := embedText(c.Request.Context(), req.Text)
+			if err != nil {
+				c.JSON(errorResponse(502, err))
+				return
+			}
+			results = runQuery(c, queryVec, req)
+		}
+		if cache != nil && results != nil {
+			cache.put(key, db, gen, results)
+		}
+	})
+
+	api.POST("/query_vector", func(c *gin.Context) {
+		limitVectorBody(c)
+		var req VectorQueryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		query, err := req.queryVector()
+		if err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		if !req.normalize(c) {
+			return
+		}
+		runQuery(c, query, req.QueryRequest)
+	})
+
+	api.GET("/similar/:id", func(c *gin.Context) {
+		countOp("similar")
+		k, err := strconv.Atoi(c.DefaultQuery("k", "10"))
+		if err != nil || k <= 0 {
+			c.JSON(errorResponse(400, errors.New("k must be a positive integer")))
+			return
+		}
+		ns := c.Query("namespace")
+		if err := checkNamespace(ns); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		results, err := db.SimilarToDetailed(c.Param("id"), k, ns)
+		if err != nil {
+			// Unknown IDs answer 404 (see errorCodes).
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		c.JSON(200, gin.H{"results": results})
+	})
+
+	api.GET("/item/:id", func(c *gin.Context) {
+		countOp("get")
+		rec, ok := db.Get(c.Param("id"))
+		if !ok {
+			c.JSON(errorResponse(404, fmt.Errorf("%w: %s", ErrNotFound, c.Param("id"))))
+			return
+		}
+		if c.Query("include_vector") == "false" {
+			rec.Vector, rec.Sparse = nil, nil
+		}
+		respond(c, 200, rec)
+	})
+
+	api.GET("/stats", func(c *gin.Context) {
+		c.JSON(200, db.Stats())
+	})
+
+	api.GET("/count", func(c *gin.Context) {
+		stats := db.Stats()
+		if ns, ok := c.GetQuery("namespace"); ok {
+			c.JSON(200, gin.H{"namespace": ns, "count": stats.Namespaces[ns]})
+			return
+		}
+		c.JSON(200, gin.H{"count": stats.Total})
+	})
+
+	api.GET("/list", func(c *gin.Context) {
+		limit, err1 := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, err2 := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err1 != nil || err2 != nil || limit <= 0 || offset < 0 {
+			c.JSON(errorResponse(400, errors.New("limit must be a positive integer and offset non-negative")))
+			return
 		}
+		limit = min(limit, 1000)
+		includeVector := c.Query("include_vector") == "true"
 
-		db.RLock()
-		finalResponse := make([]DetailedResult, len(results))
-		for i, res := range results {
-			idx := db.IDMap[res.ID]
-			finalResponse[i] = DetailedResult{
-				SearchResult: res,
-				Metadata:     db.Records[idx].Metadata,
+		type ListItem struct {
+			ID        string            `json:"id"`
+			Namespace string            `json:"namespace"`
+			Metadata  map[string]string `json:"metadata"`
+			Version   int               `json:"version"`
+			Vector    Vector            `json:"vector,omitempty"`
+		}
+		records := db.List(c.Query("namespace"), limit, offset)
+		items := make([]ListItem, len(records))
+		for i, rec := range records {
+			items[i] = ListItem{ID: rec.ID, Namespace: rec.Namespace, Metadata: rec.Metadata, Version: rec.Version}
+			if includeVector {
+				items[i].Vector = rec.Original()
 			}
 		}
-		db.RUnlock()
+		respond(c, 200, gin.H{"records": items, "limit": limit, "offset": offset})
+	})
+
+	api.PATCH("/metadata/:id", func(c *gin.Context) {
+		var req struct {
+			Metadata map[string]string `json:"metadata"`
+			Merge    bool              `json:"merge"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		if !db.UpdateMetadata(c.Param("id"), req.Metadata, req.Merge) {
+			c.JSON(errorResponse(404, fmt.Errorf("%w: %s", ErrNotFound, c.Param("id"))))
+			return
+		}
+		pending.remove(c.Param("id"))
+		c.JSON(200, gin.H{"status": "updated"})
+	})
+
+	api.PATCH("/vector/:id", func(c *gin.Context) {
+		countOp("update_vector")
+		limitVectorBody(c)
+		var req struct {
+			Vector Vector `json:"vector"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		if err := db.setVector(c.Param("id"), req.Vector); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		pending.remove(c.Param("id"))
+		c.JSON(200, gin.H{"status": "updated"})
+	})
 
-		c.JSON(200, gin.H{"results": finalResponse})
+	api.GET("/export", exportHandler)
+
+	api.POST("/delete_by_filter", func(c *gin.Context) {
+		countOp("delete_by_filter")
+		var req struct {
+			Namespace string `json:"namespace"`
+			Filters   Filter `json:"filters"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		// An empty request would match everything; make purging the whole
+		// store a deliberate act rather than a typo.
+		if req.Namespace == "" && len(req.Filters.Conditions) == 0 {
+			c.JSON(errorResponse(400, errors.New("namespace or filters is required")))
+			return
+		}
+		n, err := db.DeleteByFilter(req.Namespace, req.Filters)
+		if err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		pending.removeWhere(func(rec Record) bool {
+			return (req.Namespace == "" || rec.Namespace == req.Namespace) && req.Filters.Matches(rec.Metadata, rec.Tags)
+		})
+		c.JSON(200, gin.H{"status": "deleted", "deleted": n, "total": db.Len()})
 	})
 
-	srv := &http.Server{Addr: ":8080", Handler: r}
-	go func() { srv.ListenAndServe() }()
+	api.DELETE("/namespace/:name", func(c *gin.Context) {
+		countOp("delete_namespace")
+		ns := c.Param("name")
+		if err := checkNamespace(ns); err != nil {
+			c.JSON(errorResponse(400, err))
+			return
+		}
+		n, err := db.DropNamespace(ns)
+		if err != nil {
+			c.JSON(errorResponse(500, err))
+			return
+		}
+		pending.removeWhere(func(rec Record) bool { return rec.Namespace == ns })
+		c.JSON(200, gin.H{"status": "deleted", "namespace": ns, "deleted": n, "total": db.Len()})
+	})
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	api.POST("/compact", func(c *gin.Context) {
+		n := db.Compact()
+		c.JSON(200, gin.H{"status": "compacted", "reclaimed": n, "total": db.Len()})
+	})
 
-	db.Save("vectors.json")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	srv.Shutdown(ctx)
+	api.POST("/optimize", func(c *gin.Context) {
+		report, err := db.Optimize(c.Query("sort") == "namespace")
+		if err != nil {
+			c.JSON(errorResponse(500, err))
+			return
+		}
+		c.JSON(200, gin.H{"status": "optimized", "report": report, "total": db.Len()})
+	})
+
+	api.DELETE("/delete/:id", func(c *gin.Context) {
+		countOp("delete")
+		if queued := pending.remove(c.Param("id")); !db.DeleteItem(c.Param("id")) && !queued {
+			c.JSON(errorResponse(404, fmt.Errorf("%w: %s", ErrNotFound, c.Param("id"))))
+			return
+		}
+		c.JSON(200, gin.H{"status": "deleted", "total": db.Len()})
+	})
+
+	return r
 }
@@ -0,0 +1,792 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// useStore installs store as the package-level db for the test.
+func useStore(t *testing.T, store *VectorStore) {
+	t.Helper()
+	prev := db
+	db = store
+	t.Cleanup(func() { db = prev })
+}
+
+// staticEmbedding makes the fake Ollama return vec for every prompt.
+func staticEmbedding(t *testing.T, vec Vector) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]Vector{"embedding": vec})
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) { w.Write(body) })
+}
+
+func doJSON(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, req)
+	return w
+}
+
+// fakeOllama serves /api/embeddings with the given handler and points the
+// embedder at it for the duration of the test.
+func fakeOllama(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	prev := embedder
+	embedder = &OllamaEmbedder{URL: srv.URL, Model: "test-model"}
+	t.Cleanup(func() { embedder = prev })
+	return srv
+}
+
+// sseEvent is one parsed server-sent event.
+type sseEvent struct {
+	name string
+	data string
+}
+
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var cur sseEvent
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			cur.name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			cur.data = strings.TrimPrefix(line, "data:")
+		case line == "" && cur.name != "":
+			events = append(events, cur)
+			cur = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestQueryStreamMatchesNonStreaming(t *testing.T) {
+	store := NewVectorStore()
+	for i := 0; i < 200; i++ {
+		store.AddItem(fmt.Sprintf("id-%d", i), Vector{1, float32(i%17) / 17, float32(i%5) / 5}, map[string]string{"n": fmt.Sprint(i)}, "")
+	}
+	useStore(t, store)
+	staticEmbedding(t, Vector{1, 0.5, 0.2})
+
+	query := QueryRequest{Text: "anything", K: 7}
+	plain := doJSON(t, "POST", "/query", query)
+	var want struct{ Results []DetailedResult }
+	json.Unmarshal(plain.Body.Bytes(), &want)
+
+	w := doJSON(t, "POST", "/query?stream=true", query)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	events := parseSSE(t, w.Body.String())
+	if len(events) < 2 || events[len(events)-1].name != "results" {
+		t.Fatalf("unexpected event sequence: %+v", events)
+	}
+
+	// Rebuilding the top-K from the candidate events alone must agree
+	// with both the final event and the non-streaming response.
+	merged := NewResultHeap(true)
+	for _, ev := range events[:len(events)-1] {
+		if ev.name != "candidates" {
+			t.Fatalf("unexpected event %q", ev.name)
+		}
+		var batch []SearchResult
+		if err := json.Unmarshal([]byte(ev.data), &batch); err != nil {
+			t.Fatalf("candidates: %v", err)
+		}
+		for _, r := range batch {
+			merged.Offer(r, query.K)
+		}
+	}
+	rebuilt := merged.Drain()
+
+	var final []DetailedResult
+	json.Unmarshal([]byte(events[len(events)-1].data), &final)
+	if len(rebuilt) != len(want.Results) || len(final) != len(want.Results) {
+		t.Fatalf("got %d rebuilt / %d final results, want %d", len(rebuilt), len(final), len(want.Results))
+	}
+	for i := range want.Results {
+		if rebuilt[i].Score != want.Results[i].Score || final[i].ID != want.Results[i].ID {
+			t.Fatalf("result %d: rebuilt %+v, final %+v, want %+v", i, rebuilt[i], final[i], want.Results[i])
+		}
+	}
+}
+
+func TestServerStartsAndShutsDown(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("a", Vector{1, 0}, nil, "ns")
+
+	srv, ln, err := startServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("startServer: %v", err)
+	}
+	resp, err := http.Get("http://" + ln.Addr().String() + "/stats")
+	if err != nil {
+		t.Fatalf("GET /stats: %v", err)
+	}
+	var stats StoreStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || stats.Total != 1 {
+		t.Fatalf("status %d, stats %+v", resp.StatusCode, stats)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/stats"); err == nil {
+		t.Fatal("server still reachable after shutdown")
+	}
+}
+
+func TestQueryEmptyAndInvalidK(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "x"})
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `{"results":[]}` {
+		t.Fatalf("empty store: %d %s", w.Code, w.Body)
+	}
+
+	db.AddItem("a", Vector{1, 0}, nil, "")
+	w = doJSON(t, "POST", "/query", QueryRequest{Text: "x", Namespace: "none"})
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `{"results":[]}` {
+		t.Fatalf("all filtered: %d %s", w.Code, w.Body)
+	}
+
+	if w := doJSON(t, "POST", "/query", QueryRequest{Text: "x", K: -1}); w.Code != 400 {
+		t.Fatalf("negative k: got %d", w.Code)
+	}
+}
+
+func TestQueryVector(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("a", Vector{1, 0, 0}, map[string]string{"tag": "x"}, "")
+	db.AddItem("b", Vector{0, 1, 0}, nil, "")
+	db.AddItem("c", Vector{1, 1, 0}, nil, "")
+
+	w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: Vector{0, 1, 0}, QueryRequest: QueryRequest{K: 2}})
+	if w.Code != 200 {
+		t.Fatalf("query_vector: %d %s", w.Code, w.Body)
+	}
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 2 || resp.Results[0].ID != "b" {
+		t.Fatalf("got %+v, want b first", resp.Results)
+	}
+	if s := resp.Results[0].Score; math.Abs(float64(s)-1) > 1e-5 {
+		t.Fatalf("exact match scored %v, want ~1", s)
+	}
+	if d := resp.Results[0].Distance; d == nil || math.Abs(float64(*d)) > 1e-5 {
+		t.Fatalf("exact match distance = %v, want ~0", d)
+	}
+
+	w = doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: Vector{1, 0}})
+	if w.Code != 400 {
+		t.Fatalf("wrong dimension: got %d, want 400", w.Code)
+	}
+	if w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{}); w.Code != 400 {
+		t.Fatalf("missing vector: got %d, want 400", w.Code)
+	}
+
+	w = doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector64: []float64{0, 1, 0}})
+	resp.Results = nil
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || len(resp.Results) == 0 || resp.Results[0].ID != "b" {
+		t.Fatalf("vector64: %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector64: []float64{1e300, 0, 0}}); w.Code != 400 {
+		t.Fatalf("overflowing vector64: got %d, want 400", w.Code)
+	}
+}
+
+func TestQueryDistanceByMetric(t *testing.T) {
+	for _, m := range []Metric{MetricCosine, MetricL2, MetricDot} {
+		t.Run(string(m), func(t *testing.T) {
+			store := NewVectorStore()
+			store.Metric = m
+			useStore(t, store)
+			db.AddItem("a", Vector{3, 4}, nil, "")
+
+			w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: Vector{3, 4}})
+			var resp struct{ Results []DetailedResult }
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if len(resp.Results) != 1 {
+				t.Fatalf("got %s", w.Body)
+			}
+			got := resp.Results[0]
+			if m == MetricDot {
+				if got.Distance != nil || got.Score != 25 {
+					t.Fatalf("dot: score %v distance %v, want 25 and none", got.Score, got.Distance)
+				}
+				return
+			}
+			if got.Distance == nil || math.Abs(float64(*got.Distance)) > 1e-5 {
+				t.Fatalf("distance = %v, want ~0", got.Distance)
+			}
+			want := float32(1)
+			if m == MetricL2 {
+				want = 0
+			}
+			if math.Abs(float64(got.Score-want)) > 1e-5 {
+				t.Fatalf("score = %v, want %v", got.Score, want)
+			}
+		})
+	}
+}
+
+func TestHealthAndReady(t *testing.T) {
+	prev := ready
+	t.Cleanup(func() { ready = prev })
+
+	calls := 0
+	backendErr := error(nil)
+	ready = newReadiness()
+	ready.Check = func() error { calls++; return backendErr }
+
+	if w := doJSON(t, "GET", "/health", nil); w.Code != 200 {
+		t.Fatalf("/health = %d", w.Code)
+	}
+	if w := doJSON(t, "GET", "/ready", nil); w.Code != 503 {
+		t.Fatalf("/ready before load = %d, want 503", w.Code)
+	}
+
+	ready.MarkLoaded()
+	for i := 0; i < 3; i++ {
+		if w := doJSON(t, "GET", "/ready", nil); w.Code != 200 {
+			t.Fatalf("/ready after load = %d, want 200", w.Code)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("backend checked %d times, want 1 (cached)", calls)
+	}
+
+	backendErr = errors.New("connection refused")
+	ready.CheckTTL = 0
+	if w := doJSON(t, "GET", "/ready", nil); w.Code != 503 {
+		t.Fatalf("/ready with backend down = %d, want 503", w.Code)
+	}
+	ready.SkipEmbedding = true
+	if w := doJSON(t, "GET", "/ready", nil); w.Code != 200 {
+		t.Fatalf("/ready with check skipped = %d, want 200", w.Code)
+	}
+}
+
+func TestDiagEmbedding(t *testing.T) {
+	prevCfg, prevReady := cfg, ready
+	t.Cleanup(func() { cfg, ready = prevCfg, prevReady })
+	cfg.EmbedProvider, cfg.EmbedModel, cfg.OllamaURL = "ollama", "test-model", "http://ollama.test"
+	ready = newReadiness()
+	checks := 0
+	ready.Check = func() error { checks++; return nil }
+
+	calls := 0
+	body, _ := json.Marshal(map[string]Vector{"embedding": {1, 2, 3}})
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write(body)
+	})
+	// The cache must not answer for the backend.
+	embedder = NewCachingEmbedder(embedder, 10)
+
+	for range 2 {
+		w := doJSON(t, "GET", "/diag/embedding", nil)
+		var resp struct {
+			Status, Model, URL string
+			Dim                int
+			LatencyMS          *int64 `json:"latency_ms"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != 200 || resp.Status != "ok" || resp.Dim != 3 || resp.Model != "test-model" || resp.URL != "http://ollama.test" || resp.LatencyMS == nil {
+			t.Fatalf("diag: %d %s", w.Code, w.Body)
+		}
+	}
+	if calls != 2 || checks != 0 {
+		t.Errorf("backend called %d times, readiness checked %d times; want 2 and 0", calls, checks)
+	}
+
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) { http.Error(w, "model not found", 404) })
+	w := doJSON(t, "GET", "/diag/embedding", nil)
+	var failed map[string]any
+	json.Unmarshal(w.Body.Bytes(), &failed)
+	if w.Code != 502 || failed["status"] != "error" || failed["error"] == nil || failed["model"] != "test-model" {
+		t.Fatalf("diag with backend failing: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAddIfMatch(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+
+	add := func(ifMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(AddRequest{ID: "a", Text: "hello"})
+		req := httptest.NewRequest("POST", "/add", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		setupRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := add(""); w.Code != 200 || !strings.Contains(w.Body.String(), `"version":1`) {
+		t.Fatalf("first add: %d %s", w.Code, w.Body)
+	}
+	if w := add(`"1"`); w.Code != 200 || !strings.Contains(w.Body.String(), `"version":2`) {
+		t.Fatalf("conditional update: %d %s", w.Code, w.Body)
+	}
+	if w := add("1"); w.Code != 409 || !strings.Contains(w.Body.String(), `"version":2`) {
+		t.Fatalf("stale update: %d %s", w.Code, w.Body)
+	}
+	if w := add("nope"); w.Code != 400 {
+		t.Fatalf("bad If-Match: got %d, want 400", w.Code)
+	}
+
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "hello"})
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 1 || resp.Results[0].Version != 2 {
+		t.Fatalf("query: %s", w.Body)
+	}
+	if w := doJSON(t, "GET", "/list", nil); !strings.Contains(w.Body.String(), `"version":2`) {
+		t.Fatalf("list: %s", w.Body)
+	}
+}
+
+func TestAddTTL(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+
+	if w := doJSON(t, "POST", "/add", AddRequest{ID: "a", Text: "x", TTL: 60}); w.Code != 200 {
+		t.Fatalf("add with ttl: %d %s", w.Code, w.Body)
+	}
+	rec, _ := recordByID("a")
+	if left := time.Until(rec.ExpiresAt); left <= 0 || left > time.Minute {
+		t.Fatalf("ExpiresAt = %v, want about a minute from now", rec.ExpiresAt)
+	}
+	if w := doJSON(t, "POST", "/add", AddRequest{ID: "b", Text: "x", TTL: -1}); w.Code != 400 {
+		t.Fatalf("negative ttl: got %d, want 400", w.Code)
+	}
+}
+
+func TestQueryNamespaces(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("a", Vector{1, 0}, nil, "one")
+	db.AddItem("b", Vector{1, 0.1}, nil, "two")
+	db.AddItem("c", Vector{1, 0.2}, nil, "three")
+
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "x", Namespaces: []string{"one", "three"}})
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 2 || resp.Results[0].ID != "a" || resp.Results[1].ID != "c" {
+		t.Fatalf("namespaces query: %s", w.Body)
+	}
+}
+
+func TestAddAndQueryTags(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	for _, req := range []AddRequest{
+		{ID: "a", Text: "a", Tags: map[string][]string{"tags": {"red", "blue"}}},
+		{ID: "b", Text: "b", Tags: map[string][]string{"tags": {"green"}}},
+		{ID: "c", Text: "c"},
+	} {
+		if w := doJSON(t, "POST", "/add", req); w.Code != 200 {
+			t.Fatalf("add %s: %d %s", req.ID, w.Code, w.Body)
+		}
+	}
+
+	filter := &Filter{Conditions: []Condition{{Field: "tags", Op: OpContainsAny, Values: []string{"blue", "yellow"}}}}
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "x", Filters: filter})
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 1 || resp.Results[0].ID != "a" || !slices.Equal(resp.Results[0].Tags["tags"], []string{"red", "blue"}) {
+		t.Fatalf("tag query: %s", w.Body)
+	}
+}
+
+func TestQueryIDScope(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("user1:a", Vector{1, 0}, nil, "")
+	db.AddItem("user1:b", Vector{1, 0.1}, nil, "")
+	db.AddItem("user2:a", Vector{1, 0.2}, nil, "")
+
+	for _, tc := range []struct {
+		body map[string]any
+		want []string
+	}{
+		{map[string]any{"text": "q", "id_prefix": "user1:"}, []string{"user1:a", "user1:b"}},
+		{map[string]any{"text": "q", "ids": []string{"user2:a"}}, []string{"user2:a"}},
+		{map[string]any{"text": "q", "ids": []string{}}, []string{}},
+	} {
+		w := doJSON(t, "POST", "/query", tc.body)
+		var resp struct{ Results []DetailedResult }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		got := []string{}
+		for _, res := range resp.Results {
+			got = append(got, res.ID)
+		}
+		if w.Code != 200 || !slices.Equal(got, tc.want) {
+			t.Errorf("%v: %d %s, want %v", tc.body, w.Code, w.Body, tc.want)
+		}
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	meta := map[string]string{"title": "T", "url": "http://x", "body": strings.Repeat("blob ", 100)}
+	db.AddRecord(Record{ID: "a", Vector: Vector{1, 0}, Metadata: meta, Tags: map[string][]string{"title": {"tagged"}, "topics": {"go"}}})
+
+	for _, tc := range []struct {
+		body     map[string]any
+		wantMeta []string
+		wantTags []string
+	}{
+		{map[string]any{"text": "q"}, []string{"body", "title", "url"}, []string{"title", "topics"}},
+		{map[string]any{"text": "q", "fields": []string{"title", "url", "missing"}}, []string{"title", "url"}, []string{"title"}},
+		{map[string]any{"text": "q", "fields": []string{}}, []string{}, []string{}},
+	} {
+		w := doJSON(t, "POST", "/query", tc.body)
+		var resp struct{ Results []DetailedResult }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != 200 || len(resp.Results) != 1 {
+			t.Fatalf("%v: %d %s", tc.body, w.Code, w.Body)
+		}
+		res := resp.Results[0]
+		if got := slices.Sorted(maps.Keys(res.Metadata)); !slices.Equal(got, tc.wantMeta) {
+			t.Errorf("%v: metadata keys %v, want %v", tc.body, got, tc.wantMeta)
+		}
+		if got := slices.Sorted(maps.Keys(res.Tags)); !slices.Equal(got, tc.wantTags) {
+			t.Errorf("%v: tag keys %v, want %v", tc.body, got, tc.wantTags)
+		}
+	}
+	// Projecting leaves the stored record whole.
+	if rec, _ := db.Get("a"); len(rec.Metadata) != 3 || len(rec.Tags) != 2 {
+		t.Errorf("stored record trimmed: %+v", rec)
+	}
+}
+
+func TestQueryIncludeVectors(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	stored := map[string]Vector{"a": {3, 4}, "b": {1, 2}}
+	for id, v := range stored {
+		db.AddItem(id, slices.Clone(v), nil, "")
+	}
+
+	for _, include := range []bool{false, true} {
+		w := doJSON(t, "POST", "/query", map[string]any{"text": "q", "k": 2, "include_vectors": include})
+		var resp struct{ Results []DetailedResult }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != 200 || len(resp.Results) != 2 {
+			t.Fatalf("include_vectors=%t: %d %s", include, w.Code, w.Body)
+		}
+		for _, res := range resp.Results {
+			switch {
+			case !include && res.Vector != nil:
+				t.Errorf("%s: vector %v returned unasked", res.ID, res.Vector)
+			case include && !approxEqual(res.Vector, stored[res.ID]):
+				t.Errorf("%s: vector %v, want %v as stored", res.ID, res.Vector, stored[res.ID])
+			}
+		}
+	}
+}
+
+func TestQueryPrecision(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	// a and b round to the same score; a ranks first on the full one.
+	db.AddItem("b", Vector{1, 0.602}, nil, "")
+	db.AddItem("a", Vector{1, 0.601}, nil, "")
+	db.AddItem("c", Vector{1, 0.9}, nil, "")
+
+	query := func(body map[string]any) (int, []DetailedResult, string) {
+		t.Helper()
+		w := doJSON(t, "POST", "/query", body)
+		var resp struct {
+			Results       []DetailedResult
+			NextPageToken string `json:"next_page_token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Results, resp.NextPageToken
+	}
+
+	code, got, token := query(map[string]any{"text": "q", "k": 2, "precision": 2})
+	if code != 200 || len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Fatalf("rounded query: %d %+v", code, got)
+	}
+	for _, res := range got {
+		if res.Score != 0.86 || res.Distance == nil || *res.Distance != 0.14 {
+			t.Errorf("%s: score %v, distance %v, want 0.86 and 0.14", res.ID, res.Score, res.Distance)
+		}
+	}
+	// The token keeps the full score, so the next page starts after b.
+	if code, got, _ = query(map[string]any{"text": "q", "k": 2, "precision": 2, "page_token": token}); code != 200 || len(got) != 1 || got[0].ID != "c" || got[0].Score != 0.74 {
+		t.Fatalf("next page: %d %+v", code, got)
+	}
+
+	if _, got, _ = query(map[string]any{"text": "q", "k": 1}); len(got) != 1 || got[0].Score == 0.86 {
+		t.Errorf("unrounded score = %+v", got)
+	}
+	if code, _, _ := query(map[string]any{"text": "q", "precision": -1}); code != 400 {
+		t.Errorf("negative precision: got %d, want 400", code)
+	}
+}
+
+func TestPatchVector(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddRecord(Record{ID: "a", Vector: Vector{1, 0}, Metadata: map[string]string{"k": "v"}})
+
+	if w := doJSON(t, "PATCH", "/vector/a", map[string]any{"vector": Vector{0, 3}}); w.Code != 200 {
+		t.Fatalf("patch: %d %s", w.Code, w.Body)
+	}
+	if rec, _ := db.Get("a"); !slices.Equal(rec.Vector, Vector{0, 3}) || rec.Metadata["k"] != "v" {
+		t.Errorf("after patch: %+v", rec)
+	}
+	if w := doJSON(t, "PATCH", "/vector/missing", map[string]any{"vector": Vector{0, 3}}); w.Code != 404 {
+		t.Errorf("unknown ID: %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, "PATCH", "/vector/a", map[string]any{"vector": Vector{1, 2, 3}}); w.Code != 400 {
+		t.Errorf("wrong dimension: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestGetItem(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddRecord(Record{ID: "a", Vector: Vector{3, 4}, Metadata: map[string]string{"k": "v"}, Tags: map[string][]string{"t": {"x"}}})
+
+	w := doJSON(t, "GET", "/item/a", nil)
+	var rec Record
+	json.Unmarshal(w.Body.Bytes(), &rec)
+	if w.Code != 200 || rec.ID != "a" || rec.Metadata["k"] != "v" || rec.Tags["t"][0] != "x" || !approxEqual(rec.Vector, Vector{3, 4}) {
+		t.Fatalf("get: %d %s", w.Code, w.Body)
+	}
+
+	w = doJSON(t, "GET", "/item/a?include_vector=false", nil)
+	var light map[string]any
+	json.Unmarshal(w.Body.Bytes(), &light)
+	if _, ok := light["vector"]; w.Code != 200 || ok || light["id"] != "a" {
+		t.Fatalf("get without vector: %d %s", w.Code, w.Body)
+	}
+
+	if w := doJSON(t, "GET", "/item/missing", nil); w.Code != 404 {
+		t.Fatalf("missing id: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("a", Vector{1, 0}, nil, "")
+	db.AddItem("b", Vector{0, 1}, nil, "")
+
+	if w := doJSON(t, "GET", "/list?limit=1&offset=1", nil); w.Code != 200 || !strings.Contains(w.Body.String(), `"id":"b"`) {
+		t.Fatalf("second page: %d %s", w.Code, w.Body)
+	}
+	for _, query := range []string{"limit=0", "limit=-1", "offset=-1", "limit=x"} {
+		w := doJSON(t, "GET", "/list?"+query, nil)
+		if w.Code != 400 || !strings.Contains(w.Body.String(), "limit must be a positive integer") {
+			t.Errorf("%s: %d %s", query, w.Code, w.Body)
+		}
+	}
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("a1", Vector{1, 0}, nil, "tenant-a")
+	db.AddItem("a2", Vector{1, 0.1}, nil, "tenant-a")
+	db.AddItem("b1", Vector{1, 0.2}, nil, "tenant-b")
+
+	w := doJSON(t, "DELETE", "/namespace/tenant-a", nil)
+	var resp struct{ Deleted, Total int }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp.Deleted != 2 || resp.Total != 1 {
+		t.Fatalf("drop namespace: %d %s", w.Code, w.Body)
+	}
+	if _, ok := db.Stats().Namespaces["tenant-a"]; ok {
+		t.Fatal("dropped namespace still listed in stats")
+	}
+
+	var results struct{ Results []DetailedResult }
+	w = doJSON(t, "POST", "/query", QueryRequest{Text: "x", Namespace: "tenant-a"})
+	if json.Unmarshal(w.Body.Bytes(), &results); w.Code != 200 || len(results.Results) != 0 {
+		t.Fatalf("query in dropped namespace: %d %s", w.Code, w.Body)
+	}
+	w = doJSON(t, "POST", "/query", QueryRequest{Text: "x", Namespace: "tenant-b"})
+	if json.Unmarshal(w.Body.Bytes(), &results); len(results.Results) != 1 || results.Results[0].ID != "b1" {
+		t.Fatalf("query in other namespace: %s", w.Body)
+	}
+	checkIndexes(t, db)
+
+	if w := doJSON(t, "DELETE", "/namespace/bad%20name", nil); w.Code != 400 {
+		t.Fatalf("invalid namespace: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestSimilarEndpoint(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("a", Vector{1, 0}, nil, "")
+	db.AddItem("b", Vector{1, 0.1}, nil, "")
+	db.AddItem("c", Vector{0, 1}, nil, "")
+
+	w := doJSON(t, "GET", "/similar/a?k=1", nil)
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || len(resp.Results) != 1 || resp.Results[0].ID != "b" {
+		t.Fatalf("similar: %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, "GET", "/similar/nope", nil); w.Code != 404 {
+		t.Fatalf("unknown id: %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, "GET", "/similar/a?k=-1", nil); w.Code != 400 {
+		t.Fatalf("bad k: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestMaxDim(t *testing.T) {
+	useStore(t, NewVectorStore())
+	prev := cfg
+	cfg.MaxDim = 16
+	t.Cleanup(func() { cfg = prev })
+	db.MaxDim = cfg.MaxDim
+
+	w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: make(Vector, 17)})
+	if w.Code != 400 || !strings.Contains(w.Body.String(), ErrVectorTooLarge.Error()) {
+		t.Errorf("vector just over the cap: %d %s", w.Code, w.Body)
+	}
+	// Far past the cap the body is cut off while being read.
+	huge := `{"vector": [` + strings.Repeat("0.5,", 1<<20) + `0.5]}`
+	req := httptest.NewRequest("POST", "/query_vector", strings.NewReader(huge))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	setupRouter().ServeHTTP(rec, req)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "too large") {
+		t.Errorf("huge vector: %d %s", rec.Code, rec.Body)
+	}
+	if err := db.AddItem("a", make(Vector, 17), nil, ""); !errors.Is(err, ErrVectorTooLarge) {
+		t.Errorf("AddItem = %v, want ErrVectorTooLarge", err)
+	}
+	if err := db.AddRecord(Record{ID: "s", Sparse: &SparseVector{Dim: 1 << 30, Indices: []int32{0}, Values: []float32{1}}}); !errors.Is(err, ErrVectorTooLarge) {
+		t.Errorf("sparse AddRecord = %v, want ErrVectorTooLarge", err)
+	}
+	if db.Dim != 0 {
+		t.Errorf("rejected inserts fixed Dim at %d", db.Dim)
+	}
+	if err := db.AddItem("a", Vector{1, 0}, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if w := doJSON(t, "PATCH", "/vector/a", map[string]any{"vector": make(Vector, 17)}); w.Code != 400 || !strings.Contains(w.Body.String(), ErrVectorTooLarge.Error()) {
+		t.Errorf("oversized update: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestQueryPaging(t *testing.T) {
+	useStore(t, NewVectorStore())
+	prev := cfg
+	cfg.MaxK = 4
+	t.Cleanup(func() { cfg = prev })
+	for i := range 10 {
+		db.AddItem(fmt.Sprintf("id-%d", i), Vector{1, float32(i) / 10}, nil, "")
+	}
+
+	if w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: Vector{1, 0}, QueryRequest: QueryRequest{K: 5}}); w.Code != 400 {
+		t.Fatalf("k above the cap: %d %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: Vector{1, 0}, QueryRequest: QueryRequest{K: 4, PageToken: "!"}}); w.Code != 400 {
+		t.Fatalf("bad token: %d %s", w.Code, w.Body)
+	}
+
+	var ids []string
+	token := ""
+	for range 5 {
+		w := doJSON(t, "POST", "/query_vector", VectorQueryRequest{Vector: Vector{1, 0}, QueryRequest: QueryRequest{K: 4, PageToken: token}})
+		var resp struct {
+			Results       []DetailedResult
+			NextPageToken string `json:"next_page_token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		for _, r := range resp.Results {
+			ids = append(ids, r.ID)
+		}
+		if token = resp.NextPageToken; token == "" {
+			break
+		}
+	}
+	want := []string{"id-0", "id-1", "id-2", "id-3", "id-4", "id-5", "id-6", "id-7", "id-8", "id-9"}
+	if !slices.Equal(ids, want) {
+		t.Fatalf("paged ids = %v, want %v", ids, want)
+	}
+}
+
+func TestNamespaceDefaultAndValidation(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	prev := cfg
+	cfg.DefaultNamespace = "general"
+	t.Cleanup(func() { cfg = prev })
+
+	if w := doJSON(t, "POST", "/add", AddRequest{ID: "a", Text: "x"}); w.Code != 200 {
+		t.Fatalf("add: %d %s", w.Code, w.Body)
+	}
+	doJSON(t, "POST", "/batch_add", []AddRequest{{ID: "b", Text: "y"}, {ID: "c", Text: "z", Namespace: "own"}, {ID: "d", Text: "z", Namespace: "bad ns"}})
+	for id, want := range map[string]string{"a": "general", "b": "general", "c": "own"} {
+		if rec, _ := recordByID(id); rec.Namespace != want {
+			t.Fatalf("%s stored in %q, want %q", id, rec.Namespace, want)
+		}
+	}
+	if db.Version("d") != 0 {
+		t.Fatal("record with an invalid namespace was stored")
+	}
+
+	for _, ns := range []string{"with space", "a/b", "ünï", strings.Repeat("n", 65), "new\nline"} {
+		if w := doJSON(t, "POST", "/add", AddRequest{ID: "e", Text: "x", Namespace: ns}); w.Code != 400 {
+			t.Fatalf("add to %q: %d %s", ns, w.Code, w.Body)
+		}
+		if w := doJSON(t, "POST", "/query", QueryRequest{Text: "x", Namespaces: []string{"general", ns}}); w.Code != 400 {
+			t.Fatalf("query of %q: %d %s", ns, w.Code, w.Body)
+		}
+	}
+
+	// An empty query namespace still searches everything.
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "x", K: 10})
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Results) != 3 {
+		t.Fatalf("query across namespaces: %s", w.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, registered with the default registry and served on
+// /metrics.
+var (
+	opsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vectordb_operations_total",
+		Help: "API operations served, by operation.",
+	}, []string{"op"})
+
+	embeddingErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vectordb_embedding_errors_total",
+		Help: "Embedding requests that failed after retries.",
+	})
+
+	queryCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vectordb_query_cache_hits_total",
+		Help: "Queries answered from the query cache.",
+	})
+
+	queryCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vectordb_query_cache_misses_total",
+		Help: "Cacheable queries that had to embed and search.",
+	})
+
+	embedCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vectordb_embedding_cache_hits_total",
+		Help: "Embeddings served from the embedding cache; the hit rate is hits / (hits + misses).",
+	})
+
+	embedCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vectordb_embedding_cache_misses_total",
+		Help: "Embeddings the embedding cache had to request from the provider.",
+	})
+
+	evictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vectordb_evictions_total",
+		Help: "Records evicted to stay within MAX_RECORDS.",
+	})
+
+	searchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "vectordb_search_duration_seconds",
+		Help:    "Time spent in VectorStore searches.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), // 100µs to ~26s
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "vectordb_records",
+		Help: "Records currently in the store.",
+	}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Len())
+	})
+)
+
+// countOp records one served API operation.
+func countOp(op string) { opsTotal.WithLabelValues(op).Inc() }
+
+// observeSearch records a search that started at start; use with defer.
+func observeSearch(start time.Time) { searchDuration.Observe(time.Since(start).Seconds()) }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+
+	doJSON(t, "POST", "/add", AddRequest{ID: "a", Text: "hello"})
+	doJSON(t, "POST", "/add", AddRequest{ID: "b", Text: "world"})
+	doJSON(t, "POST", "/query", QueryRequest{Text: "hello"})
+	doJSON(t, "DELETE", "/delete/a", nil)
+
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusBadRequest)
+	})
+	doJSON(t, "POST", "/query", QueryRequest{Text: "hello"})
+
+	w := doJSON(t, "GET", "/metrics", nil)
+	if w.Code != 200 {
+		t.Fatalf("/metrics = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`vectordb_operations_total{op="add"}`,
+		`vectordb_operations_total{op="query"}`,
+		`vectordb_operations_total{op="delete"}`,
+		"vectordb_embedding_errors_total",
+		"vectordb_search_duration_seconds_bucket",
+		"vectordb_search_duration_seconds_count",
+		"vectordb_records 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
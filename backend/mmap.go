@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// Memory-mapped snapshots. Reading a binary snapshot normally copies every
+// vector out of the file into the heap. With MmapSnapshots, Load maps the
+// file instead and points each record's Vector and Quantized codes
+// straight at the mapping, which the layout's 4-byte alignment allows: no
+// copy is made, startup allocates only the headers, and the vectors live
+// in the page cache, where the kernel pages them in on first touch and
+// may drop them again under memory pressure. The mapping is private, so
+// writes to a mapped vector stay in memory, and it outlives renames, so
+// saving over the file is safe. It is never unmapped, as records handed
+// out may still point into it; Load is meant to run once per store.
+//
+// Only little-endian hosts can read the floats in place. Elsewhere, and
+// for JSON or unreadable files, Load reads the file as usual.
+
+// errMmapUnsupported is returned by mapFile where mapping is unavailable.
+var errMmapUnsupported = errors.New("memory-mapped snapshots are not supported on this platform")
+
+var hostLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// readSnapshotFile reads the snapshot at path, mapping it into memory if
+// mmap is set and the file allows it.
+func readSnapshotFile(path string, mmap bool) ([]Record, snapshotMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, snapshotMeta{}, err
+	}
+	defer f.Close()
+	if mmap && hostLittleEndian {
+		data, err := mapFile(f)
+		switch {
+		case err == nil && bytes.HasPrefix(data, snapshotMagic):
+			records, meta, err := readMappedSnapshot(data)
+			if err != nil {
+				return nil, snapshotMeta{}, fmt.Errorf("reading mapped snapshot: %w", err)
+			}
+			return records, meta, nil
+		case err == nil:
+			// A legacy JSON file gains nothing from the mapping.
+			records, meta, err := readSnapshot(bytes.NewReader(data))
+			unmapFile(data)
+			return records, meta, err
+		case !errors.Is(err, errMmapUnsupported):
+			return nil, snapshotMeta{}, err
+		}
+	}
+	return readSnapshot(f)
+}
+
+// readMappedSnapshot decodes a binary snapshot held in data, the way
+// readBinarySnapshot does, with the vectors and codes aliasing data.
+func readMappedSnapshot(data []byte) ([]Record, snapshotMeta, error) {
+	var meta snapshotMeta
+	off := 0
+	next := func(n int) ([]byte, error) {
+		if n < 0 || n > len(data)-off {
+			return nil, fmt.Errorf("truncated at offset %d", off)
+		}
+		b := data[off : off+n]
+		off += n
+		return b, nil
+	}
+	u32 := func() (int, error) {
+		b, err := next(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.LittleEndian.Uint32(b)), nil
+	}
+
+	hdr, err := next(len(snapshotMagic) + 1)
+	if err != nil {
+		return nil, meta, err
+	}
+	version := hdr[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return nil, meta, fmt.Errorf("unsupported version %d", version)
+	}
+	b, err := next(8)
+	if err != nil {
+		return nil, meta, err
+	}
+	count := binary.LittleEndian.Uint64(b)
+
+	records := make([]Record, 0, min(count, 1<<20))
+	for i := uint64(0); i < count; i++ {
+		n, err := u32()
+		if err != nil {
+			return nil, meta, err
+		}
+		header, err := next(n)
+		if err != nil {
+			return nil, meta, err
+		}
+		var rec Record
+		if err := json.Unmarshal(header, &rec); err != nil {
+			return nil, meta, fmt.Errorf("record %d: %w", i, err)
+		}
+		if _, err := next((4 - off%4) % 4); err != nil {
+			return nil, meta, err
+		}
+
+		dim, err := u32()
+		if err != nil {
+			return nil, meta, err
+		}
+		vec, err := next(4 * dim)
+		if err != nil {
+			return nil, meta, err
+		}
+		if dim > 0 {
+			rec.Vector = unsafe.Slice((*float32)(unsafe.Pointer(&vec[0])), dim)
+		}
+		nCodes, err := u32()
+		if err != nil {
+			return nil, meta, err
+		}
+		codes, err := next(nCodes)
+		if err != nil {
+			return nil, meta, err
+		}
+		if nCodes > 0 {
+			rec.Quantized = unsafe.Slice((*int8)(unsafe.Pointer(&codes[0])), nCodes)
+		}
+		records = append(records, rec)
+	}
+
+	if version >= 2 {
+		n, err := u32()
+		if err != nil {
+			return nil, meta, err
+		}
+		trailer, err := next(n)
+		if err != nil {
+			return nil, meta, err
+		}
+		if err := json.Unmarshal(trailer, &meta); err != nil {
+			return nil, meta, fmt.Errorf("trailer: %w", err)
+		}
+	}
+	return records, meta, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func mapFile(f *os.File) ([]byte, error) { return nil, errMmapUnsupported }
+
+func unmapFile(data []byte) {}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Multi-vector queries, for query expansion: the query is given as several
+// vectors, e.g. the embeddings of a question and a few rephrasings, and
+// each record is scored against all of them at once.
+
+// QueryCombine is how SearchMulti combines the scores of several queries.
+type QueryCombine string
+
+const (
+	// CombineMean searches once with the mean of the queries. Under the
+	// similarity metrics and MetricAngular each is normalized first, so
+	// every phrasing weighs the same; under MetricL2 it is their plain
+	// centroid.
+	CombineMean QueryCombine = "mean"
+	// CombineMax ranks each record by its best score against any of the
+	// queries, which favours records close to one phrasing over records
+	// half-way between them.
+	CombineMax QueryCombine = "max"
+)
+
+func (c QueryCombine) validate() error {
+	switch c {
+	case "", CombineMean, CombineMax:
+		return nil
+	}
+	return fmt.Errorf("unknown query combination %q", c)
+}
+
+// errPagedMax rejects the options a max combination cannot honour: a
+// record's place depends on the query it scores best against, which a
+// cursor or boost over each query's own ranking does not see.
+var errPagedMax = errors.New(`paging and boost cannot be combined with "max" query combination`)
+
+// meanQuery returns the query CombineMean searches with.
+func (vs *VectorStore) meanQuery(queries []Vector) (Vector, error) {
+	if len(queries) == 0 {
+		return nil, errors.New("no query vectors")
+	}
+	mean := make(Vector, len(queries[0]))
+	for i, q := range queries {
+		if len(q) != len(mean) {
+			return nil, fmt.Errorf("query %d: %w: got %d, want %d", i, ErrDimensionMismatch, len(q), len(mean))
+		}
+		if vs.Metric.HigherIsBetter() || vs.Metric == MetricAngular {
+			q = Normalize(q)
+		}
+		for j, x := range q {
+			mean[j] += x / float32(len(queries))
+		}
+	}
+	return mean, nil
+}
+
+// SearchMulti returns the top opts.K matches for several queries combined
+// by combine, CombineMean when empty. Under CombineMax the scores are
+// those against the best-matching query, and opts.After and opts.Boost
+// are rejected; opts.Explain and opts.OnCandidates are ignored.
+func (vs *VectorStore) SearchMulti(queries []Vector, combine QueryCombine, opts SearchOptions) ([]SearchResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	results, err := vs.searchMultiLocked(queries, combine, opts)
+	if err != nil {
+		return nil, err
+	}
+	vs.touch(results)
+	return results, nil
+}
+
+// SearchMultiDetailed is SearchMulti with metadata joined under the same
+// read lock, as in SearchDetailed.
+func (vs *VectorStore) SearchMultiDetailed(queries []Vector, combine QueryCombine, opts SearchOptions) ([]DetailedResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	results, err := vs.searchMultiLocked(queries, combine, opts)
+	if err != nil {
+		return nil, err
+	}
+	vs.touch(results)
+	detailed := vs.detailLocked(results, opts)
+	normalizeScores(detailed, opts.NormalizeScores, vs.Metric.HigherIsBetter())
+	return detailed, nil
+}
+
+func (vs *VectorStore) searchMultiLocked(queries []Vector, combine QueryCombine, opts SearchOptions) ([]SearchResult, error) {
+	if err := combine.validate(); err != nil {
+		return nil, err
+	}
+	opts.Explain, opts.OnCandidates = nil, nil
+	if combine != CombineMax {
+		mean, err := vs.meanQuery(queries)
+		if err != nil {
+			return nil, err
+		}
+		q, err := vs.prepareQuery(mean, opts)
+		if err != nil {
+			return nil, err
+		}
+		return vs.searchLocked(q, opts), nil
+	}
+
+	if opts.After != nil || opts.Boost != nil {
+		return nil, errPagedMax
+	}
+	if len(queries) == 0 {
+		return nil, errors.New("no query vectors")
+	}
+	// A record in the combined top K is in the top K of the query it
+	// scores best against, so merging the per-query results is exact.
+	best := make(map[string]SearchResult)
+	h := NewResultHeap(vs.Metric.HigherIsBetter())
+	for i, query := range queries {
+		q, err := vs.prepareQuery(query, opts)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		for _, res := range vs.searchLocked(q, opts) {
+			if prev, ok := best[res.ID]; !ok || h.better(res, prev) {
+				best[res.ID] = res
+			}
+		}
+	}
+	for _, res := range best {
+		h.Offer(res, opts.K)
+	}
+	return h.Drain(), nil
+}
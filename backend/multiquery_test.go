@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// expansionStore holds a record half-way between the x and y axes and one
+// close to each.
+func expansionStore() *VectorStore {
+	store := NewVectorStore()
+	store.AddItem("mid", Vector{1, 1}, nil, "")
+	store.AddItem("x", Vector{1, 0.05}, nil, "")
+	store.AddItem("y", Vector{0.05, 1}, nil, "")
+	store.AddItem("neg", Vector{-1, -0.5}, nil, "")
+	return store
+}
+
+func TestSearchMulti(t *testing.T) {
+	store := expansionStore()
+	queries := []Vector{{1, 0}, {0, 3}}
+
+	// The mean query points at mid; the max favours the records right
+	// on one of the axes.
+	mean, err := store.SearchMulti(queries, CombineMean, SearchOptions{K: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(mean); !reflect.DeepEqual(got, []string{"mid", "x", "y"}) {
+		t.Errorf("mean = %v", got)
+	}
+	maxed, err := store.SearchMulti(queries, CombineMax, SearchOptions{K: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(maxed); !reflect.DeepEqual(got, []string{"x", "y", "mid"}) {
+		t.Errorf("max = %v", got)
+	}
+	// Each max score is the record's best against any one query.
+	for _, res := range maxed {
+		want := float32(0)
+		for _, q := range queries {
+			single, _ := store.SearchWithOptions(q, SearchOptions{K: 4})
+			for _, r := range single {
+				if r.ID == res.ID && r.Score > want {
+					want = r.Score
+				}
+			}
+		}
+		if res.Score != want {
+			t.Errorf("%s scored %v, want %v", res.ID, res.Score, want)
+		}
+	}
+
+	// A single query is an ordinary search either way.
+	plain := mustSearch(t, store, Vector{1, 0}, 3)
+	for _, combine := range []QueryCombine{CombineMean, CombineMax} {
+		got, _ := store.SearchMulti([]Vector{{1, 0}}, combine, SearchOptions{K: 3})
+		if !reflect.DeepEqual(got, plain) {
+			t.Errorf("%s of one query = %v, want %v", combine, got, plain)
+		}
+	}
+
+	if _, err := store.SearchMulti(queries, "median", SearchOptions{K: 3}); err == nil {
+		t.Error("unknown combination accepted")
+	}
+	if _, err := store.SearchMulti(nil, CombineMean, SearchOptions{K: 3}); err == nil {
+		t.Error("no queries accepted")
+	}
+	if _, err := store.SearchMulti([]Vector{{1, 0}, {1, 0, 0}}, CombineMean, SearchOptions{K: 3}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("mixed dimensions = %v, want ErrDimensionMismatch", err)
+	}
+	_, err = store.SearchMulti(queries, CombineMax, SearchOptions{K: 3, After: &maxed[0]})
+	if !errors.Is(err, errPagedMax) {
+		t.Errorf("paged max = %v, want errPagedMax", err)
+	}
+}
+
+func TestQueryTexts(t *testing.T) {
+	useStore(t, expansionStore())
+	vectors := map[string]Vector{"across": {1, 0}, "up": {0, 1}}
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Prompt string }
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]Vector{"embedding": vectors[req.Prompt]})
+	})
+
+	for combine, want := range map[QueryCombine][]string{CombineMean: {"mid", "x", "y"}, CombineMax: {"x", "y", "mid"}} {
+		w := doJSON(t, "POST", "/query", QueryRequest{Text: "across", Texts: []string{"up"}, Combine: combine, K: 3})
+		var resp struct{ Results []DetailedResult }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		ids := make([]string, len(resp.Results))
+		for i, r := range resp.Results {
+			ids[i] = r.ID
+		}
+		if w.Code != 200 || !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: %d %s", combine, w.Code, w.Body)
+		}
+	}
+
+	if w := doJSON(t, "POST", "/query", QueryRequest{Texts: []string{"up"}, Combine: "median"}); w.Code != 400 {
+		t.Errorf("unknown combination: %d %s", w.Code, w.Body)
+	}
+}
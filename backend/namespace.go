@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+// namespacePattern limits namespaces to characters that are safe as map
+// keys, in log lines and in URLs.
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+var errInvalidNamespace = errors.New("namespace must be 1-64 letters, digits, '_', '-' or '.'")
+
+// checkNamespace rejects a namespace outside namespacePattern. Empty is
+// allowed: queries read it as every namespace.
+func checkNamespace(ns string) error {
+	if ns != "" && !namespacePattern.MatchString(ns) {
+		return errInvalidNamespace
+	}
+	return nil
+}
+
+// storeNamespace returns the namespace a record is written to: ns, or
+// cfg.DefaultNamespace when ns is empty.
+func storeNamespace(ns string) (string, error) {
+	if ns == "" {
+		return cfg.DefaultNamespace, nil
+	}
+	return ns, checkNamespace(ns)
+}
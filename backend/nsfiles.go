@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Per-namespace files. With PerNamespaceFiles set, Save and Load take a
+// directory instead of a file: each namespace is written as its own
+// binary snapshot (see persist.go), and manifest.json lists them along
+// with the store-wide state, the PQ codebooks and projection matrix. A
+// tenant can then be backed up or removed on its own, and LoadNamespaces
+// loads just some of them.
+//
+// Each save writes the namespace files under a new generation number and
+// then replaces the manifest, so a crash mid-save leaves the previous
+// manifest pointing at the previous files; the files it no longer lists
+// are removed afterwards.
+
+const manifestName = "manifest.json"
+
+// ErrNamespaceNotLoaded rejects writes to a namespace that LoadNamespaces
+// left on disk: saving them would overwrite its file.
+var ErrNamespaceNotLoaded = errors.New("namespace not loaded")
+
+// errPartialWAL refuses to replay a log onto a partial load, since it may
+// hold writes to the namespaces left out. Close and CompactWAL empty it.
+var errPartialWAL = errors.New("the write-ahead log is not empty; load every namespace to replay it")
+
+// dirManifest is manifest.json.
+type dirManifest struct {
+	Generation uint64 `json:"generation"`
+	// Namespaces maps each namespace, "" included, to its file.
+	Namespaces map[string]dirNamespace `json:"namespaces"`
+	Meta       snapshotMeta            `json:"meta"`
+}
+
+type dirNamespace struct {
+	File    string `json:"file"`
+	Records int    `json:"records"`
+}
+
+// namespaceFile names the file of ns for a generation. Namespaces are
+// restricted to file-name-safe characters (see namespacePattern); the
+// prefix keeps a namespace literally called "default" apart from "".
+func namespaceFile(ns string, gen uint64) string {
+	if ns == "" {
+		return fmt.Sprintf("default-%d.vsdb", gen)
+	}
+	return fmt.Sprintf("ns-%s-%d.vsdb", ns, gen)
+}
+
+func readManifest(dir string) (dirManifest, error) {
+	var m dirManifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("reading %s: %w", manifestName, err)
+	}
+	return m, nil
+}
+
+// readNamespaceDir loads the namespaces of the directory snapshot in dir,
+// or only those in only when it is not empty, and returns the ones it
+// skipped. A namespace the manifest does not list is simply empty, and a
+// missing manifest is an empty store.
+func readNamespaceDir(dir string, only []string, mmap bool) (records []Record, meta snapshotMeta, skipped map[string]bool, err error) {
+	records = []Record{}
+	m, err := readManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, meta, nil, nil
+	}
+	if err != nil {
+		return nil, meta, nil, err
+	}
+	for ns, entry := range m.Namespaces {
+		if len(only) > 0 && !slices.Contains(only, ns) {
+			if skipped == nil {
+				skipped = make(map[string]bool)
+			}
+			skipped[ns] = true
+			continue
+		}
+		part, _, err := readSnapshotFile(filepath.Join(dir, entry.File), mmap)
+		if err != nil {
+			return nil, meta, nil, fmt.Errorf("namespace %q: %w", ns, err)
+		}
+		records = append(records, part...)
+	}
+	return records, m.Meta, skipped, nil
+}
+
+// saveNamespaceDirLocked writes the store to dir as a directory snapshot.
+// Namespaces on disk that Load left out keep their files. Callers hold at
+// least the read lock and saveMu.
+func (vs *VectorStore) saveNamespaceDirLocked(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	prev, err := readManifest(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	byNamespace := make(map[string][]Record)
+	for _, rec := range vs.liveRecordsLocked() {
+		byNamespace[rec.Namespace] = append(byNamespace[rec.Namespace], rec)
+	}
+	next := dirManifest{
+		Generation: prev.Generation + 1,
+		Namespaces: make(map[string]dirNamespace),
+		Meta:       snapshotMeta{PQ: vs.pq, Projection: vs.proj},
+	}
+	for ns, entry := range prev.Namespaces {
+		if vs.unloaded[ns] {
+			next.Namespaces[ns] = entry
+		}
+	}
+	for ns, records := range byNamespace {
+		name := namespaceFile(ns, next.Generation)
+		err := writeFileAtomic(filepath.Join(dir, name), func(w io.Writer) error {
+			return writeSnapshot(w, records, snapshotMeta{})
+		})
+		if err != nil {
+			return err
+		}
+		next.Namespaces[ns] = dirNamespace{File: name, Records: len(records)}
+	}
+
+	data, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(dir, manifestName), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for ns, entry := range prev.Namespaces {
+		if cur, ok := next.Namespaces[ns]; !ok || cur.File != entry.File {
+			if err := os.Remove(filepath.Join(dir, entry.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("snapshot: removing %s: %v", entry.File, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkLoadedLocked rejects a write to a namespace Load left on disk.
+func (vs *VectorStore) checkLoadedLocked(ns string) error {
+	if vs.unloaded[ns] {
+		return fmt.Errorf("%w: %q", ErrNamespaceNotLoaded, ns)
+	}
+	return nil
+}
+
+// empty reports whether the write-ahead log holds no operations.
+func (l *writeAheadLog) empty() (bool, error) {
+	fi, err := l.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() == 0 && l.w.Buffered() == 0, nil
+}
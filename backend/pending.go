@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pending embeddings. With PENDING_QUEUE_PATH set, an /add whose text the
+// embedder fails on with a transient error, such as a refused connection
+// or a 5xx, is not lost: the request is queued in that file and
+// answered 202, and a background worker retries the embedding every
+// PENDING_RETRY_INTERVAL, storing the record once it succeeds. Until then
+// the record is not in the store, so searches and Len leave it out; GET
+// /pending lists what is waiting. Any later write to or delete of the
+// same ID, over HTTP or gRPC, supersedes the queued request, as do bulk
+// deletes matching it. Conditional adds (If-Match) are never queued, since
+// the version they name may be stale by the retry.
+
+// pending is the queue, or nil when it is disabled.
+var pending *pendingQueue
+
+// pendingItem is one queued add.
+type pendingItem struct {
+	Request   AddRequest `json:"request"`
+	QueuedAt  time.Time  `json:"queued_at"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// pendingQueue holds the queued adds in order, rewriting path after every
+// change. Its methods are safe for concurrent use and, on a nil queue,
+// do nothing.
+type pendingQueue struct {
+	mu    sync.Mutex
+	path  string
+	items []pendingItem
+}
+
+// openPendingQueue loads the queue saved at path, if any.
+func openPendingQueue(path string) (*pendingQueue, error) {
+	q := &pendingQueue{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.items); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *pendingQueue) saveLocked() error {
+	return writeFileAtomic(q.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(q.items)
+	})
+}
+
+// indexLocked returns the position of id's entry, or -1.
+func (q *pendingQueue) indexLocked(id string) int {
+	for i, it := range q.items {
+		if it.Request.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// enqueue queues req, which failed to embed with cause, in place of any
+// earlier entry for its ID.
+func (q *pendingQueue) enqueue(req AddRequest, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	prev := q.items
+	item := pendingItem{Request: req, QueuedAt: time.Now(), Attempts: 1, LastError: cause.Error()}
+	if i := q.indexLocked(req.ID); i >= 0 {
+		q.items = append(append(q.items[:i:i], q.items[i+1:]...), item)
+	} else {
+		q.items = append(q.items[:len(q.items):len(q.items)], item)
+	}
+	if err := q.saveLocked(); err != nil {
+		q.items = prev
+		return err
+	}
+	return nil
+}
+
+// remove drops id's entry and reports whether there was one.
+func (q *pendingQueue) remove(id string) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.indexLocked(id)
+	if i < 0 {
+		return false
+	}
+	q.items = append(q.items[:i:i], q.items[i+1:]...)
+	if err := q.saveLocked(); err != nil {
+		log.Printf("pending queue: %v", err)
+	}
+	return true
+}
+
+// removeWhere drops every entry whose request, as the record it would
+// store, satisfies match, and returns how many went.
+func (q *pendingQueue) removeWhere(match func(Record) bool) int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.items)
+	q.items = slices.DeleteFunc(slices.Clone(q.items), func(it pendingItem) bool {
+		req := it.Request
+		// record fills in Metadata["text"]; leave the queued map alone.
+		req.Metadata = maps.Clone(req.Metadata)
+		return match(req.record(nil))
+	})
+	if n == len(q.items) {
+		return 0
+	}
+	if err := q.saveLocked(); err != nil {
+		log.Printf("pending queue: %v", err)
+	}
+	return n - len(q.items)
+}
+
+// list returns a copy of the queued entries, oldest first.
+func (q *pendingQueue) list() []pendingItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]pendingItem{}, q.items...)
+}
+
+// retry embeds each queued request with e and stores it in store,
+// returning how many were. A request that fails transiently again stays
+// queued for the next pass; one the embedder or the store rejects outright
+// is dropped, as retrying it cannot help.
+func (q *pendingQueue) retry(ctx context.Context, store *VectorStore, e Embedder) int {
+	added := 0
+	for _, item := range q.list() {
+		vec, err := e.Embed(ctx, item.Request.Text)
+
+		q.mu.Lock()
+		// The entry may have been superseded or deleted meanwhile.
+		i := q.indexLocked(item.Request.ID)
+		if i < 0 || !q.items[i].QueuedAt.Equal(item.QueuedAt) {
+			q.mu.Unlock()
+			continue
+		}
+		switch {
+		case err != nil && isTransient(err):
+			q.items[i].Attempts++
+			q.items[i].LastError = err.Error()
+		case err != nil:
+			log.Printf("pending %s: dropped: %v", item.Request.ID, err)
+			q.items = append(q.items[:i:i], q.items[i+1:]...)
+		default:
+			if aerr := store.AddRecord(item.Request.record(Vector(vec))); aerr != nil {
+				log.Printf("pending %s: dropped: %v", item.Request.ID, aerr)
+			} else {
+				added++
+			}
+			q.items = append(q.items[:i:i], q.items[i+1:]...)
+		}
+		if serr := q.saveLocked(); serr != nil {
+			log.Printf("pending queue: %v", serr)
+		}
+		q.mu.Unlock()
+	}
+	return added
+}
+
+// start retries the queue against store and e now and every interval
+// until the returned stop is called.
+func (q *pendingQueue) start(interval time.Duration, store *VectorStore, e Embedder) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			if n := q.retry(context.Background(), store, e); n > 0 {
+				log.Printf("pending queue: embedded %d", n)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// pendingHandler answers GET /pending with the queued adds.
+func pendingHandler(c *gin.Context) {
+	if pending == nil {
+		c.JSON(errorResponse(404, errors.New("pending queue disabled; set PENDING_QUEUE_PATH to enable it")))
+		return
+	}
+	items := pending.list()
+	c.JSON(200, gin.H{"pending": len(items), "items": items})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	pb "my-vector-db-v1/vectordbpb"
+)
+
+// flakyEmbedder refuses connections while down, answers reject with a
+// 400 and otherwise embeds every text as vec.
+type flakyEmbedder struct {
+	down   atomic.Bool
+	vec    []float32
+	reject string
+}
+
+func (e *flakyEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if e.down.Load() {
+		return nil, syscall.ECONNREFUSED
+	}
+	if text == e.reject {
+		return nil, &statusError{code: 400, status: "400 Bad Request", body: []byte("bad input")}
+	}
+	return e.vec, nil
+}
+
+func usePending(t *testing.T, q *pendingQueue) {
+	t.Helper()
+	prev := pending
+	pending = q
+	t.Cleanup(func() { pending = prev })
+}
+
+func TestPendingEmbedding(t *testing.T) {
+	store := NewVectorStore()
+	useStore(t, store)
+	path := filepath.Join(t.TempDir(), "pending.json")
+	q, err := openPendingQueue(path)
+	if err != nil {
+		t.Fatalf("openPendingQueue: %v", err)
+	}
+	usePending(t, q)
+	e := &flakyEmbedder{vec: []float32{1, 0}}
+	e.down.Store(true)
+	prev := embedder
+	embedder = e
+	t.Cleanup(func() { embedder = prev })
+
+	w := doJSON(t, "POST", "/add", AddRequest{ID: "a", Text: "hello", Metadata: map[string]string{"k": "v"}})
+	if w.Code != 202 {
+		t.Fatalf("POST /add while down = %d %s", w.Code, w.Body)
+	}
+	if store.Len() != 0 || len(mustSearch(t, store, Vector{1, 0}, 1)) != 0 {
+		t.Fatal("pending record is searchable")
+	}
+	var listed struct {
+		Pending int           `json:"pending"`
+		Items   []pendingItem `json:"items"`
+	}
+	json.Unmarshal(doJSON(t, "GET", "/pending", nil).Body.Bytes(), &listed)
+	if listed.Pending != 1 || listed.Items[0].Request.ID != "a" || listed.Items[0].LastError != "embedding failed: connection refused" {
+		t.Fatalf("GET /pending = %+v", listed)
+	}
+
+	// Still down: the entry stays queued, its attempt counted, and the
+	// file carries it over a restart.
+	if n := q.retry(context.Background(), store, e); n != 0 {
+		t.Fatalf("retry while down added %d", n)
+	}
+	q, err = openPendingQueue(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	if items := q.list(); len(items) != 1 || items[0].Attempts != 2 {
+		t.Fatalf("reopened queue = %+v", items)
+	}
+
+	e.down.Store(false)
+	if n := q.retry(context.Background(), store, e); n != 1 {
+		t.Fatalf("retry after recovery added %d, want 1", n)
+	}
+	got := mustSearch(t, store, Vector{1, 0}, 1)
+	if len(got) != 1 || got[0].ID != "a" {
+		t.Fatalf("search after recovery = %v", got)
+	}
+	if rec, _ := store.Get("a"); rec.Metadata["text"] != "hello" || rec.Metadata["k"] != "v" {
+		t.Fatalf("embedded record = %+v", rec)
+	}
+	if q, _ := openPendingQueue(path); len(q.list()) != 0 {
+		t.Fatalf("queue not emptied: %+v", q.list())
+	}
+}
+
+// TestPendingSuperseded checks every later write or delete of a queued
+// ID drops the queued add, so a retry neither brings a deleted record back
+// nor overwrites a newer one.
+func TestPendingSuperseded(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		write func(t *testing.T)
+		text  string // the stored text afterwards; empty when deleted
+	}{
+		{"delete", func(t *testing.T) {
+			if w := doJSON(t, "DELETE", "/delete/b", nil); w.Code != 200 {
+				t.Fatalf("DELETE queued record = %d %s", w.Code, w.Body)
+			}
+		}, ""},
+		{"grpc delete", func(t *testing.T) {
+			if _, err := grpcClient(t).Delete(context.Background(), &pb.DeleteRequest{Id: "b"}); err != nil {
+				t.Fatalf("gRPC Delete of a queued record: %v", err)
+			}
+		}, ""},
+		{"delete by filter", func(t *testing.T) {
+			body := map[string]any{"filters": map[string]any{"conditions": []map[string]any{{"field": "k", "value": "v"}}}}
+			if w := doJSON(t, "POST", "/delete_by_filter", body); w.Code != 200 {
+				t.Fatalf("POST /delete_by_filter = %d %s", w.Code, w.Body)
+			}
+		}, ""},
+		{"drop namespace", func(t *testing.T) {
+			if w := doJSON(t, "DELETE", "/namespace/ns", nil); w.Code != 200 {
+				t.Fatalf("DELETE /namespace = %d %s", w.Code, w.Body)
+			}
+		}, ""},
+		{"batch add", func(t *testing.T) {
+			if w := doJSON(t, "POST", "/batch_add", []AddRequest{{ID: "b", Text: "newer"}}); w.Code != 200 {
+				t.Fatalf("POST /batch_add = %d %s", w.Code, w.Body)
+			}
+		}, "newer"},
+		{"grpc add", func(t *testing.T) {
+			if _, err := grpcClient(t).Add(context.Background(), &pb.AddRequest{Id: "b", Text: "newer"}); err != nil {
+				t.Fatalf("gRPC Add: %v", err)
+			}
+		}, "newer"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewVectorStore()
+			useStore(t, store)
+			q, _ := openPendingQueue(filepath.Join(t.TempDir(), "pending.json"))
+			usePending(t, q)
+			e := &flakyEmbedder{vec: []float32{1, 0}}
+			e.down.Store(true)
+			prev := embedder
+			embedder = e
+			t.Cleanup(func() { embedder = prev })
+
+			req := AddRequest{ID: "b", Text: "queued", Namespace: "ns", Metadata: map[string]string{"k": "v"}}
+			if w := doJSON(t, "POST", "/add", req); w.Code != 202 {
+				t.Fatalf("POST /add = %d %s", w.Code, w.Body)
+			}
+			// Deletes work with the embedder down; writes need it back.
+			if tc.text != "" {
+				e.down.Store(false)
+			}
+			tc.write(t)
+			e.down.Store(false)
+			if n := q.retry(context.Background(), store, e); n != 0 {
+				t.Fatalf("retry added %d superseded entries", n)
+			}
+			rec, ok := store.Get("b")
+			if tc.text == "" && ok {
+				t.Fatalf("deleted record came back: %+v", rec)
+			}
+			if tc.text != "" && rec.Metadata["text"] != tc.text {
+				t.Fatalf("record = %+v, want text %q", rec, tc.text)
+			}
+		})
+	}
+}
+
+// TestPendingPermanentFailure checks an embedding the backend rejects is
+// never queued on /add, and one that starts failing that way once queued
+// is dropped without holding up the entries behind it.
+func TestPendingPermanentFailure(t *testing.T) {
+	store := NewVectorStore()
+	useStore(t, store)
+	q, _ := openPendingQueue(filepath.Join(t.TempDir(), "pending.json"))
+	usePending(t, q)
+	e := &flakyEmbedder{vec: []float32{1, 0}, reject: "bad"}
+	prev := embedder
+	embedder = e
+	t.Cleanup(func() { embedder = prev })
+
+	if w := doJSON(t, "POST", "/add", AddRequest{ID: "x", Text: "bad"}); w.Code != 502 || len(q.list()) != 0 {
+		t.Fatalf("POST /add with rejected text = %d %s, queue %+v", w.Code, w.Body, q.list())
+	}
+
+	e.down.Store(true)
+	for _, req := range []AddRequest{{ID: "a", Text: "bad"}, {ID: "b", Text: "good"}} {
+		if w := doJSON(t, "POST", "/add", req); w.Code != 202 {
+			t.Fatalf("POST /add %s while down = %d %s", req.ID, w.Code, w.Body)
+		}
+	}
+	e.down.Store(false)
+	if n := q.retry(context.Background(), store, e); n != 1 {
+		t.Fatalf("retry added %d, want 1", n)
+	}
+	if _, ok := store.Get("b"); !ok || len(q.list()) != 0 {
+		t.Fatalf("after retry: b stored %t, queue %+v", ok, q.list())
+	}
+}
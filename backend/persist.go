@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Snapshot file layout (all integers little-endian):
+//
+//	magic "VSDB" | version byte | uint64 record count
+//	per record:
+//	  uint32 header length | header JSON (the Record minus Vector/Quantized;
+//	    a sparse vector stays in the header, and dim is then 0)
+//	  zero padding so the vector starts 4-byte aligned
+//	  uint32 dim | dim float32 values
+//	  uint32 code count | int8 codes
+//	uint32 trailer length | trailer JSON (snapshotMeta; since version 2)
+//
+// Files that do not start with the magic are read as the legacy JSON array.
+var snapshotMagic = []byte("VSDB")
+
+const snapshotVersion = 2
+
+// snapshotMeta is the store-wide state saved after the records.
+type snapshotMeta struct {
+	PQ         *ProductQuantizer `json:"pq,omitempty"`
+	Projection *Projection       `json:"projection,omitempty"`
+}
+
+// writeFileAtomic writes filename via write into filename+".tmp", syncs it
+// and renames it into place, so a crash mid-write leaves the previous file
+// intact; at worst a stale .tmp remains, which the next save replaces.
+func writeFileAtomic(filename string, write func(io.Writer) error) error {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func writeSnapshot(w io.Writer, records []Record, sm snapshotMeta) error {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	cw.Write(snapshotMagic)
+	cw.Write([]byte{snapshotVersion})
+	binary.Write(cw, binary.LittleEndian, uint64(len(records)))
+
+	var buf []byte
+	for i := range records {
+		hdr := records[i]
+		hdr.Vector, hdr.Quantized = nil, nil
+		meta, err := json.Marshal(hdr)
+		if err != nil {
+			return err
+		}
+		binary.Write(cw, binary.LittleEndian, uint32(len(meta)))
+		cw.Write(meta)
+		if pad := (4 - cw.n%4) % 4; pad > 0 {
+			cw.Write(make([]byte, pad))
+		}
+
+		vec := records[i].Vector
+		buf = binary.LittleEndian.AppendUint32(buf[:0], uint32(len(vec)))
+		for _, f := range vec {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+		}
+		codes := records[i].Quantized
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(codes)))
+		for _, c := range codes {
+			buf = append(buf, byte(c))
+		}
+		cw.Write(buf)
+	}
+	trailer, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+	binary.Write(cw, binary.LittleEndian, uint32(len(trailer)))
+	cw.Write(trailer)
+	if cw.err != nil {
+		return cw.err
+	}
+	return bw.Flush()
+}
+
+// readSnapshot decodes either snapshot format. JSON and version 1 files
+// carry no snapshotMeta.
+func readSnapshot(r io.Reader) ([]Record, snapshotMeta, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	head, err := br.Peek(len(snapshotMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, snapshotMeta{}, err
+	}
+	if !bytes.Equal(head, snapshotMagic) {
+		var records []Record
+		if err := json.NewDecoder(br).Decode(&records); err != nil {
+			return nil, snapshotMeta{}, fmt.Errorf("reading JSON snapshot: %w", err)
+		}
+		return records, snapshotMeta{}, nil
+	}
+	records, meta, err := readBinarySnapshot(br)
+	if err != nil {
+		return nil, snapshotMeta{}, fmt.Errorf("reading binary snapshot: %w", err)
+	}
+	return records, meta, nil
+}
+
+func readBinarySnapshot(br *bufio.Reader) ([]Record, snapshotMeta, error) {
+	var meta snapshotMeta
+	cr := &countingReader{r: br}
+	hdr := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(cr, hdr); err != nil {
+		return nil, meta, err
+	}
+	version := hdr[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return nil, meta, fmt.Errorf("unsupported version %d", version)
+	}
+	var count uint64
+	if err := binary.Read(cr, binary.LittleEndian, &count); err != nil {
+		return nil, meta, err
+	}
+
+	records := make([]Record, 0, min(count, 1<<20))
+	var buf []byte
+	for i := uint64(0); i < count; i++ {
+		n, err := readUint32(cr)
+		if err != nil {
+			return nil, meta, err
+		}
+		buf = grow(buf, int(n))
+		if _, err := io.ReadFull(cr, buf); err != nil {
+			return nil, meta, err
+		}
+		var rec Record
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			return nil, meta, fmt.Errorf("record %d: %w", i, err)
+		}
+		if pad := (4 - cr.n%4) % 4; pad > 0 {
+			if _, err := cr.Read(make([]byte, pad)); err != nil {
+				return nil, meta, err
+			}
+		}
+
+		dim, err := readUint32(cr)
+		if err != nil {
+			return nil, meta, err
+		}
+		buf = grow(buf, 4*int(dim))
+		if _, err := io.ReadFull(cr, buf); err != nil {
+			return nil, meta, err
+		}
+		if dim > 0 {
+			rec.Vector = make(Vector, dim)
+		}
+		for j := range rec.Vector {
+			rec.Vector[j] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*j:]))
+		}
+
+		nCodes, err := readUint32(cr)
+		if err != nil {
+			return nil, meta, err
+		}
+		if nCodes > 0 {
+			buf = grow(buf, int(nCodes))
+			if _, err := io.ReadFull(cr, buf); err != nil {
+				return nil, meta, err
+			}
+			rec.Quantized = make([]int8, nCodes)
+			for j, b := range buf {
+				rec.Quantized[j] = int8(b)
+			}
+		}
+		records = append(records, rec)
+	}
+
+	if version >= 2 {
+		n, err := readUint32(cr)
+		if err != nil {
+			return nil, meta, err
+		}
+		buf = grow(buf, int(n))
+		if _, err := io.ReadFull(cr, buf); err != nil {
+			return nil, meta, err
+		}
+		if err := json.Unmarshal(buf, &meta); err != nil {
+			return nil, meta, fmt.Errorf("trailer: %w", err)
+		}
+	}
+	return records, meta, nil
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// grow returns buf resized to n bytes, reallocating only when needed.
+func grow(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// countingWriter tracks the offset for alignment and keeps the first
+// error so the encoder can check once at the end.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(c.r, p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBinarySnapshotRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 50, 13) {
+		meta := map[string]string{"i": fmt.Sprint(i), "text": "ünïcode ✓"}
+		if i%7 == 0 {
+			meta = nil
+		}
+		store.AddItem(fmt.Sprintf("id-%d", i), v, meta, fmt.Sprintf("ns-%d", i%3))
+	}
+
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Records, store.Records) {
+		t.Fatal("records differ after binary round trip")
+	}
+	if !reflect.DeepEqual(loaded.IDMap, store.IDMap) || loaded.Dim != store.Dim {
+		t.Fatal("indices differ after binary round trip")
+	}
+}
+
+func TestMmapSnapshot(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	store := NewVectorStore()
+	store.UseQuantized = true
+	for i, v := range randomVectors(rng, 50, 13) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, map[string]string{"i": fmt.Sprint(i)}, fmt.Sprintf("ns-%d", i%3))
+	}
+	store.AddRecord(Record{ID: "sparse", Sparse: &SparseVector{Dim: 13, Indices: []int32{2}, Values: []float32{1}}})
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped := NewVectorStore()
+	mapped.UseQuantized, mapped.MmapSnapshots = true, true
+	if err := mapped.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(mapped.Records, store.Records) {
+		t.Fatal("records differ after a mapped load")
+	}
+	checkIndexes(t, mapped)
+	q := randomVectors(rng, 1, 13)[0]
+	if got, want := mustSearch(t, mapped, q, 5), mustSearch(t, store, q, 5); !reflect.DeepEqual(got, want) {
+		t.Errorf("mapped search = %v, want %v", got, want)
+	}
+
+	// Writing over mapped records and saving over the mapped file leaves
+	// both the store and the new file intact.
+	first := mapped.Records[0].ID
+	mapped.AddItem(first, randomVectors(rng, 1, 13)[0], nil, "")
+	mapped.DeleteItem("id-7")
+	if err := mapped.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mustSearch(t, mapped, q, 5), mustSearch(t, mapped, q, 5)) {
+		t.Error("searches disagree after saving")
+	}
+	reloaded := NewVectorStore()
+	reloaded.UseQuantized = true
+	if err := reloaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.Records, mapped.Records) {
+		t.Error("records differ after saving a mapped store")
+	}
+
+	// A legacy JSON snapshot is read as usual.
+	jsonPath := filepath.Join(t.TempDir(), "vectors.json")
+	if err := store.SaveJSON(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON := NewVectorStore()
+	fromJSON.MmapSnapshots = true
+	if err := fromJSON.Load(jsonPath); err != nil || len(fromJSON.Records) != len(store.Records) {
+		t.Fatalf("JSON Load: %v, %d records", err, len(fromJSON.Records))
+	}
+}
+
+func TestLoadLegacyJSON(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 2, 3}, map[string]string{"k": "v"}, "ns")
+
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	if err := store.SaveJSON(path); err != nil {
+		t.Fatalf("SaveJSON: %v", err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Records, store.Records) {
+		t.Fatalf("got %+v, want %+v", loaded.Records, store.Records)
+	}
+}
+
+func TestLoadDropsDuplicateIDs(t *testing.T) {
+	// As if the JSON snapshot had been edited by hand.
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	data := `[
+		{"id": "a", "vector": [1, 0], "metadata": {"copy": "first"}},
+		{"id": "b", "vector": [0, 1]},
+		{"id": "a", "vector": [0.8, 0.6], "metadata": {"copy": "second"}}
+	]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := NewVectorStore()
+	if err := store.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(store.Records) != 2 {
+		t.Fatalf("loaded %d records, want 2", len(store.Records))
+	}
+	checkIndexes(t, store)
+	if rec := store.Records[store.IDMap["a"]]; rec.Metadata["copy"] != "second" {
+		t.Errorf("kept %+v, want the last copy", rec)
+	}
+	if got := resultIDs(mustSearch(t, store, Vector{1, 0}, 5)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("results = %v, want each record once", got)
+	}
+}
+
+func TestSaveIsAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	before, _ := os.ReadFile(path)
+
+	// A save killed partway through must leave the real file untouched.
+	errKilled := errors.New("killed")
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		w.Write(snapshotMagic)
+		if _, err := os.Stat(path + ".tmp"); err != nil {
+			t.Errorf("partial write did not go to the .tmp file: %v", err)
+		}
+		return errKilled
+	})
+	if !errors.Is(err, errKilled) {
+		t.Fatalf("got %v, want the write error", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, before) {
+		t.Fatal("interrupted save modified the snapshot")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	// A stale .tmp from a hard crash is ignored by Load and replaced by the
+	// next Save.
+	os.WriteFile(path+".tmp", []byte("VSDB\x01garbage"), 0644)
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil || len(loaded.Records) != 1 {
+		t.Fatalf("Load with stale tmp: %d records, %v", len(loaded.Records), err)
+	}
+	store.AddItem("b", Vector{0, 1}, nil, "")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save over stale tmp: %v", err)
+	}
+	loaded.Load(path)
+	if len(loaded.Records) != 2 {
+		t.Fatalf("loaded %d records after resave, want 2", len(loaded.Records))
+	}
+}
+
+func TestLoadMissingFileIsFreshStart(t *testing.T) {
+	store := NewVectorStore()
+	if err := store.Load(filepath.Join(t.TempDir(), "missing.db")); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(store.Records) != 0 || store.Dim != 0 {
+		t.Fatalf("fresh store has %d records, dim %d", len(store.Records), store.Dim)
+	}
+}
+
+func TestSaveIfDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	store := NewVectorStore()
+	if wrote, err := store.SaveIfDirty(path); wrote || err != nil {
+		t.Fatalf("clean store: wrote=%v err=%v", wrote, err)
+	}
+
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	if !store.Dirty() {
+		t.Fatal("store not dirty after AddItem")
+	}
+	if wrote, err := store.SaveIfDirty(path); !wrote || err != nil {
+		t.Fatalf("dirty store: wrote=%v err=%v", wrote, err)
+	}
+	if wrote, _ := store.SaveIfDirty(path); wrote {
+		t.Fatal("saved again without changes")
+	}
+
+	store.DeleteItem("a")
+	if !store.Dirty() {
+		t.Fatal("store not dirty after DeleteItem")
+	}
+}
+
+func TestBackgroundSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	store := NewVectorStore()
+	stop := store.StartSnapshots(path, 5*time.Millisecond)
+	defer stop()
+
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	store.AddItem("b", Vector{0, 1}, nil, "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for store.Dirty() {
+		if time.Now().After(deadline) {
+			t.Fatal("background snapshot never ran")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil || len(loaded.Records) != 2 {
+		t.Fatalf("snapshot holds %d records, %v; want 2", len(loaded.Records), err)
+	}
+}
+
+func TestCloseSavesAndRejectsWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vectors.db")
+	store := NewVectorStore()
+	if err := store.EnableWAL(filepath.Join(dir, "vectors.wal")); err != nil {
+		t.Fatalf("EnableWAL: %v", err)
+	}
+	if err := store.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	store.AddItem("b", Vector{0, 1}, nil, "")
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := store.AddItem("c", Vector{1, 1}, nil, ""); !errors.Is(err, ErrClosed) {
+		t.Fatalf("AddItem after Close = %v, want ErrClosed", err)
+	}
+	if store.DeleteItem("a") {
+		t.Fatal("DeleteItem succeeded after Close")
+	}
+	if _, err := store.DeleteByFilter("", Filter{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("DeleteByFilter after Close = %v, want ErrClosed", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Records) != 2 || !reflect.DeepEqual(loaded.Records, store.Records) {
+		t.Fatalf("snapshot after Close holds %d records, want a and b", len(loaded.Records))
+	}
+}
+
+func TestPerNamespaceFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "vectors")
+	store := NewVectorStore()
+	store.PerNamespaceFiles = true
+	store.AddItem("a1", Vector{1, 0}, nil, "alpha")
+	store.AddItem("a2", Vector{0.9, 0.1}, nil, "alpha")
+	store.AddItem("b1", Vector{0, 1}, nil, "beta")
+	store.AddItem("d1", Vector{1, 1}, nil, "")
+	if err := store.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Namespaces) != 3 || m.Namespaces["alpha"].Records != 2 {
+		t.Fatalf("manifest %+v", m)
+	}
+
+	// Loading only alpha leaves beta and the default namespace out.
+	partial := NewVectorStore()
+	partial.PerNamespaceFiles = true
+	partial.LoadNamespaces = []string{"alpha"}
+	if err := partial.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexes(t, partial)
+	if got := storedIDs(partial); !reflect.DeepEqual(got, []string{"a1", "a2"}) {
+		t.Fatalf("loaded %v, want alpha only", got)
+	}
+	if got := resultIDs(mustSearch(t, partial, Vector{0, 1}, 5)); !reflect.DeepEqual(got, []string{"a2", "a1"}) {
+		t.Errorf("search returned %v", got)
+	}
+	if err := partial.AddItem("b2", Vector{0, 1}, nil, "beta"); !errors.Is(err, ErrNamespaceNotLoaded) {
+		t.Errorf("write to an unloaded namespace = %v, want ErrNamespaceNotLoaded", err)
+	}
+	if err := partial.AddItem("g1", Vector{1, 0}, nil, "gamma"); err != nil {
+		t.Errorf("write to a new namespace: %v", err)
+	}
+	partial.DeleteItem("a1")
+
+	// Saving the partial store rewrites alpha and adds gamma, but keeps
+	// the namespaces it never loaded.
+	if err := partial.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	full := NewVectorStore()
+	full.PerNamespaceFiles = true
+	if err := full.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedIDs(full); !reflect.DeepEqual(got, []string{"a2", "b1", "d1", "g1"}) {
+		t.Fatalf("reloaded %v", got)
+	}
+	// The files of the first generation are gone, bar those still listed.
+	entries, _ := os.ReadDir(dir)
+	if next, _ := readManifest(dir); len(entries) != len(next.Namespaces)+1 {
+		t.Errorf("%d files for %d namespaces", len(entries), len(next.Namespaces))
+	}
+
+	single := NewVectorStore()
+	single.LoadNamespaces = []string{"alpha"}
+	if err := single.Load(dir); err == nil {
+		t.Error("LoadNamespaces without PerNamespaceFiles accepted")
+	}
+}
+
+func TestPerNamespaceFilesRefuseWALOnPartialLoad(t *testing.T) {
+	tmp := t.TempDir()
+	dir, wal := filepath.Join(tmp, "vectors"), filepath.Join(tmp, "vectors.wal")
+	store := NewVectorStore()
+	store.PerNamespaceFiles = true
+	if err := store.EnableWAL(wal); err != nil {
+		t.Fatal(err)
+	}
+	store.AddItem("a1", Vector{1, 0}, nil, "alpha")
+	store.AddItem("b1", Vector{0, 1}, nil, "beta")
+	if err := store.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	store.AddItem("b2", Vector{0, 1}, nil, "beta")
+	store.syncWAL()
+
+	partial := NewVectorStore()
+	partial.PerNamespaceFiles, partial.LoadNamespaces = true, []string{"alpha"}
+	if err := partial.EnableWAL(wal); err != nil {
+		t.Fatal(err)
+	}
+	if err := partial.Load(dir); !errors.Is(err, errPartialWAL) {
+		t.Fatalf("Load = %v, want errPartialWAL", err)
+	}
+
+	// Once the log is folded into the snapshot, a partial load is fine.
+	if err := store.CompactWAL(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := partial.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedIDs(partial); !reflect.DeepEqual(got, []string{"a1"}) {
+		t.Errorf("loaded %v", got)
+	}
+}
+
+func TestLoadMixedDimensions(t *testing.T) {
+	// As if the snapshot had been extended after switching embedding
+	// models.
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	data := `[
+		{"id": "old", "vector": [1, 0]},
+		{"id": "a", "vector": [1, 0, 0]},
+		{"id": "b", "vector": [0, 1, 0]}
+	]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	strict := NewVectorStore()
+	strict.StrictDimensions = true
+	if err := strict.Load(path); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("strict Load = %v, want ErrDimensionMismatch", err)
+	}
+
+	store := NewVectorStore()
+	if err := store.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if store.Dim != 3 {
+		t.Errorf("Dim = %d, want the dominant 3", store.Dim)
+	}
+	if got := storedIDs(store); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("kept %v, want the 3-dimensional records", got)
+	}
+	checkIndexes(t, store)
+	if err := store.AddItem("new", Vector{1, 0}, nil, ""); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("inserting the old dimension = %v, want ErrDimensionMismatch", err)
+	}
+	if err := store.AddItem("c", Vector{0, 0, 1}, nil, ""); err != nil {
+		t.Errorf("inserting the dominant dimension: %v", err)
+	}
+}
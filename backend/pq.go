@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Product quantization splits each vector into M contiguous subvectors and
+// replaces every subvector by the index of its nearest centroid in a
+// per-subspace codebook learned with k-means. A record then costs M bytes:
+// 768 float32 dimensions at M=96 shrink 32x, where the int8 codes only
+// manage 4x. A query is compared against codes by asymmetric distance
+// computation: the query stays at full precision, its partial score
+// against every centroid is tabulated once, and a record's approximate
+// score is the sum of M table lookups. Candidates are re-scored at full
+// precision as in the other approximate modes.
+
+// ProductQuantizer holds the trained codebooks.
+type ProductQuantizer struct {
+	M      int `json:"m"`
+	Bits   int `json:"bits"`
+	SubDim int `json:"sub_dim"`
+	// Centroids holds, subspace by subspace, 1<<Bits centroids of SubDim
+	// values each.
+	Centroids []float32 `json:"centroids"`
+}
+
+const (
+	// pqIterations bounds the k-means rounds per subspace.
+	pqIterations = 20
+	// pqTrainSample caps how many records train the codebooks.
+	pqTrainSample = 50000
+	// defaultPQRerank is the candidate multiplier used when PQ search
+	// runs with RerankFactor unset.
+	defaultPQRerank = 10
+)
+
+var errPQUntrained = errors.New("not enough records to train product quantization")
+
+func (pq *ProductQuantizer) centroids() int { return 1 << pq.Bits }
+
+// centroid returns centroid c of subspace m.
+func (pq *ProductQuantizer) centroid(m, c int) []float32 {
+	off := (m*pq.centroids() + c) * pq.SubDim
+	return pq.Centroids[off : off+pq.SubDim]
+}
+
+// encode returns the nearest centroid index per subspace of v.
+func (pq *ProductQuantizer) encode(v Vector) []uint8 {
+	codes := make([]uint8, pq.M)
+	for m := range codes {
+		sub := v[m*pq.SubDim : (m+1)*pq.SubDim]
+		best, bestDist := 0, float32(math.Inf(1))
+		for c := range pq.centroids() {
+			if d := SquaredEuclidean(sub, pq.centroid(m, c)); d < bestDist {
+				best, bestDist = c, d
+			}
+		}
+		codes[m] = uint8(best)
+	}
+	return codes
+}
+
+// pqQuery is a query's lookup table: the partial dot product (or squared
+// distance under l2) of each query subvector with each centroid.
+type pqQuery struct {
+	table []float32
+	k     int
+	l2    bool
+}
+
+func (pq *ProductQuantizer) query(q Vector, l2 bool) pqQuery {
+	k := pq.centroids()
+	t := pqQuery{table: make([]float32, pq.M*k), k: k, l2: l2}
+	for m := range pq.M {
+		sub := q[m*pq.SubDim : (m+1)*pq.SubDim]
+		for c := range k {
+			if l2 {
+				t.table[m*k+c] = SquaredEuclidean(sub, pq.centroid(m, c))
+			} else {
+				t.table[m*k+c] = DotProduct(sub, pq.centroid(m, c))
+			}
+		}
+	}
+	return t
+}
+
+// score approximates the query's score against codes, on the same scale
+// as VectorStore.score.
+func (t pqQuery) score(codes []uint8) float32 {
+	var sum float32
+	for m, c := range codes {
+		sum += t.table[m*t.k+int(c)]
+	}
+	if t.l2 {
+		return float32(math.Sqrt(float64(sum)))
+	}
+	return sum
+}
+
+// trainPQ runs k-means in each of m subspaces of vectors.
+func trainPQ(vectors []Vector, m, nbits int, rng *rand.Rand) *ProductQuantizer {
+	pq := &ProductQuantizer{M: m, Bits: nbits, SubDim: len(vectors[0]) / m}
+	k := pq.centroids()
+	pq.Centroids = make([]float32, m*k*pq.SubDim)
+	assign := make([]int, len(vectors))
+	sums := make([]float32, k*pq.SubDim)
+	counts := make([]int, k)
+
+	for sm := range m {
+		sub := func(i int) []float32 { return vectors[i][sm*pq.SubDim : (sm+1)*pq.SubDim] }
+		// Seed with distinct random training points.
+		for c, i := range rng.Perm(len(vectors))[:k] {
+			copy(pq.centroid(sm, c), sub(i))
+		}
+		for range pqIterations {
+			moved := false
+			for i := range vectors {
+				best, bestDist := 0, float32(math.Inf(1))
+				for c := range k {
+					if d := SquaredEuclidean(sub(i), pq.centroid(sm, c)); d < bestDist {
+						best, bestDist = c, d
+					}
+				}
+				if assign[i] != best {
+					assign[i], moved = best, true
+				}
+			}
+			if !moved {
+				break
+			}
+			clear(sums)
+			clear(counts)
+			for i, c := range assign {
+				counts[c]++
+				for j, x := range sub(i) {
+					sums[c*pq.SubDim+j] += x
+				}
+			}
+			for c := range k {
+				cent := pq.centroid(sm, c)
+				if counts[c] == 0 {
+					// Re-seed an empty cluster rather than lose it.
+					copy(cent, sub(rng.Intn(len(vectors))))
+					continue
+				}
+				for j := range cent {
+					cent[j] = sums[c*pq.SubDim+j] / float32(counts[c])
+				}
+			}
+		}
+		clear(assign)
+	}
+	return pq
+}
+
+// TrainPQ learns product quantization codebooks with m subspaces and
+// nbits-bit codes (at most 8) from the stored vectors, then encodes every
+// record. Later inserts are encoded with the same codebooks. m must
+// divide the dimension, and there must be at least 1<<nbits records. Set
+// UsePQ to search with the codes; train again after Reindex changes the
+// vectors, e.g. on a metric change.
+func (vs *VectorStore) TrainPQ(m, nbits int) error {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return ErrClosed
+	}
+
+	if nbits < 1 || nbits > 8 {
+		return fmt.Errorf("pq: nbits must be between 1 and 8, got %d", nbits)
+	}
+	if m <= 0 || vs.Dim == 0 || vs.Dim%m != 0 {
+		return fmt.Errorf("pq: m=%d must divide the dimension %d", m, vs.Dim)
+	}
+	sample := make([]Vector, 0, len(vs.Records)-vs.tombstones)
+	for i := range vs.Records {
+		if rec := &vs.Records[i]; !rec.Deleted && rec.Sparse == nil {
+			sample = append(sample, rec.Vector)
+		}
+	}
+	if len(sample) < 1<<nbits {
+		return fmt.Errorf("%w: have %d, need %d", errPQUntrained, len(sample), 1<<nbits)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	if len(sample) > pqTrainSample {
+		rng.Shuffle(len(sample), func(i, j int) { sample[i], sample[j] = sample[j], sample[i] })
+		sample = sample[:pqTrainSample]
+	}
+
+	vs.pq = trainPQ(sample, m, nbits, rng)
+	for i := range vs.Records {
+		if rec := &vs.Records[i]; rec.Sparse == nil {
+			rec.PQ = vs.pq.encode(rec.Vector)
+		}
+	}
+	vs.changes++
+	return nil
+}
+
+// PQ returns the trained codebooks, or nil.
+func (vs *VectorStore) PQ() *ProductQuantizer {
+	vs.RLock()
+	defer vs.RUnlock()
+	return vs.pq
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTrainPQValidation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 20, 12) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+
+	for _, tc := range []struct{ m, nbits int }{{5, 4}, {0, 4}, {4, 0}, {4, 9}} {
+		if err := store.TrainPQ(tc.m, tc.nbits); err == nil {
+			t.Fatalf("TrainPQ(%d, %d) succeeded", tc.m, tc.nbits)
+		}
+	}
+	if err := store.TrainPQ(4, 5); !errors.Is(err, errPQUntrained) {
+		t.Fatalf("TrainPQ with 20 records for 32 centroids = %v, want errPQUntrained", err)
+	}
+	if store.PQ() != nil {
+		t.Fatal("failed training left codebooks behind")
+	}
+
+	if err := store.TrainPQ(4, 4); err != nil {
+		t.Fatalf("TrainPQ: %v", err)
+	}
+	for _, rec := range store.Records {
+		if len(rec.PQ) != 4 {
+			t.Fatalf("%s has %d codes, want 4", rec.ID, len(rec.PQ))
+		}
+	}
+	store.AddItem("late", randomVectors(rng, 1, 12)[0], nil, "")
+	if rec := store.Records[store.IDMap["late"]]; len(rec.PQ) != 4 {
+		t.Fatalf("record added after training has %d codes", len(rec.PQ))
+	}
+}
+
+// TestPQSearchRecall checks that PQ search with the default re-rank finds
+// nearly the exact top k under both a similarity metric and L2.
+func TestPQSearchRecall(t *testing.T) {
+	for _, metric := range []Metric{MetricCosine, MetricL2} {
+		t.Run(string(metric), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(5))
+			store := NewVectorStore()
+			store.Metric = metric
+			for i, v := range randomVectors(rng, 2000, 64) {
+				store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+			}
+			queries := randomVectors(rng, 20, 64)
+
+			const k = 10
+			exact := make([][]SearchResult, len(queries))
+			for i, q := range queries {
+				exact[i] = mustSearch(t, store, q, k)
+			}
+			if err := store.TrainPQ(16, 6); err != nil {
+				t.Fatalf("TrainPQ: %v", err)
+			}
+			store.UsePQ = true
+
+			recall := func() float64 {
+				var sum float64
+				for i, q := range queries {
+					sum += overlap(mustSearch(t, store, q, k), exact[i])
+				}
+				return sum / float64(len(queries))
+			}
+			store.RerankFactor = 1
+			approx := recall()
+			store.RerankFactor = 0
+			reranked := recall()
+			t.Logf("top-%d recall: %.2f codes only, %.2f re-ranked", k, approx, reranked)
+			if reranked < 0.9 || reranked < approx {
+				t.Fatalf("re-ranked recall %.2f (codes only %.2f)", reranked, approx)
+			}
+		})
+	}
+}
+
+func TestPQSnapshotRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 300, 32) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	if err := store.TrainPQ(8, 4); err != nil {
+		t.Fatalf("TrainPQ: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.PQ(), store.PQ()) {
+		t.Fatal("codebooks differ after round trip")
+	}
+	if !reflect.DeepEqual(loaded.Records, store.Records) {
+		t.Fatal("records differ after round trip")
+	}
+
+	store.UsePQ, loaded.UsePQ = true, true
+	q := randomVectors(rng, 1, 32)[0]
+	if got, want := resultIDs(mustSearch(t, loaded, q, 5)), resultIDs(mustSearch(t, store, q, 5)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded store returned %v, want %v", got, want)
+	}
+}
+
+// TestLoadSnapshotVersion1 loads a file in the layout from before the
+// trailer existed.
+func TestLoadSnapshotVersion1(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 10, 8) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Without codebooks the trailer is the uint32 length 2 and "{}".
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = data[:len(data)-6]
+	data[len(snapshotMagic)] = 1
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Records, store.Records) || loaded.PQ() != nil {
+		t.Fatal("version 1 snapshot did not load as saved")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// A random projection maps each vector through a fixed Gaussian matrix
+// down to fewer dimensions. By the Johnson-Lindenstrauss lemma dot
+// products and distances survive approximately, so the scan can score the
+// short projected vectors and re-rank the best candidates at full
+// precision, as in the other approximate modes. 768 dimensions projected
+// to 128 scan about seven times faster (see BenchmarkProjection).
+
+// Projection is the matrix mapping InDim-dimensional vectors to OutDim.
+type Projection struct {
+	InDim  int   `json:"in_dim"`
+	OutDim int   `json:"out_dim"`
+	Seed   int64 `json:"seed"`
+	// Matrix holds OutDim rows of InDim values, scaled by 1/sqrt(OutDim)
+	// so projected lengths match on average.
+	Matrix []float32 `json:"matrix"`
+}
+
+// defaultProjectionRerank is the candidate multiplier used when a
+// projected search runs with RerankFactor unset.
+const defaultProjectionRerank = 10
+
+func newProjection(inDim, outDim int, seed int64) *Projection {
+	p := &Projection{InDim: inDim, OutDim: outDim, Seed: seed, Matrix: make([]float32, outDim*inDim)}
+	rng := rand.New(rand.NewSource(seed))
+	scale := 1 / math.Sqrt(float64(outDim))
+	for i := range p.Matrix {
+		p.Matrix[i] = float32(rng.NormFloat64() * scale)
+	}
+	return p
+}
+
+// apply returns the projection of v.
+func (p *Projection) apply(v Vector) Vector {
+	out := make(Vector, p.OutDim)
+	for i := range out {
+		out[i] = DotProduct(p.Matrix[i*p.InDim:(i+1)*p.InDim], v)
+	}
+	return out
+}
+
+// EnableProjection generates a random projection to outDim dimensions
+// from seed, projects every stored vector and makes searches score the
+// projected vectors; later inserts and queries are projected with the same
+// matrix, which snapshots keep. outDim must be below the dimension, so the
+// store needs a record first. Calling it again replaces the matrix.
+func (vs *VectorStore) EnableProjection(outDim int, seed int64) error {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return ErrClosed
+	}
+
+	if vs.Dim == 0 || outDim <= 0 || outDim >= vs.Dim {
+		return fmt.Errorf("projection: output dimension must be between 1 and %d, got %d", vs.Dim-1, outDim)
+	}
+	vs.proj = newProjection(vs.Dim, outDim, seed)
+	for i := range vs.Records {
+		if rec := &vs.Records[i]; rec.Sparse == nil {
+			rec.Projected = vs.proj.apply(rec.Vector)
+		}
+	}
+	vs.changes++
+	return nil
+}
+
+// Projection returns the random projection in use, or nil.
+func (vs *VectorStore) Projection() *Projection {
+	vs.RLock()
+	defer vs.RUnlock()
+	return vs.proj
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// lowRankVectors returns n vectors lying near a random rank-dimensional
+// subspace, a rough stand-in for real embeddings: isotropic random
+// vectors have no meaningful neighbors for a projection to preserve.
+func lowRankVectors(rng *rand.Rand, n, dim, rank int) []Vector {
+	basis := randomVectors(rng, rank, dim)
+	out := make([]Vector, n)
+	for i := range out {
+		v := make(Vector, dim)
+		for _, b := range basis {
+			w := float32(rng.NormFloat64())
+			for j := range v {
+				v[j] += w * b[j]
+			}
+		}
+		for j := range v {
+			v[j] += 0.1 * float32(rng.NormFloat64())
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func TestEnableProjectionValidation(t *testing.T) {
+	store := NewVectorStore()
+	if err := store.EnableProjection(4, 1); err == nil {
+		t.Fatal("projection enabled on an empty store")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i, v := range randomVectors(rng, 10, 8) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	for _, outDim := range []int{0, -1, 8, 9} {
+		if err := store.EnableProjection(outDim, 1); err == nil {
+			t.Fatalf("EnableProjection(%d) succeeded", outDim)
+		}
+	}
+	if err := store.EnableProjection(4, 1); err != nil {
+		t.Fatalf("EnableProjection: %v", err)
+	}
+	store.AddItem("late", randomVectors(rng, 1, 8)[0], nil, "")
+	for _, rec := range store.Records {
+		if len(rec.Projected) != 4 {
+			t.Fatalf("%s has %d projected dimensions, want 4", rec.ID, len(rec.Projected))
+		}
+	}
+}
+
+// TestProjectionRecall compares projected search, with and without the
+// default re-rank, against the full-dimensional top k.
+func TestProjectionRecall(t *testing.T) {
+	for _, metric := range []Metric{MetricCosine, MetricL2} {
+		t.Run(string(metric), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(5))
+			store := NewVectorStore()
+			store.Metric = metric
+			data := lowRankVectors(rng, 2020, 128, 8)
+			for i, v := range data[:2000] {
+				store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+			}
+			queries := data[2000:]
+
+			const k = 10
+			exact := make([][]SearchResult, len(queries))
+			for i, q := range queries {
+				exact[i] = mustSearch(t, store, q, k)
+			}
+			if err := store.EnableProjection(32, 7); err != nil {
+				t.Fatalf("EnableProjection: %v", err)
+			}
+
+			recall := func() float64 {
+				var sum float64
+				for i, q := range queries {
+					sum += overlap(mustSearch(t, store, q, k), exact[i])
+				}
+				return sum / float64(len(queries))
+			}
+			store.RerankFactor = 1
+			approx := recall()
+			store.RerankFactor = 0
+			reranked := recall()
+			t.Logf("top-%d recall: %.2f projected only, %.2f re-ranked", k, approx, reranked)
+			if reranked < 0.85 || reranked < approx {
+				t.Fatalf("re-ranked recall %.2f (projected only %.2f)", reranked, approx)
+			}
+		})
+	}
+}
+
+func TestProjectionSnapshotRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 200, 16) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	if err := store.EnableProjection(4, 3); err != nil {
+		t.Fatalf("EnableProjection: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Projection(), store.Projection()) {
+		t.Fatal("projection differs after round trip")
+	}
+	store.RerankFactor, loaded.RerankFactor = 1, 1
+	q := randomVectors(rng, 1, 16)[0]
+	if got, want := mustSearch(t, loaded, q, 5), mustSearch(t, store, q, 5); !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded store returned %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// queryCache, when non-nil, holds recent /query results so repeats skip
+// both the embedding call and the search.
+var queryCache *resultCache
+
+// resultCache is a fixed-size LRU of query results. An entry is served
+// only while it is younger than the TTL and the store is still at the
+// generation it was computed from, so any write invalidates everything.
+// Records passing their TTL do not count as writes; the cache TTL bounds
+// how long one can linger in cached results.
+type resultCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type queryCacheEntry struct {
+	key     string
+	store   *VectorStore
+	gen     uint64
+	at      time.Time
+	results []DetailedResult
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// get returns the results cached under key for store at generation gen,
+// counting the hit or miss.
+func (qc *resultCache) get(key string, store *VectorStore, gen uint64) ([]DetailedResult, bool) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	el, ok := qc.items[key]
+	if ok {
+		e := el.Value.(*queryCacheEntry)
+		if e.store == store && e.gen == gen && qc.now().Sub(e.at) < qc.ttl {
+			qc.order.MoveToFront(el)
+			queryCacheHits.Inc()
+			return e.results, true
+		}
+		qc.order.Remove(el)
+		delete(qc.items, key)
+	}
+	queryCacheMisses.Inc()
+	return nil, false
+}
+
+// put caches results under key, evicting the least recently used entry
+// when full. Callers must not modify results afterwards.
+func (qc *resultCache) put(key string, store *VectorStore, gen uint64, results []DetailedResult) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	e := &queryCacheEntry{key: key, store: store, gen: gen, at: qc.now(), results: results}
+	if el, ok := qc.items[key]; ok {
+		el.Value = e
+		qc.order.MoveToFront(el)
+		return
+	}
+	qc.items[key] = qc.order.PushFront(e)
+	for qc.order.Len() > qc.size {
+		oldest := qc.order.Back()
+		qc.order.Remove(oldest)
+		delete(qc.items, oldest.Value.(*queryCacheEntry).key)
+	}
+}
+
+// cacheKey hashes the parameters that determine the request's results,
+// after normalize. Namespaces are sorted so list order does not matter.
+func (req QueryRequest) cacheKey() string {
+	req.Namespaces = slices.Sorted(slices.Values(req.Namespaces))
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withQueryCache enables a query cache of size entries for the test.
+func withQueryCache(t *testing.T, size int) *resultCache {
+	t.Helper()
+	prev := queryCache
+	queryCache = newResultCache(size, time.Minute)
+	t.Cleanup(func() { queryCache = prev })
+	return queryCache
+}
+
+func TestQueryCache(t *testing.T) {
+	useStore(t, NewVectorStore())
+	db.AddItem("a", Vector{1, 0}, nil, "")
+	var calls atomic.Int32
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"embedding":[1,0]}`))
+	})
+	cache := withQueryCache(t, 2)
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+
+	query := QueryRequest{Text: "same", K: 3, Namespaces: []string{"", "x"}}
+	for i := 0; i < 2; i++ {
+		if w := doJSON(t, "POST", "/query", query); w.Code != 200 {
+			t.Fatalf("query %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("embedder called %d times for a repeated query, want 1", n)
+	}
+
+	// Any write invalidates the cached results.
+	db.AddItem("b", Vector{1, 0.1}, nil, "x")
+	w := doJSON(t, "POST", "/query", query)
+	if n := calls.Load(); n != 2 || !strings.Contains(w.Body.String(), `"b"`) {
+		t.Fatalf("after a write: %d calls, body %s", n, w.Body)
+	}
+
+	now = now.Add(2 * time.Minute)
+	doJSON(t, "POST", "/query", query)
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("expired entry served: %d calls", n)
+	}
+
+	// Two newer queries push the first out of a two-entry cache.
+	doJSON(t, "POST", "/query", QueryRequest{Text: "other"})
+	doJSON(t, "POST", "/query", QueryRequest{Text: "third"})
+	doJSON(t, "POST", "/query", query)
+	if n := calls.Load(); n != 6 {
+		t.Fatalf("evicted entry served: %d calls, want 6", n)
+	}
+}
+
+// TestQueryCacheMaxCombined checks a cached max-combined query is answered
+// as the search was, without a page token.
+func TestQueryCacheMaxCombined(t *testing.T) {
+	useStore(t, expansionStore())
+	fakeOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"embedding":[1,0]}`))
+	})
+	withQueryCache(t, 2)
+
+	query := QueryRequest{Text: "across", Texts: []string{"up"}, Combine: CombineMax, K: 1}
+	for i := 0; i < 2; i++ {
+		w := doJSON(t, "POST", "/query", query)
+		if w.Code != 200 || strings.Contains(w.Body.String(), "next_page_token") {
+			t.Fatalf("query %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+}
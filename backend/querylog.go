@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryLog, when non-nil, keeps the most recent /query requests for GET
+// /debug/queries. Query text can be sensitive, so it is off unless
+// QUERY_LOG_SIZE is set.
+var queryLog *queryRing
+
+// QueryLogEntry is one logged query.
+type QueryLogEntry struct {
+	At         time.Time `json:"at"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Texts      []string  `json:"texts,omitempty"`
+	K          int       `json:"k"`
+	Namespaces []string  `json:"namespaces,omitempty"`
+	Filters    *Filter   `json:"filters,omitempty"`
+	Status     int       `json:"status"`
+	Cached     bool      `json:"cached,omitempty"`
+	LatencyMS  float64   `json:"latency_ms"`
+	Results    []string  `json:"results"`
+}
+
+// queryRing is a fixed-size ring buffer of entries, safe for concurrent
+// use; once full each entry overwrites the oldest.
+type queryRing struct {
+	mu      sync.Mutex
+	entries []QueryLogEntry
+	next    int
+	full    bool
+}
+
+func newQueryRing(size int) *queryRing {
+	return &queryRing{entries: make([]QueryLogEntry, size)}
+}
+
+func (r *queryRing) add(e QueryLogEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	r.full = r.full || r.next == 0
+}
+
+// recent returns the entries held, oldest first.
+func (r *queryRing) recent() []QueryLogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]QueryLogEntry{}, r.entries[:r.next]...)
+	}
+	return append(append([]QueryLogEntry{}, r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// logQuery records req, answered with results, if the log is on.
+func logQuery(c *gin.Context, req QueryRequest, start time.Time, results []DetailedResult, cached bool) {
+	if queryLog == nil {
+		return
+	}
+	id, _ := c.Request.Context().Value(requestIDKey{}).(string)
+	e := QueryLogEntry{
+		At:         start,
+		RequestID:  id,
+		Text:       req.Text,
+		Texts:      req.Texts,
+		K:          req.K,
+		Namespaces: req.searchOptions().namespaces(),
+		Filters:    req.Filters,
+		Status:     c.Writer.Status(),
+		Cached:     cached,
+		LatencyMS:  float64(time.Since(start).Microseconds()) / 1000,
+		Results:    make([]string, len(results)),
+	}
+	if e.Filters == nil && req.FilterKey != "" {
+		e.Filters = &Filter{Conditions: []Condition{{Field: req.FilterKey, Value: FilterValue(req.FilterVal)}}}
+	}
+	for i, res := range results {
+		e.Results[i] = res.ID
+	}
+	queryLog.add(e)
+}
+
+// debugQueries answers GET /debug/queries with the logged queries, oldest
+// first.
+func debugQueries(c *gin.Context) {
+	if queryLog == nil {
+		c.JSON(errorResponse(404, errors.New("query log disabled; set QUERY_LOG_SIZE to enable it")))
+		return
+	}
+	c.JSON(200, gin.H{"queries": queryLog.recent()})
+}
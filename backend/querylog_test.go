@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestQueryRing(t *testing.T) {
+	r := newQueryRing(3)
+	if got := r.recent(); len(got) != 0 {
+		t.Fatalf("empty ring holds %v", got)
+	}
+	texts := func() []string {
+		var out []string
+		for _, e := range r.recent() {
+			out = append(out, e.Text)
+		}
+		return out
+	}
+	for i := range 5 {
+		r.add(QueryLogEntry{Text: fmt.Sprint(i)})
+		if i == 1 && !slices.Equal(texts(), []string{"0", "1"}) {
+			t.Errorf("partly full: %v", texts())
+		}
+	}
+	if got := texts(); !slices.Equal(got, []string{"2", "3", "4"}) {
+		t.Errorf("after wrapping: %v, want the last three in order", got)
+	}
+}
+
+func TestDebugQueries(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("a", Vector{1, 0}, map[string]string{"lang": "en"}, "")
+	db.AddItem("b", Vector{0, 1}, map[string]string{"lang": "en"}, "")
+
+	if w := doJSON(t, "GET", "/debug/queries", nil); w.Code != 404 {
+		t.Fatalf("disabled log: %d %s", w.Code, w.Body)
+	}
+	prev := queryLog
+	queryLog = newQueryRing(3)
+	t.Cleanup(func() { queryLog = prev })
+
+	for i := range 4 {
+		doJSON(t, "POST", "/query", QueryRequest{Text: fmt.Sprintf("q%d", i), K: i + 1, FilterKey: "lang", FilterVal: "en"})
+	}
+	doJSON(t, "POST", "/query", QueryRequest{Text: "bad", K: -1})
+
+	w := doJSON(t, "GET", "/debug/queries", nil)
+	var resp struct{ Queries []QueryLogEntry }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || len(resp.Queries) != 3 {
+		t.Fatalf("debug/queries: %d %s", w.Code, w.Body)
+	}
+	// The request rejected before searching is not logged.
+	for i, e := range resp.Queries {
+		want := i + 1
+		if e.Text != fmt.Sprintf("q%d", want) || e.K != want+1 || e.Status != 200 || e.Filters == nil || e.Filters.Conditions[0].Field != "lang" {
+			t.Errorf("entry %d = %+v, want q%d", i, e, want)
+		}
+	}
+	if last := resp.Queries[2]; !slices.Equal(last.Results, []string{"a", "b"}) {
+		t.Errorf("logged results %v", last.Results)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d within burst was limited", i)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("over burst: ok=%v wait=%v, want limited for 500ms", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Fatal("another key shares a's bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.allow("a"); !ok {
+		t.Fatal("bucket did not refill")
+	}
+
+	// Once every bucket has refilled, the next sweep forgets them.
+	now = now.Add(limiterSweepInterval)
+	l.allow("c")
+	if len(l.buckets) != 1 {
+		t.Fatalf("%d buckets after sweep, want only c", len(l.buckets))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	prev := cfg
+	cfg.RateLimit, cfg.RateBurst = 1, 2
+	t.Cleanup(func() { cfg = prev })
+
+	router := setupRouter()
+	query := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/query", strings.NewReader(`{"text":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var limited int
+	for i := range 6 {
+		w := query("10.0.0.1")
+		switch w.Code {
+		case 200:
+		case 429:
+			limited++
+			if w.Header().Get("Retry-After") == "" {
+				t.Fatal("429 without Retry-After")
+			}
+		default:
+			t.Fatalf("request %d: unexpected %d %s", i, w.Code, w.Body)
+		}
+	}
+	if limited < 3 {
+		t.Fatalf("%d of 6 rapid requests limited, want at least 3", limited)
+	}
+	if w := query("10.0.0.2"); w.Code != 200 {
+		t.Fatalf("other client limited: %d", w.Code)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Re-embedding. After an embedding model change, POST /reembed starts a
+// background job that runs each record's stored text (Metadata["text"])
+// through the current embedder and swaps the new vector in place;
+// records without stored text are skipped. GET /reembed reports the
+// job's progress. Only one job runs at a time.
+
+// reembedChunkSize is how many records the job reads per read lock.
+const reembedChunkSize = 100
+
+// reembedStatus is the progress of the current or last re-embedding job.
+type reembedStatus struct {
+	Running bool `json:"running"`
+	// Total is the record count when the job started; records added
+	// since are not revisited.
+	Total int `json:"total"`
+	Done  int `json:"done"`
+	// Skipped counts records without stored text and ones rewritten or
+	// deleted by a client while the job ran.
+	Skipped    int         `json:"skipped"`
+	Failed     int         `json:"failed"`
+	Errors     []itemError `json:"errors"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  time.Time   `json:"started_at,omitzero"`
+	FinishedAt time.Time   `json:"finished_at,omitzero"`
+}
+
+// reembedJob guards the shared status of the background job.
+type reembedJob struct {
+	mu     sync.Mutex
+	status reembedStatus
+}
+
+var reembedder = &reembedJob{}
+
+var errReembedRunning = errors.New("a re-embedding job is already running")
+
+// snapshot returns a copy of the status safe to serialize.
+func (j *reembedJob) snapshot() reembedStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.status
+	st.Errors = append([]itemError{}, st.Errors...)
+	return st
+}
+
+func (j *reembedJob) update(fn func(*reembedStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+}
+
+// start launches the job over store with e unless one is running.
+func (j *reembedJob) start(store *VectorStore, e Embedder) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Running {
+		return errReembedRunning
+	}
+	j.status = reembedStatus{Running: true, Total: store.Len(), Errors: []itemError{}, StartedAt: time.Now()}
+	go j.run(context.Background(), store, e)
+	return nil
+}
+
+func (j *reembedJob) run(ctx context.Context, store *VectorStore, e Embedder) {
+	err := store.ForEachChunk("", reembedChunkSize, func(chunk []Record) error {
+		for _, rec := range chunk {
+			text, ok := rec.Metadata["text"]
+			if !ok || text == "" {
+				j.update(func(st *reembedStatus) { st.Skipped++ })
+				continue
+			}
+			vec, err := e.Embed(ctx, text)
+			if err == nil {
+				err = store.ReplaceVector(rec.ID, Vector(vec), rec.Version)
+			}
+			switch {
+			case errors.Is(err, ErrDimensionMismatch):
+				// A model with a new dimension cannot be swapped in
+				// record by record; every later record would fail too.
+				return fmt.Errorf("%s: %w; re-import the data instead", rec.ID, err)
+			case errors.Is(err, ErrVersionConflict), errors.Is(err, ErrNotFound):
+				j.update(func(st *reembedStatus) { st.Skipped++ })
+			case err != nil:
+				j.update(func(st *reembedStatus) {
+					st.Failed++
+					if len(st.Errors) < importMaxErrors {
+						st.Errors = append(st.Errors, itemError{ID: rec.ID, Error: err.Error()})
+					}
+				})
+			default:
+				j.update(func(st *reembedStatus) { st.Done++ })
+			}
+		}
+		return nil
+	})
+	j.update(func(st *reembedStatus) {
+		st.Running = false
+		st.FinishedAt = time.Now()
+		if err != nil {
+			st.Error = err.Error()
+		}
+	})
+	loggerFrom(ctx).Info("re-embedding finished", "done", j.snapshot().Done, "error", err)
+}
+
+func reembedHandler(c *gin.Context) {
+	countOp("reembed")
+	if err := reembedder.start(db, embedder); err != nil {
+		status, body := errorResponse(409, err)
+		body["status"] = reembedder.snapshot()
+		c.JSON(status, body)
+		return
+	}
+	c.JSON(202, reembedder.snapshot())
+}
+
+func reembedStatusHandler(c *gin.Context) {
+	c.JSON(200, reembedder.snapshot())
+}
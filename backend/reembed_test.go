@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// lengthEmbedder embeds a text deterministically as [len(text), 1].
+type lengthEmbedder struct{}
+
+func (lengthEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func TestReembed(t *testing.T) {
+	store := NewVectorStore()
+	store.Metric = MetricDot
+	useStore(t, store)
+	store.AddItem("a", Vector{0, 1}, map[string]string{"text": "four", "tag": "x"}, "ns")
+	store.AddItem("b", Vector{0, 1}, map[string]string{"text": "sixsix"}, "")
+	store.AddItem("raw", Vector{0, 1}, nil, "")
+
+	prev := embedder
+	embedder = lengthEmbedder{}
+	t.Cleanup(func() { embedder = prev })
+
+	if w := doJSON(t, "POST", "/reembed", nil); w.Code != 202 {
+		t.Fatalf("POST /reembed = %d %s", w.Code, w.Body)
+	}
+	var st reembedStatus
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w := doJSON(t, "GET", "/reembed", nil)
+		json.Unmarshal(w.Body.Bytes(), &st)
+		if !st.Running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still running: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if st.Total != 3 || st.Done != 2 || st.Skipped != 1 || st.Failed != 0 || st.Error != "" {
+		t.Fatalf("status = %+v", st)
+	}
+
+	for id, want := range map[string]Vector{"a": {4, 1}, "b": {6, 1}, "raw": {0, 1}} {
+		rec, _ := recordByID(id)
+		if rec.Vector[0] != want[0] || rec.Vector[1] != want[1] {
+			t.Fatalf("%s: vector %v, want %v", id, rec.Vector, want)
+		}
+	}
+	if rec, _ := recordByID("a"); rec.Metadata["tag"] != "x" || rec.Namespace != "ns" || rec.Version != 2 {
+		t.Fatalf("a lost its fields: %+v", rec)
+	}
+}
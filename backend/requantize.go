@@ -0,0 +1,69 @@
+package main
+
+import "context"
+
+// requantizeBatchSize is how many records Requantize re-encodes per write
+// lock.
+const requantizeBatchSize = 1000
+
+// Requantize recomputes every record's int8 codes under the current
+// QuantRange, like the quantization part of Reindex, but a batch at a time
+// so searches and writes interleave instead of waiting out the whole
+// store. The records are those stored when it starts, followed by ID, so
+// deletes moving records around do not make it skip any; records added or
+// replaced meanwhile are quantized on the way in anyway. After each batch
+// the running count of records handled is sent on progress, if not nil,
+// which the caller must receive from or cancel. It stops between batches
+// when ctx is done, returning ctx's error; the finished batches stay
+// re-encoded, and since re-encoding is deterministic running it again
+// simply completes the job. Searches running alongside may score records
+// from either encoding.
+func (vs *VectorStore) Requantize(ctx context.Context, progress chan<- int) error {
+	vs.RLock()
+	ids := make([]string, 0, len(vs.Records)-vs.tombstones)
+	for i := range vs.Records {
+		if !vs.Records[i].Deleted {
+			ids = append(ids, vs.Records[i].ID)
+		}
+	}
+	vs.RUnlock()
+
+	for done := 0; done < len(ids); {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch := ids[done:min(done+requantizeBatchSize, len(ids))]
+		if err := vs.requantizeBatch(batch); err != nil {
+			return err
+		}
+		done += len(batch)
+		if progress != nil {
+			select {
+			case progress <- done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// requantizeBatch re-encodes the records ids that still exist.
+func (vs *VectorStore) requantizeBatch(ids []string) error {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return ErrClosed
+	}
+	for _, id := range ids {
+		idx, ok := vs.IDMap[id]
+		if !ok {
+			continue
+		}
+		if rec := &vs.Records[idx]; rec.Sparse == nil {
+			rec.Quantized, rec.QScale, rec.QOffset = vs.quantize(rec.Vector)
+		}
+	}
+	vs.changes++
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRequantizeCancelAndResume(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	store := NewVectorStore()
+	store.UseQuantized = true
+	n := 3*requantizeBatchSize + 10
+	for i, v := range randomVectors(rng, n, 8) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	store.QuantRange = 1
+	want := make(map[string][]int8, n)
+	for _, rec := range store.Records {
+		want[rec.ID], _, _ = store.quantize(rec.Vector)
+	}
+	requantized := func() int {
+		count := 0
+		for _, rec := range store.Records {
+			if reflect.DeepEqual(rec.Quantized, want[rec.ID]) {
+				count++
+			}
+		}
+		return count
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := make(chan int)
+	errc := make(chan error, 1)
+	go func() { errc <- store.Requantize(ctx, progress) }()
+	if done := <-progress; done != requantizeBatchSize {
+		t.Fatalf("first progress report %d, want %d", done, requantizeBatchSize)
+	}
+	// A delete between batches moves the last record into an earlier slot.
+	store.DeleteItem("id-0")
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Requantize = %v, want context.Canceled", err)
+	}
+	if got := requantized(); got < requantizeBatchSize-1 || got == n-1 {
+		t.Fatalf("%d of %d records re-encoded after cancelling, want a partial run", got, n-1)
+	}
+	checkIndexes(t, store)
+
+	// Running it again finishes the job and a further run changes nothing.
+	for range 2 {
+		progress := make(chan int, n)
+		if err := store.Requantize(context.Background(), progress); err != nil {
+			t.Fatal(err)
+		}
+		close(progress)
+		last := 0
+		for done := range progress {
+			last = done
+		}
+		if last != n-1 {
+			t.Errorf("last progress report %d, want %d", last, n-1)
+		}
+		if got := requantized(); got != n-1 {
+			t.Fatalf("%d of %d records re-encoded", got, n-1)
+		}
+	}
+	mustSearch(t, store, randomVectors(rng, 1, 8)[0], 5)
+
+	store.Close()
+	if err := store.Requantize(context.Background(), nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Requantize on a closed store = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScoreNormalization rescales the scores of one result set for display,
+// e.g. as confidence percentages. The raw scores are kept; the rescaled
+// one goes in DetailedResult.Normalized. It only sees the results
+// returned, so the values are relative to that page and not comparable
+// across queries.
+type ScoreNormalization string
+
+const (
+	// NormalizeMinMax maps the best result to 1 and the worst to 0. When
+	// every score is equal they all get 1.
+	NormalizeMinMax ScoreNormalization = "minmax"
+	// NormalizeSoftmax turns the scores into a distribution summing to 1;
+	// distances are negated first, so the nearest result weighs most.
+	NormalizeSoftmax ScoreNormalization = "softmax"
+)
+
+func (n ScoreNormalization) validate() error {
+	switch n {
+	case "", NormalizeMinMax, NormalizeSoftmax:
+		return nil
+	}
+	return fmt.Errorf("unknown score normalization %q", n)
+}
+
+// normalizeScores sets Normalized on each result under n, reading Score
+// as a similarity if higherIsBetter and as a distance otherwise.
+func normalizeScores(results []DetailedResult, n ScoreNormalization, higherIsBetter bool) {
+	if n == "" || len(results) == 0 {
+		return
+	}
+	scores := make([]float64, len(results))
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i, res := range results {
+		scores[i] = float64(res.Score)
+		if !higherIsBetter {
+			scores[i] = -scores[i]
+		}
+		lo, hi = min(lo, scores[i]), max(hi, scores[i])
+	}
+
+	var sum float64
+	for i, s := range scores {
+		switch n {
+		case NormalizeMinMax:
+			if hi > lo {
+				scores[i] = (s - lo) / (hi - lo)
+			} else {
+				scores[i] = 1
+			}
+		case NormalizeSoftmax:
+			// Shifted by the maximum so exp cannot overflow.
+			scores[i] = math.Exp(s - hi)
+			sum += scores[i]
+		}
+	}
+	for i := range results {
+		v := scores[i]
+		if n == NormalizeSoftmax {
+			v /= sum
+		}
+		f := float32(v)
+		results[i].Normalized = &f
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func normalizedScores(results []DetailedResult) []float32 {
+	out := make([]float32, len(results))
+	for i, res := range results {
+		out[i] = *res.Normalized
+	}
+	return out
+}
+
+func TestNormalizeScores(t *testing.T) {
+	results := func(scores ...float32) []DetailedResult {
+		out := make([]DetailedResult, len(scores))
+		for i, s := range scores {
+			out[i].Score = s
+		}
+		return out
+	}
+
+	r := results(0.9, 0.5, -0.3)
+	normalizeScores(r, NormalizeSoftmax, true)
+	got := normalizedScores(r)
+	var sum float32
+	for _, s := range got {
+		sum += s
+	}
+	if math.Abs(float64(sum-1)) > 1e-5 || got[0] <= got[1] || got[1] <= got[2] {
+		t.Errorf("softmax = %v, want a decreasing distribution summing to 1", got)
+	}
+
+	r = results(0.9, 0.5, -0.3)
+	normalizeScores(r, NormalizeMinMax, true)
+	if got := normalizedScores(r); got[0] != 1 || got[1] != 2./3 || got[2] != 0 {
+		t.Errorf("minmax = %v", got)
+	}
+
+	// Distances: the nearest result ranks first and weighs most.
+	r = results(0.1, 2)
+	normalizeScores(r, NormalizeMinMax, false)
+	if got := normalizedScores(r); got[0] != 1 || got[1] != 0 {
+		t.Errorf("minmax over distances = %v", got)
+	}
+
+	r = results(0.7, 0.7, 0.7, 0.7)
+	normalizeScores(r, NormalizeSoftmax, true)
+	for _, s := range normalizedScores(r) {
+		if s != 0.25 {
+			t.Errorf("softmax of equal scores = %v, want 0.25 each", normalizedScores(r))
+		}
+	}
+	normalizeScores(r, NormalizeMinMax, true)
+	for _, s := range normalizedScores(r) {
+		if s != 1 {
+			t.Errorf("minmax of equal scores = %v, want 1 each", normalizedScores(r))
+		}
+	}
+
+	if err := (SearchOptions{K: 1, NormalizeScores: "zscore"}).validate(MetricCosine); err == nil {
+		t.Error("unknown normalization accepted")
+	}
+}
+
+func TestQueryNormalizeScores(t *testing.T) {
+	useStore(t, NewVectorStore())
+	staticEmbedding(t, Vector{1, 0})
+	db.AddItem("a", Vector{1, 0}, nil, "")
+	db.AddItem("b", Vector{1, 1}, nil, "")
+	db.AddItem("c", Vector{0, 1}, nil, "")
+
+	w := doJSON(t, "POST", "/query", QueryRequest{Text: "q", K: 3, NormalizeScores: NormalizeSoftmax})
+	var resp struct{ Results []DetailedResult }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || len(resp.Results) != 3 {
+		t.Fatalf("query: %d %s", w.Code, w.Body)
+	}
+	var sum float32
+	for _, res := range resp.Results {
+		if res.Normalized == nil {
+			t.Fatalf("result %s has no normalized_score: %s", res.ID, w.Body)
+		}
+		sum += *res.Normalized
+	}
+	if math.Abs(float64(sum-1)) > 1e-5 || resp.Results[0].Score != 1 {
+		t.Errorf("normalized scores sum to %v, raw top score %v", sum, resp.Results[0].Score)
+	}
+
+	if w := doJSON(t, "POST", "/query", QueryRequest{Text: "q", NormalizeScores: "bogus"}); w.Code != 400 {
+		t.Errorf("bogus normalization: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+)
+
+// Sharding. A ShardedStore spreads records across several VectorStores by
+// their ID and answers a search by asking every shard for its own top K
+// and merging them: the overall top K is always among the union, so the
+// merge is exact. The shards are in-process for now, but each is a
+// complete store, so the same scatter-gather can sit in front of remote
+// ones.
+//
+// IDs are placed on a consistent-hash ring with shardReplicas points per
+// shard, so growing from n to n+1 shards would relocate about 1/(n+1) of
+// the records rather than nearly all of them, as hashing modulo n would.
+
+// shardReplicas is the number of ring points per shard; more points even
+// out the share each shard gets.
+const shardReplicas = 128
+
+type ShardedStore struct {
+	shards []*VectorStore
+	// ring holds the hash of every shard's points, ascending, and owner
+	// the shard each belongs to.
+	ring  []uint64
+	owner map[uint64]int
+}
+
+// NewShardedStore returns a store of n empty shards, each passed to
+// configure, if not nil, to set Metric and the like before use.
+func NewShardedStore(n int, configure func(*VectorStore)) *ShardedStore {
+	ss := &ShardedStore{owner: make(map[uint64]int)}
+	for i := range max(n, 1) {
+		shard := NewVectorStore()
+		if configure != nil {
+			configure(shard)
+		}
+		ss.shards = append(ss.shards, shard)
+		for r := range shardReplicas {
+			h := hashString(fmt.Sprintf("shard-%d-%d", i, r))
+			if _, taken := ss.owner[h]; !taken {
+				ss.owner[h] = i
+				ss.ring = append(ss.ring, h)
+			}
+		}
+	}
+	slices.Sort(ss.ring)
+	return ss
+}
+
+// hashString is FNV-1a followed by the splitmix64 finalizer: FNV alone
+// leaves IDs differing in their last characters, like "doc-1" and
+// "doc-2", close together on the ring.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// shardFor returns the shard owning id: the one with the first ring point
+// at or after the ID's hash, wrapping around.
+func (ss *ShardedStore) shardFor(id string) *VectorStore {
+	i, _ := slices.BinarySearch(ss.ring, hashString(id))
+	if i == len(ss.ring) {
+		i = 0
+	}
+	return ss.shards[ss.owner[ss.ring[i]]]
+}
+
+// AddItem stores the item on the shard owning id, as VectorStore.AddItem.
+func (ss *ShardedStore) AddItem(id string, vector Vector, meta map[string]string, namespace string) error {
+	return ss.shardFor(id).AddItem(id, vector, meta, namespace)
+}
+
+// AddRecord is VectorStore.AddRecord on the shard owning rec.ID.
+func (ss *ShardedStore) AddRecord(rec Record) error {
+	return ss.shardFor(rec.ID).AddRecord(rec)
+}
+
+// DeleteItem removes id from its shard and reports whether it existed.
+func (ss *ShardedStore) DeleteItem(id string) bool {
+	return ss.shardFor(id).DeleteItem(id)
+}
+
+// Get is VectorStore.Get on the shard owning id.
+func (ss *ShardedStore) Get(id string) (Record, bool) {
+	return ss.shardFor(id).Get(id)
+}
+
+// Len is VectorStore.Len summed over the shards.
+func (ss *ShardedStore) Len() int {
+	n := 0
+	for _, shard := range ss.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Search runs SearchWithOptions on every shard at once and merges their
+// results into the top opts.K, best first, ranked as within one store.
+// MinScore, filters, Boost and the After cursor all apply per shard and
+// so carry over; Explain and OnCandidates are not supported.
+func (ss *ShardedStore) Search(query Vector, opts SearchOptions) ([]SearchResult, error) {
+	opts.Explain, opts.OnCandidates = nil, nil
+	results := make([][]SearchResult, len(ss.shards))
+	errs := make([]error, len(ss.shards))
+	var wg sync.WaitGroup
+	for i, shard := range ss.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = shard.SearchWithOptions(query, opts)
+		}()
+	}
+	wg.Wait()
+
+	// The shards share a metric, so any of them says which way is up.
+	h := NewResultHeap(ss.shards[0].Metric.HigherIsBetter())
+	for i, shardResults := range results {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("shard %d: %w", i, errs[i])
+		}
+		for _, res := range shardResults {
+			h.Offer(res, opts.K)
+		}
+	}
+	return h.Drain(), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestShardedStoreMatchesSingleStore(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	for _, metric := range []Metric{MetricCosine, MetricL2} {
+		t.Run(string(metric), func(t *testing.T) {
+			sharded := NewShardedStore(3, func(vs *VectorStore) { vs.Metric = metric })
+			single := NewVectorStore()
+			single.Metric = metric
+			for i, v := range randomVectors(rng, 600, 8) {
+				id := fmt.Sprintf("id-%d", i)
+				meta := map[string]string{"parity": fmt.Sprint(i % 2)}
+				sharded.AddItem(id, v, meta, "")
+				single.AddItem(id, v, meta, "")
+			}
+			for i, shard := range sharded.shards {
+				if n := shard.Len(); n < 100 {
+					t.Errorf("shard %d holds %d of 600 records", i, n)
+				}
+			}
+			if sharded.Len() != 600 {
+				t.Fatalf("Len = %d", sharded.Len())
+			}
+
+			filter := Filter{Conditions: []Condition{{Field: "parity", Value: "1"}}}
+			for _, opts := range []SearchOptions{{K: 10}, {K: 25, Filter: filter}} {
+				for _, q := range randomVectors(rng, 5, 8) {
+					got, err := sharded.Search(q, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					want, _ := single.SearchWithOptions(q, opts)
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("sharded %v\n want %v", got, want)
+					}
+					// The next page follows on just the same.
+					opts := opts
+					opts.After = &got[len(got)-1]
+					got, _ = sharded.Search(q, opts)
+					want, _ = single.SearchWithOptions(q, opts)
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("second page %v\n want %v", got, want)
+					}
+				}
+			}
+
+			sharded.DeleteItem("id-3")
+			if _, ok := sharded.Get("id-3"); ok || sharded.Len() != 599 {
+				t.Error("delete did not reach the owning shard")
+			}
+			if rec, ok := sharded.Get("id-4"); !ok || rec.Metadata["parity"] != "0" {
+				t.Errorf("Get(id-4) = %+v, %t", rec, ok)
+			}
+		})
+	}
+
+	if _, err := NewShardedStore(2, nil).Search(Vector{1, 0}, SearchOptions{}); err == nil {
+		t.Error("k of 0 accepted")
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import "golang.org/x/sys/cpu"
+
+// hasSIMD reports whether the CPU can run dotSIMD.
+var hasSIMD = cpu.X86.HasAVX2 && cpu.X86.HasFMA
+
+// dotSIMD is DotProduct in AVX2 with fused multiply-add, eight lanes at a
+// time (see simd_amd64.s). b must be at least as long as a.
+//
+//go:noescape
+func dotSIMD(a, b []float32) float32
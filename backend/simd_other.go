@@ -0,0 +1,7 @@
+//go:build !amd64
+
+package main
+
+const hasSIMD = false
+
+func dotSIMD(a, b []float32) float32 { return dotGeneric(a, b) }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDotProductSIMDMatchesGeneric(t *testing.T) {
+	if !hasSIMD {
+		t.Skip("CPU lacks the SIMD dot product")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 7, 8, 9, 15, 16, 31, 32, 33, 63, 100, 768, 1000} {
+		v := randomVectors(rng, 2, n)
+		a, b := v[0], v[1]
+		got, want := dotSIMD(a, b), dotGeneric(a, b)
+		// Summation order differs, so allow rounding relative to the
+		// magnitude of the terms rather than of the (possibly tiny) sum.
+		var mag float64
+		for i := range a {
+			mag += math.Abs(float64(a[i] * b[i]))
+		}
+		if diff := math.Abs(float64(got - want)); diff > 1e-5*mag {
+			t.Fatalf("n=%d: simd %v, generic %v", n, got, want)
+		}
+	}
+	if got := dotSIMD(nil, nil); got != 0 {
+		t.Fatalf("empty dot = %v", got)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Sparse records keep only their non-zero components, as parallel index
+// and value slices, which for embeddings that are mostly zeros (e.g.
+// learned keyword weights) costs 8 bytes per active dimension instead of
+// 4 per dimension. Queries stay dense. Scans score sparse records exactly
+// by walking their active dimensions, even in the int8, PQ and projected
+// modes, whose codes they do not get; they do get binary codes, so binary
+// mode ranks them like the rest. An HNSW graph holds a dense copy of
+// each vector, sparse or not.
+
+// SparseVector is a Dim-dimensional vector given by its non-zero entries.
+// Indices are strictly increasing.
+type SparseVector struct {
+	Dim     int       `json:"dim"`
+	Indices []int32   `json:"indices"`
+	Values  []float32 `json:"values"`
+}
+
+var errSparseIndices = errors.New("sparse vector indices must be strictly increasing and below dim")
+
+// ToSparse keeps the non-zero components of v.
+func ToSparse(v Vector) *SparseVector {
+	s := &SparseVector{Dim: len(v)}
+	for i, x := range v {
+		if x != 0 {
+			s.Indices = append(s.Indices, int32(i))
+			s.Values = append(s.Values, x)
+		}
+	}
+	return s
+}
+
+// Dense expands s to a full vector.
+func (s *SparseVector) Dense() Vector {
+	out := make(Vector, s.Dim)
+	for j, i := range s.Indices {
+		out[i] = s.Values[j]
+	}
+	return out
+}
+
+// validate checks the layout; values are checked like dense components.
+func (s *SparseVector) validate() error {
+	if len(s.Indices) != len(s.Values) {
+		return fmt.Errorf("sparse vector has %d indices but %d values", len(s.Indices), len(s.Values))
+	}
+	for j, i := range s.Indices {
+		if i < 0 || int(i) >= s.Dim || j > 0 && i <= s.Indices[j-1] {
+			return errSparseIndices
+		}
+	}
+	return nil
+}
+
+// scaled returns a copy of s with every value multiplied by f.
+func (s *SparseVector) scaled(f float32) *SparseVector {
+	out := &SparseVector{Dim: s.Dim, Indices: s.Indices, Values: make([]float32, len(s.Values))}
+	for j, x := range s.Values {
+		out.Values[j] = x * f
+	}
+	return out
+}
+
+func (s *SparseVector) clone() *SparseVector {
+	if s == nil {
+		return nil
+	}
+	return &SparseVector{Dim: s.Dim, Indices: slices.Clone(s.Indices), Values: slices.Clone(s.Values)}
+}
+
+// SparseDot is the dot product of a dense vector with a sparse one.
+func SparseDot(q Vector, s *SparseVector) float32 {
+	var sum float32
+	for j, i := range s.Indices {
+		sum += q[i] * s.Values[j]
+	}
+	return sum
+}
+
+// sparseEuclidean is the L2 distance between q and s. Every component of
+// q contributes, so unlike SparseDot it costs a dense pass.
+func sparseEuclidean(q Vector, s *SparseVector) float32 {
+	sum := Magnitude(q)
+	sum *= sum
+	for j, i := range s.Indices {
+		d := q[i] - s.Values[j]
+		sum += d*d - q[i]*q[i]
+	}
+	return float32(math.Sqrt(float64(max(sum, 0))))
+}
+
+// dim is the dimension of the stored vector, dense or sparse.
+func (r *Record) dim() int {
+	if r.Sparse != nil {
+		return r.Sparse.Dim
+	}
+	return len(r.Vector)
+}
+
+// originalSparse is Original for a sparse record, still sparse.
+func (r *Record) originalSparse() *SparseVector {
+	if r.Norm == 0 {
+		return r.Sparse.clone()
+	}
+	return r.Sparse.scaled(r.Norm)
+}
+
+// dense returns the record's vector in dense form, expanding a sparse
+// one; the result may share memory with Vector.
+func (r *Record) dense() Vector {
+	if r.Sparse != nil {
+		return r.Sparse.Dense()
+	}
+	return r.Vector
+}
+
+// magnitude is the length of the stored vector, dense or sparse.
+func (r *Record) magnitude() float32 {
+	if r.Sparse != nil {
+		return Magnitude(r.Sparse.Values)
+	}
+	return Magnitude(r.Vector)
+}
+
+// normalize stores the vector unit-length, keeping its length in Norm.
+func (r *Record) normalize() {
+	r.Norm = r.magnitude()
+	if r.Sparse == nil {
+		r.Vector = Normalize(r.Vector)
+	} else if r.Norm != 0 {
+		r.Sparse = r.Sparse.scaled(1 / r.Norm)
+	}
+}
+
+// denormalize restores the vector's original length and clears Norm.
+func (r *Record) denormalize() {
+	if r.Sparse == nil {
+		r.Vector = r.Original()
+	} else if r.Norm != 0 {
+		r.Sparse = r.Sparse.scaled(r.Norm)
+	}
+	r.Norm = 0
+}
+
+// scoreRecord is score against a stored record, dense or sparse.
+func (vs *VectorStore) scoreRecord(q Vector, rec *Record) float32 {
+	if rec.Sparse == nil {
+		return vs.score(q, rec.Vector)
+	}
+	switch vs.Metric {
+	case MetricL2:
+		return sparseEuclidean(q, rec.Sparse)
+	case MetricCosine, MetricDot, "":
+		return SparseDot(q, rec.Sparse)
+	case MetricAngular:
+		return AngularDistance(SparseDot(q, rec.Sparse))
+	}
+	return vs.score(q, rec.Sparse.Dense())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sparseVectors returns n dim-dimensional vectors with nnz random
+// non-zero components each.
+func sparseVectors(rng *rand.Rand, n, dim, nnz int) []Vector {
+	out := make([]Vector, n)
+	for i := range out {
+		v := make(Vector, dim)
+		for _, j := range rng.Perm(dim)[:nnz] {
+			v[j] = float32(rng.NormFloat64())
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func TestSparseDotMatchesDense(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	q := randomVectors(rng, 1, 200)[0]
+	for _, v := range sparseVectors(rng, 50, 200, 7) {
+		s := ToSparse(v)
+		if len(s.Indices) != 7 {
+			t.Fatalf("ToSparse kept %d components, want 7", len(s.Indices))
+		}
+		if !reflect.DeepEqual(s.Dense(), v) {
+			t.Fatal("Dense does not restore the vector")
+		}
+		if got, want := SparseDot(q, s), DotProduct(q, v); math.Abs(float64(got-want)) > 1e-4 {
+			t.Errorf("SparseDot = %v, want %v", got, want)
+		}
+		if got, want := sparseEuclidean(q, s), EuclideanDistance(q, v); math.Abs(float64(got-want)) > 1e-4 {
+			t.Errorf("sparseEuclidean = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSparseStorageSearchMatchesDense(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	vectors := sparseVectors(rng, 300, 128, 6)
+	queries := randomVectors(rng, 5, 128)
+	for _, metric := range []Metric{MetricCosine, MetricDot, MetricL2} {
+		t.Run(string(metric), func(t *testing.T) {
+			dense, sparse := NewVectorStore(), NewVectorStore()
+			dense.Metric, sparse.Metric = metric, metric
+			sparse.SparseStorage = true
+			for i, v := range vectors {
+				dense.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+				sparse.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+			}
+			if sparse.Records[0].Sparse == nil || sparse.Records[0].Vector != nil {
+				t.Fatal("SparseStorage kept a mostly-zero vector dense")
+			}
+			for _, q := range queries {
+				want, got := mustSearch(t, dense, q, 10), mustSearch(t, sparse, q, 10)
+				if !reflect.DeepEqual(resultIDs(got), resultIDs(want)) {
+					t.Fatalf("sparse results %v, dense %v", resultIDs(got), resultIDs(want))
+				}
+				for i := range got {
+					if math.Abs(float64(got[i].Score-want[i].Score)) > 1e-4 {
+						t.Errorf("%s: sparse score %v, dense %v", got[i].ID, got[i].Score, want[i].Score)
+					}
+				}
+			}
+			if got := sparse.Records[3].Original(); !approxEqual(got, vectors[3]) {
+				t.Errorf("Original = %v, want %v", got, vectors[3])
+			}
+		})
+	}
+}
+
+func approxEqual(a, b Vector) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSparseRecords(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("dense", Vector{1, 0, 0, 0}, nil, "")
+	err := store.AddRecord(Record{ID: "sparse", Sparse: &SparseVector{Dim: 4, Indices: []int32{1, 3}, Values: []float32{3, 4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(mustSearch(t, store, Vector{0, 0.6, 0, 0.8}, 1)); !reflect.DeepEqual(got, []string{"sparse"}) {
+		t.Errorf("results = %v, want the sparse record", got)
+	}
+	if got := store.Records[1].Original(); !approxEqual(got, Vector{0, 3, 0, 4}) {
+		t.Errorf("Original = %v", got)
+	}
+
+	for name, rec := range map[string]Record{
+		"both":      {ID: "x", Vector: Vector{1, 0, 0, 0}, Sparse: &SparseVector{Dim: 4}},
+		"dim":       {ID: "x", Sparse: &SparseVector{Dim: 3, Indices: []int32{0}, Values: []float32{1}}},
+		"order":     {ID: "x", Sparse: &SparseVector{Dim: 4, Indices: []int32{2, 1}, Values: []float32{1, 1}}},
+		"range":     {ID: "x", Sparse: &SparseVector{Dim: 4, Indices: []int32{4}, Values: []float32{1}}},
+		"lengths":   {ID: "x", Sparse: &SparseVector{Dim: 4, Indices: []int32{0, 1}, Values: []float32{1}}},
+		"nonfinite": {ID: "x", Sparse: &SparseVector{Dim: 4, Indices: []int32{0}, Values: []float32{float32(math.NaN())}}},
+	} {
+		if err := store.AddRecord(rec); err == nil {
+			t.Errorf("%s: invalid sparse record accepted", name)
+		}
+	}
+	if err := store.AddRecord(Record{ID: "x", Sparse: &SparseVector{Dim: 3}}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("err = %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestSparseSnapshotRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	store := NewVectorStore()
+	store.SparseStorage = true
+	vectors := sparseVectors(rng, 20, 64, 3)
+	for i, v := range vectors {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Dim != 64 || loaded.Records[0].Sparse == nil || loaded.Records[0].Vector != nil {
+		t.Fatalf("loaded dim %d, record %+v", loaded.Dim, loaded.Records[0])
+	}
+	q := randomVectors(rng, 1, 64)[0]
+	if got, want := resultIDs(mustSearch(t, loaded, q, 5)), resultIDs(mustSearch(t, store, q, 5)); !reflect.DeepEqual(got, want) {
+		t.Errorf("after load %v, before %v", got, want)
+	}
+}
+
+func TestSparseStorageMemory(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	vectors := sparseVectors(rng, 200, 1024, 10)
+	dense, sparse := NewVectorStore(), NewVectorStore()
+	sparse.SparseStorage = true
+	for i, v := range vectors {
+		dense.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+		sparse.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	d, s := dense.Stats().MemoryBytes, sparse.Stats().MemoryBytes
+	t.Logf("dense %d bytes, sparse %d bytes", d, s)
+	if s*4 > d {
+		t.Errorf("sparse storage takes %d bytes, dense %d; want under a quarter", s, d)
+	}
+}
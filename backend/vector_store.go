@@ -1,61 +1,441 @@
 package main
 
 import (
+	"cmp"
 	"container/heap"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"math"
 	"os"
-	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Vector []float32
 
-// SearchResult used by the Min-Heap
+// Original returns the vector as it was inserted, undoing normalization
+// to within float32 rounding, and expanded if it is stored sparse. The
+// result may share memory with Vector.
+func (r Record) Original() Vector {
+	if r.Sparse != nil {
+		return r.originalSparse().Dense()
+	}
+	if r.Norm == 0 {
+		return r.Vector
+	}
+	out := make(Vector, len(r.Vector))
+	for i, x := range r.Vector {
+		out[i] = x * r.Norm
+	}
+	return out
+}
+
+// Float64ToVector downcasts a float64 slice, as exported by NumPy, to the
+// store's float32 representation. Each element is rounded to the nearest
+// float32, which keeps about 7 significant digits (relative error below
+// 6e-8); cosine and dot scores are unaffected at embedding precision.
+// Magnitudes beyond float32's ~3.4e38 range become ±Inf.
+func Float64ToVector(v []float64) Vector {
+	out := make(Vector, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
+
+// ErrDimensionMismatch is returned when a vector's length differs from the
+// dimension established by the first insert.
+var ErrDimensionMismatch = errors.New("vector dimension mismatch")
+
+// ErrNonFinite is returned for a vector with a NaN or infinite component,
+// which would poison every score computed against it.
+var ErrNonFinite = errors.New("vector has non-finite components")
+
+// ErrVectorTooLarge is returned for a vector longer than MaxDim.
+var ErrVectorTooLarge = errors.New("vector too large")
+
+// ErrClosed is returned for writes to a store after Close.
+var ErrClosed = errors.New("vector store is closed")
+
+// ErrInvalidK is returned when a search asks for a non-positive number of
+// results.
+var ErrInvalidK = errors.New("k must be positive")
+
+// ErrNotFound is returned for an ID that is not in the store.
+var ErrNotFound = errors.New("record not found")
+
+// Metric selects how Search scores a query against stored vectors: one of
+// the constants below or a name added with RegisterMetric.
+type Metric string
+
+const (
+	// MetricCosine scores by dot product of L2-normalized vectors.
+	MetricCosine Metric = "cosine"
+	// MetricDot scores by raw dot product; magnitudes are preserved.
+	MetricDot Metric = "dot"
+	// MetricL2 scores by Euclidean distance, where smaller is better.
+	MetricL2 Metric = "l2"
+	// MetricAngular scores by angular distance, arccos(cosine)/π in
+	// [0, 1], where smaller is better. Unlike 1 - cosine it satisfies the
+	// triangle inequality, which clustering relies on. Vectors are
+	// normalized as for cosine, and searches are always exact: the
+	// quantized, PQ and projected modes rank by dot product.
+	MetricAngular Metric = "angular"
+)
+
+// HigherIsBetter reports whether larger scores rank first under the metric.
+func (m Metric) HigherIsBetter() bool {
+	if c, ok := m.custom(); ok {
+		return c.higherIsBetter
+	}
+	return m != MetricL2 && m != MetricAngular
+}
+
+// approximable reports whether the quantized, binary, PQ and projected
+// modes may score under m.
+func (m Metric) approximable() bool { return m.builtin() && m != MetricAngular }
+
+// normalizes reports whether vectors are stored and queried unit-length.
+func (m Metric) normalizes() bool { return m == MetricCosine || m == "" }
+
+// distance converts a score to a distance where 0 is an exact match:
+// 1 - cosine for MetricCosine, the score itself for MetricL2 and
+// MetricAngular. Raw dot products have no such distance and report false.
+func (m Metric) distance(score float32) (float32, bool) {
+	switch {
+	case m.normalizes():
+		return 1 - score, true
+	case m == MetricL2 || m == MetricAngular:
+		return score, true
+	}
+	return 0, false
+}
+
+// SearchResult is one ranked hit. Score depends on the store's metric:
+// cosine similarity in [-1, 1] for MetricCosine, the raw dot product for
+// MetricDot, the Euclidean distance for MetricL2, and the angular
+// distance in [0, 1] for MetricAngular.
 type SearchResult struct {
 	ID    string  `json:"id"`
 	Score float32 `json:"score"`
 }
 
-// ResultHeap implements heap.Interface for Top-K tracking
-type ResultHeap []SearchResult
+// DetailedResult is a search hit joined with its record's metadata.
+// Distance is 0 for an exact match (1 - cosine, or the L2 distance) and is
+// omitted under the dot metric, which has no such notion, and for boosted
+// searches, whose scores are no longer pure similarities. Normalized is
+// set when the search asked for a ScoreNormalization, and Vector when it
+// asked for IncludeVectors.
+type DetailedResult struct {
+	SearchResult
+	Distance   *float32            `json:"distance,omitempty"`
+	Normalized *float32            `json:"normalized_score,omitempty"`
+	Metadata   map[string]string   `json:"metadata"`
+	Tags       map[string][]string `json:"tags,omitempty"`
+	Version    int                 `json:"version"`
+	Vector     Vector              `json:"vector,omitempty"`
+}
+
+// ResultHeap implements heap.Interface for Top-K tracking. The worst
+// candidate always sits at the root so it can be evicted cheaply: a
+// Min-Heap of scores for similarities, a Max-Heap for distances. Equal
+// scores rank by ascending ID, so every heap, and hence every merge of
+// them, agrees on one total order and results are deterministic.
+type ResultHeap struct {
+	Items          []SearchResult
+	HigherIsBetter bool
+	// After, when set, makes Offer drop results that do not rank strictly
+	// behind it, so a heap can collect the page following After.
+	After *SearchResult
+}
+
+func NewResultHeap(higherIsBetter bool) *ResultHeap {
+	return &ResultHeap{HigherIsBetter: higherIsBetter}
+}
 
-func (h ResultHeap) Len() int           { return len(h) }
-func (h ResultHeap) Less(i, j int) bool { return h[i].Score < h[j].Score } // Min-Heap
-func (h ResultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
-func (h *ResultHeap) Push(x any)        { *h = append(*h, x.(SearchResult)) }
+func (h ResultHeap) Len() int           { return len(h.Items) }
+func (h ResultHeap) Less(i, j int) bool { return h.better(h.Items[j], h.Items[i]) }
+func (h ResultHeap) Swap(i, j int)      { h.Items[i], h.Items[j] = h.Items[j], h.Items[i] }
+func (h *ResultHeap) Push(x any)        { h.Items = append(h.Items, x.(SearchResult)) }
 func (h *ResultHeap) Pop() any {
-	old := *h
+	old := h.Items
 	n := len(old)
 	x := old[n-1]
-	*h = old[0 : n-1]
+	h.Items = old[0 : n-1]
 	return x
 }
 
+// better reports whether a ranks ahead of b.
+func (h ResultHeap) better(a, b SearchResult) bool {
+	if a.Score != b.Score {
+		if h.HigherIsBetter {
+			return a.Score > b.Score
+		}
+		return a.Score < b.Score
+	}
+	return a.ID < b.ID
+}
+
+// Offer adds res if fewer than k results are held, or replaces the
+// current worst result when res ranks ahead of it.
+func (h *ResultHeap) Offer(res SearchResult, k int) {
+	if k <= 0 || h.After != nil && !h.better(*h.After, res) {
+		return
+	}
+	if h.Len() < k {
+		heap.Push(h, res)
+	} else if h.better(res, h.Items[0]) {
+		heap.Pop(h)
+		heap.Push(h, res)
+	}
+}
+
+// Drain empties the heap and returns its results best-first.
+func (h *ResultHeap) Drain() []SearchResult {
+	results := make([]SearchResult, h.Len())
+	for i := h.Len() - 1; i >= 0; i-- {
+		results[i] = heap.Pop(h).(SearchResult)
+	}
+	return results
+}
+
 type Record struct {
-	ID        string            `json:"id"`
-	Vector    Vector            `json:"vector"`
-	Quantized []int8            `json:"quantized,omitempty"`
-	Metadata  map[string]string `json:"metadata"`
-	Namespace string            `json:"namespace"`
+	ID     string `json:"id"`
+	Vector Vector `json:"vector,omitempty"`
+	// Norm is the magnitude the vector had on insert when Vector holds
+	// its normalized form, and zero when Vector is stored as given. See
+	// Original.
+	Norm      float32 `json:"norm,omitempty"`
+	Quantized []int8  `json:"quantized,omitempty"`
+	QScale    float32 `json:"q_scale,omitempty"`
+	QOffset   float32 `json:"q_offset,omitempty"`
+	// PQ holds the product quantization codes once TrainPQ has run (see
+	// pq.go).
+	PQ []uint8 `json:"pq,omitempty"`
+	// Projected is Vector through the store's random projection, once
+	// EnableProjection has run (see projection.go). It is rebuilt on load.
+	Projected Vector `json:"-"`
+	// Sparse, when set, holds the vector instead of Vector, which is then
+	// empty; see sparse.go.
+	Sparse *SparseVector `json:"sparse,omitempty"`
+	// Binary holds the sign-bit codes (see bitquant.go). They are cheap
+	// to derive, so they are rebuilt on load rather than persisted.
+	Binary   []uint64          `json:"-"`
+	Metadata map[string]string `json:"metadata"`
+	// Tags holds list-valued metadata, e.g. "tags": ["a", "b"], for the
+	// contains filter operators. Keys are separate from Metadata's.
+	Tags      map[string][]string `json:"tags,omitempty"`
+	Namespace string              `json:"namespace"`
+	// Version starts at 1 and is bumped by every write to the record; see
+	// AddRecordIfVersion.
+	Version int `json:"version"`
+	// ExpiresAt, when set, is when the record stops matching searches;
+	// the expiry sweeper deletes it some time after.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Seq orders inserts: adding or replacing the record stamps it anew
+	// from a store-wide counter, for eviction (see eviction.go).
+	Seq uint64 `json:"seq,omitempty"`
+	// Deleted marks a tombstone left by a soft delete; see SoftDelete.
+	// Tombstones are never saved.
+	Deleted bool `json:"-"`
+}
+
+// cloneTags deep-copies a Tags map.
+func cloneTags(tags map[string][]string) map[string][]string {
+	if tags == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(tags))
+	for k, v := range tags {
+		out[k] = slices.Clone(v)
+	}
+	return out
+}
+
+// expired reports whether rec has an expiry at or before now.
+func (rec *Record) expired(now time.Time) bool {
+	return !rec.ExpiresAt.IsZero() && !now.Before(rec.ExpiresAt)
 }
 
 type VectorStore struct {
 	sync.RWMutex
-	Records []Record
+	// Metric used for scoring; set before inserting, since cosine
+	// normalizes vectors on the way in.
+	Metric Metric
+	// Normalize makes MetricCosine store and query unit-length vectors,
+	// and is on in NewVectorStore. Turned off, cosine keeps vectors as
+	// given and scores by their raw dot product, so magnitudes count, and
+	// results carry no distance. MetricAngular always normalizes, and
+	// the other metrics never do. Like
+	// Metric, set it before inserting or call Reindex after.
+	Normalize bool
+	// Dim is the vector dimension, fixed by the first insert.
+	Dim int
+	// UseQuantized scores against the int8 codes instead of the float
+	// vectors. Only similarity metrics are approximated; L2 always runs
+	// at full precision.
+	UseQuantized bool
+	// UseBinary shortlists candidates by sign-bit agreement (see
+	// bitquant.go) and always re-ranks them at full precision. It takes
+	// precedence over UseQuantized and, like it, does not apply to L2.
+	UseBinary bool
+	// UsePQ scores against the product quantization codes, once TrainPQ
+	// has built them, and re-ranks at full precision. Unlike the other
+	// codes it approximates L2 as well. UseBinary still takes precedence
+	// for similarity metrics.
+	UsePQ bool
+	// SanitizeNonFinite zeroes NaN and infinite components of inserted
+	// and query vectors instead of rejecting them with ErrNonFinite.
+	SanitizeNonFinite bool
+	// MaxDim, when positive, rejects vectors with more dimensions with
+	// ErrVectorTooLarge, on insert and query alike, so a runaway client
+	// cannot fix an absurd Dim on an empty store.
+	MaxDim int
+	// StrictDimensions makes Load fail on a snapshot whose records differ
+	// in dimension. By default it keeps the records of the most common
+	// dimension, dropping and logging the rest; either way Dim is then
+	// that dimension and inserts of another are rejected.
+	StrictDimensions bool
+	// SoftDelete makes DeleteItem leave a tombstone in place rather than
+	// swap-remove the record: the ID is freed at once and searches skip
+	// the slot, but the slice and namespace index are only rewritten by
+	// Compact, in one pass for any number of deletes.
+	SoftDelete bool
+	// CompactThreshold, when positive, compacts automatically once a
+	// soft delete brings the tombstone count to it.
+	CompactThreshold int
+	// SparseStorage stores added dense vectors sparsely when fewer than
+	// half their components are non-zero, which then takes less memory.
+	// Records given a Sparse vector are stored sparsely regardless.
+	SparseStorage bool
+	// MaxRecords, when positive, bounds the live records: a write going
+	// past it evicts by the Eviction policy, FIFO when unset. See
+	// eviction.go.
+	MaxRecords int
+	Eviction   EvictionPolicy
+	// PerNamespaceFiles makes Save and Load treat their path as a
+	// directory holding one snapshot file per namespace, and
+	// LoadNamespaces, when not empty, has Load read only those; see
+	// nsfiles.go. The other namespaces then refuse writes and keep their
+	// files when saved.
+	PerNamespaceFiles bool
+	LoadNamespaces    []string
+	// MmapSnapshots makes Load map binary snapshots into memory rather
+	// than copy the vectors out; see mmap.go.
+	MmapSnapshots bool
+	// MaxWorkers caps the goroutines a brute-force scan uses; 0 means one
+	// per CPU. Small scans use fewer (see workers.go).
+	MaxWorkers int
+	// RerankFactor, when above 1, makes approximate search collect
+	// k*RerankFactor candidates and re-score them at full precision; for
+	// HNSW it widens the graph search to as many candidates. 1 keeps the
+	// approximate scores; 0 leaves binary, PQ and projected search at
+	// defaultBinaryRerank, defaultPQRerank and defaultProjectionRerank and
+	// int8 mode unranked.
+	// SearchOptions.Rerank overrides it.
+	RerankFactor int
+	// QuantRange, when positive, quantizes every record over the fixed
+	// range [-QuantRange, QuantRange] rather than its own min/max. Call
+	// Reindex after changing it.
+	QuantRange float32
+	Records    []Record
 	// O(1) Lookup for Metadata
 	IDMap map[string]int
+	// Namespace index; see index.go.
+	nsIndex map[string][]int
+	nsPos   []int
+	// metaIndex holds the posting lists of the keys AddIndexedKey
+	// declared.
+	metaIndex map[string]map[string][]int
+	// hnsw is the optional ANN index; nil means brute-force only.
+	hnsw *HNSW
+	// pq holds the trained codebooks; nil until TrainPQ.
+	pq *ProductQuantizer
+	// proj is the random projection searches score with; nil until
+	// EnableProjection.
+	proj *Projection
+	// wal, when enabled, records every mutation before it is applied.
+	wal *writeAheadLog
+	// unitVectors records whether stored vectors were normalized on the
+	// way in, which Reindex needs to know after a metric change.
+	unitVectors bool
+	// changes counts mutations; saved is its value at the last snapshot,
+	// so the store is dirty while they differ. saveMu serializes
+	// snapshot writers, which share one temp file.
+	changes uint64
+	saved   atomic.Uint64
+	saveMu  sync.Mutex
+	// now is the clock record expiry is judged by; tests replace it.
+	now func() time.Time
+	// tombstones counts records marked Deleted.
+	tombstones int
+	// path is the snapshot file Load read, which Close saves to.
+	path string
+	// unloaded holds the namespaces LoadNamespaces left on disk.
+	unloaded map[string]bool
+	// closed is set by Close; writes then fail.
+	closed bool
+	// tick stamps Record.Seq and, under EvictLRU, lastAccess, which
+	// accessMu guards since searches write it under the read lock.
+	tick       atomic.Uint64
+	accessMu   sync.Mutex
+	lastAccess map[string]uint64
 }
 
 func NewVectorStore() *VectorStore {
 	return &VectorStore{
-		Records: []Record{},
-		IDMap:   make(map[string]int),
+		Metric:    MetricCosine,
+		Normalize: true,
+		Records:   []Record{},
+		IDMap:     make(map[string]int),
+		nsIndex:   make(map[string][]int),
+		now:       time.Now,
+	}
+}
+
+// normalizing reports whether vectors are stored and queried unit-length.
+func (vs *VectorStore) normalizing() bool {
+	return vs.Metric == MetricAngular || vs.Normalize && vs.Metric.normalizes()
+}
+
+// clock returns the current time by vs.now, falling back to time.Now
+// for stores not built by NewVectorStore.
+func (vs *VectorStore) clock() time.Time {
+	if vs.now == nil {
+		return time.Now()
 	}
+	return vs.now()
 }
 
-// DotProduct with loop unrolling to hint SIMD optimization
+// useSIMD selects the assembly DotProduct where the CPU supports it;
+// DISABLE_SIMD turns it off.
+var useSIMD = hasSIMD
+
+// simdMinLen is the length below which the call into assembly is not
+// worth it.
+const simdMinLen = 16
+
+// DotProduct returns the dot product of a and b, in SIMD assembly on CPUs
+// that support it and in unrolled Go otherwise. b must be at least as long
+// as a.
 func DotProduct(a, b Vector) float32 {
+	if useSIMD && len(a) >= simdMinLen {
+		return dotSIMD(a, b[:len(a)])
+	}
+	return dotGeneric(a, b)
+}
+
+// dotGeneric is the pure Go DotProduct, unrolled to hint SIMD
+// optimization.
+func dotGeneric(a, b Vector) float32 {
 	var sum float32
 	n := len(a)
 	// Manual unrolling for performance
@@ -68,12 +448,54 @@ func DotProduct(a, b Vector) float32 {
 	return sum
 }
 
-func Normalize(v Vector) Vector {
+// SquaredEuclidean returns the squared L2 distance, unrolled like
+// DotProduct. It orders the same as EuclideanDistance without the sqrt.
+func SquaredEuclidean(a, b Vector) float32 {
 	var sum float32
-	for _, val := range v {
-		sum += val * val
+	n := len(a)
+	for i := 0; i < n-3; i += 4 {
+		d0, d1, d2, d3 := a[i]-b[i], a[i+1]-b[i+1], a[i+2]-b[i+2], a[i+3]-b[i+3]
+		sum += d0*d0 + d1*d1 + d2*d2 + d3*d3
+	}
+	for i := (n / 4) * 4; i < n; i++ {
+		d := a[i] - b[i]
+		sum += d * d
 	}
-	mag := float32(math.Sqrt(float64(sum)))
+	return sum
+}
+
+// EuclideanDistance returns the L2 distance between a and b.
+func EuclideanDistance(a, b Vector) float32 {
+	return float32(math.Sqrt(float64(SquaredEuclidean(a, b))))
+}
+
+// score compares a query against a stored vector under the store's metric.
+func (vs *VectorStore) score(q, v Vector) float32 {
+	switch vs.Metric {
+	case MetricL2:
+		return EuclideanDistance(q, v)
+	case MetricCosine, MetricDot, "":
+		return DotProduct(q, v)
+	case MetricAngular:
+		return AngularDistance(DotProduct(q, v))
+	}
+	if c, ok := vs.Metric.custom(); ok {
+		return c.score(q, v)
+	}
+	return DotProduct(q, v)
+}
+
+// AngularDistance converts the cosine of an angle to the angle as a
+// fraction of π. The cosine is clamped to [-1, 1] first, since rounding
+// takes the dot product of parallel unit vectors just past 1, where
+// arccos is NaN.
+func AngularDistance(cos float32) float32 {
+	c := min(max(float64(cos), -1), 1)
+	return float32(math.Acos(c) / math.Pi)
+}
+
+func Normalize(v Vector) Vector {
+	mag := Magnitude(v)
 	if mag == 0 {
 		return v
 	}
@@ -84,143 +506,1873 @@ func Normalize(v Vector) Vector {
 	return res
 }
 
-// Scalar Quantization: Reduces memory footprint
-func Quantize(v Vector) []int8 {
-	res := make([]int8, len(v))
+// Magnitude returns the L2 norm of v.
+func Magnitude(v Vector) float32 {
+	var sum float32
+	for _, val := range v {
+		sum += val * val
+	}
+	return float32(math.Sqrt(float64(sum)))
+}
+
+// Scalar Quantization: Reduces memory footprint. Each vector is mapped
+// from its own [min, max] range onto the full int8 range, so that
+// v[i] ≈ q[i]*scale + offset. See Dequantize.
+func Quantize(v Vector) (q []int8, scale, offset float32) {
+	q = make([]int8, len(v))
+	if len(v) == 0 {
+		return q, 0, 0
+	}
+	lo, hi := v[0], v[0]
+	for _, val := range v {
+		lo = min(lo, val)
+		hi = max(hi, val)
+	}
+	scale = (hi - lo) / 255
+	offset = lo + 128*scale
+	if scale == 0 {
+		return q, 0, offset
+	}
+	for i, val := range v {
+		level := math.Round(float64((val - offset) / scale))
+		q[i] = int8(max(-128, min(127, level)))
+	}
+	return q, scale, offset
+}
+
+// QuantizeRange maps the fixed range [-r, r] onto the int8 codes, so that
+// v[i] ≈ q[i]*scale with scale = r/127. Values outside the range clamp to
+// the extreme codes instead of wrapping.
+func QuantizeRange(v Vector, r float32) (q []int8, scale float32) {
+	q = make([]int8, len(v))
+	scale = r / 127
 	for i, val := range v {
-		res[i] = int8(val * 127.0)
+		level := math.Round(float64(val / scale))
+		q[i] = int8(max(-128, min(127, level)))
+	}
+	return q, scale
+}
+
+// quantize encodes v the way the store is configured to: over a fixed
+// QuantRange when set, otherwise over v's own min/max.
+func (vs *VectorStore) quantize(v Vector) (q []int8, scale, offset float32) {
+	if vs.QuantRange > 0 {
+		q, scale = QuantizeRange(v, vs.QuantRange)
+		return q, scale, 0
+	}
+	return Quantize(v)
+}
+
+// Dequantize reconstructs an approximate vector from Quantize's output.
+func Dequantize(q []int8, scale, offset float32) Vector {
+	res := make(Vector, len(q))
+	for i, level := range q {
+		res[i] = float32(level)*scale + offset
 	}
 	return res
 }
 
-func (vs *VectorStore) AddItem(id string, vector Vector, meta map[string]string, namespace string) {
+// quantizedQuery is a query pre-quantized once so each record can be
+// scored from its codes alone.
+type quantizedQuery struct {
+	codes         []int8
+	scale, offset float32
+	codeSum       int32
+}
+
+func newQuantizedQuery(q Vector) quantizedQuery {
+	codes, scale, offset := Quantize(q)
+	var sum int32
+	for _, c := range codes {
+		sum += int32(c)
+	}
+	return quantizedQuery{codes: codes, scale: scale, offset: offset, codeSum: sum}
+}
+
+// dot approximates the float dot product with rec by expanding
+// (sa*a+oa)·(sb*b+ob) over the integer codes. The record's code sum is
+// accumulated in the same pass as the int8 dot product.
+func (qq quantizedQuery) dot(rec *Record) float32 {
+	a, b := qq.codes, rec.Quantized[:len(qq.codes)]
+	var dot, recSum int32
+	n := len(a)
+	for i := 0; i < n-3; i += 4 {
+		b0, b1, b2, b3 := int32(b[i]), int32(b[i+1]), int32(b[i+2]), int32(b[i+3])
+		dot += int32(a[i])*b0 + int32(a[i+1])*b1 + int32(a[i+2])*b2 + int32(a[i+3])*b3
+		recSum += b0 + b1 + b2 + b3
+	}
+	for i := (n / 4) * 4; i < n; i++ {
+		dot += int32(a[i]) * int32(b[i])
+		recSum += int32(b[i])
+	}
+	return qq.scale*rec.QScale*float32(dot) +
+		qq.scale*rec.QOffset*float32(qq.codeSum) +
+		qq.offset*rec.QScale*float32(recSum) +
+		float32(n)*qq.offset*rec.QOffset
+}
+
+// checkFinite returns v if every component is finite. Otherwise it fails
+// with ErrNonFinite or, under SanitizeNonFinite, returns a copy with the
+// offending components zeroed.
+func (vs *VectorStore) checkFinite(v Vector) (Vector, error) {
+	bad := slices.IndexFunc(v, func(x float32) bool {
+		return math.IsNaN(float64(x)) || math.IsInf(float64(x), 0)
+	})
+	if bad < 0 {
+		return v, nil
+	}
+	if !vs.SanitizeNonFinite {
+		return nil, fmt.Errorf("%w: component %d is %v", ErrNonFinite, bad, v[bad])
+	}
+	out := slices.Clone(v)
+	for i, x := range out {
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			out[i] = 0
+		}
+	}
+	return out, nil
+}
+
+// checkDim validates v against the store dimension. Callers hold the lock.
+func (vs *VectorStore) checkDim(v Vector) error {
+	if err := vs.checkMaxDim(len(v)); err != nil {
+		return err
+	}
+	if vs.Dim != 0 && len(v) != vs.Dim {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(v), vs.Dim)
+	}
+	return nil
+}
+
+// checkMaxDim rejects a dimension above MaxDim.
+func (vs *VectorStore) checkMaxDim(dim int) error {
+	if vs.MaxDim > 0 && dim > vs.MaxDim {
+		return fmt.Errorf("%w: %d dimensions, at most %d allowed", ErrVectorTooLarge, dim, vs.MaxDim)
+	}
+	return nil
+}
+
+// ErrVersionConflict is returned by AddRecordIfVersion when the stored
+// record has moved on from the version the caller last read.
+var ErrVersionConflict = errors.New("version conflict")
+
+func (vs *VectorStore) AddItem(id string, vector Vector, meta map[string]string, namespace string) error {
+	return vs.AddRecord(Record{ID: id, Vector: vector, Metadata: meta, Namespace: namespace})
+}
+
+// AddRecord inserts rec, or replaces the record with the same ID. Only
+// its ID, Vector, Metadata, Tags, Namespace and ExpiresAt are taken; the
+// rest is derived.
+func (vs *VectorStore) AddRecord(rec Record) error {
 	vs.Lock()
 	defer vs.Unlock()
-
-	norm := Normalize(vector)
-	record := Record{
-		ID:        id,
-		Vector:    norm,
-		Quantized: Quantize(norm),
-		Metadata:  meta,
-		Namespace: namespace,
+	if err := vs.addLocked(rec); err != nil {
+		return err
 	}
+	vs.evictLocked()
+	return vs.syncWAL()
+}
 
-	if idx, exists := vs.IDMap[id]; exists {
-		vs.Records[idx] = record
-	} else {
-		vs.IDMap[id] = len(vs.Records)
-		vs.Records = append(vs.Records, record)
+// AddRecordIfVersion is AddRecord guarded by optimistic concurrency: the
+// write only happens if the record's current version is version, where 0
+// means the ID must not exist yet. Otherwise it fails with
+// ErrVersionConflict.
+func (vs *VectorStore) AddRecordIfVersion(rec Record, version int) error {
+	vs.Lock()
+	defer vs.Unlock()
+	if current := vs.versionLocked(rec.ID); current != version {
+		return fmt.Errorf("%w: %s is at version %d, not %d", ErrVersionConflict, rec.ID, current, version)
+	}
+	if err := vs.addLocked(rec); err != nil {
+		return err
 	}
+	vs.evictLocked()
+	return vs.syncWAL()
+}
+
+// ReplaceVector swaps the vector of the record id as UpdateVector does,
+// provided it is still at version; otherwise it fails with
+// ErrVersionConflict, e.g. when a client rewrote the record in the
+// meantime, or ErrNotFound once it is gone.
+func (vs *VectorStore) ReplaceVector(id string, vector Vector, version int) error {
+	vs.Lock()
+	defer vs.Unlock()
+	return vs.replaceVectorLocked(id, vector, version)
 }
 
-func (vs *VectorStore) Search(query Vector, k int, namespace string, filterKey, filterVal string) []SearchResult {
+// Version returns the record's current version, or 0 if id is unknown.
+func (vs *VectorStore) Version(id string) int {
 	vs.RLock()
 	defer vs.RUnlock()
+	return vs.versionLocked(id)
+}
 
-	q := Normalize(query)
-	numWorkers := runtime.NumCPU()
-	workChan := make(chan []SearchResult, numWorkers)
-	var wg sync.WaitGroup
+func (vs *VectorStore) versionLocked(id string) int {
+	if idx, ok := vs.IDMap[id]; ok {
+		return vs.Records[idx].Version
+	}
+	return 0
+}
+
+// BatchAddItem inserts records under a single write lock. The returned slice
+// is parallel to records and holds a nil entry for each successful insert;
+// later records with a duplicate ID overwrite earlier ones.
+func (vs *VectorStore) BatchAddItem(records []Record) []error {
+	vs.Lock()
+	defer vs.Unlock()
 
-	chunkSize := (len(vs.Records) + numWorkers - 1) / numWorkers
+	errs := make([]error, len(records))
+	for i, rec := range records {
+		errs[i] = vs.addLocked(rec)
+	}
+	// Evicting after the whole batch sorts the store once, though a
+	// batch larger than MaxRecords then evicts some of its own records.
+	vs.evictLocked()
+	// The batch is synced once; if that fails none of it is durable.
+	if err := vs.syncWAL(); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
 
-	for i := 0; i < numWorkers; i++ {
-		start := i * chunkSize
-		if start >= len(vs.Records) {
-			break
+// checkVector validates rec's dense or sparse vector against the store,
+// sanitizing it if SanitizeNonFinite is set, and moves a dense vector to
+// sparse form under SparseStorage.
+func (vs *VectorStore) checkVector(rec *Record) error {
+	if s := rec.Sparse; s != nil {
+		if len(rec.Vector) > 0 {
+			return errors.New("a record takes a dense or a sparse vector, not both")
 		}
-		end := start + chunkSize
-		if end > len(vs.Records) {
-			end = len(vs.Records)
+		if s.Dim == 0 {
+			return fmt.Errorf("%w: empty vector", ErrDimensionMismatch)
 		}
+		if err := vs.checkMaxDim(s.Dim); err != nil {
+			return err
+		}
+		if vs.Dim != 0 && s.Dim != vs.Dim {
+			return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, s.Dim, vs.Dim)
+		}
+		if err := s.validate(); err != nil {
+			return err
+		}
+		values, err := vs.checkFinite(s.Values)
+		if err != nil {
+			return err
+		}
+		rec.Sparse = &SparseVector{Dim: s.Dim, Indices: s.Indices, Values: values}
+		return nil
+	}
 
-		wg.Add(1)
-		go func(s, e int) {
-			defer wg.Done()
-			h := &ResultHeap{}
-			heap.Init(h)
-
-			for j := s; j < e; j++ {
-				rec := vs.Records[j]
+	if len(rec.Vector) == 0 {
+		return fmt.Errorf("%w: empty vector", ErrDimensionMismatch)
+	}
+	if err := vs.checkDim(rec.Vector); err != nil {
+		return err
+	}
+	var err error
+	if rec.Vector, err = vs.checkFinite(rec.Vector); err != nil {
+		return err
+	}
+	if vs.SparseStorage {
+		nonZero := 0
+		for _, x := range rec.Vector {
+			if x != 0 {
+				nonZero++
+			}
+		}
+		if 2*nonZero < len(rec.Vector) {
+			rec.Sparse, rec.Vector = ToSparse(rec.Vector), nil
+		}
+	}
+	return nil
+}
 
-				// Namespace & Pre-filtering
-				if namespace != "" && rec.Namespace != namespace {
-					continue
-				}
-				if filterKey != "" && rec.Metadata[filterKey] != filterVal {
-					continue
-				}
+// encode derives rec's int8, binary, PQ and projected codes from its
+// normalized vector. Sparse records only get binary codes.
+func (vs *VectorStore) encode(rec *Record) {
+	rec.PQ, rec.Projected = nil, nil
+	if rec.Sparse != nil {
+		rec.Quantized, rec.QScale, rec.QOffset = nil, 0, 0
+		rec.Binary = QuantizeBinary(rec.Sparse.Dense())
+		return
+	}
+	rec.Quantized, rec.QScale, rec.QOffset = vs.quantize(rec.Vector)
+	rec.Binary = QuantizeBinary(rec.Vector)
+	if vs.pq != nil {
+		rec.PQ = vs.pq.encode(rec.Vector)
+	}
+	if vs.proj != nil {
+		rec.Projected = vs.proj.apply(rec.Vector)
+	}
+}
 
-				score := DotProduct(q, rec.Vector)
-				res := SearchResult{ID: rec.ID, Score: score}
+// addLocked validates, normalizes and quantizes rec, then inserts it or
+// replaces the record with the same ID, one version on. Callers hold the
+// write lock.
+func (vs *VectorStore) addLocked(rec Record) error {
+	if vs.closed {
+		return ErrClosed
+	}
+	if err := vs.checkVector(&rec); err != nil {
+		return err
+	}
+	if err := vs.checkLoadedLocked(rec.Namespace); err != nil {
+		return err
+	}
+	// The version is derived from the store, so replaying the log
+	// arrives at the same numbers.
+	rec.Version = vs.versionLocked(rec.ID) + 1
+	if err := vs.logOp(walOp{Op: "add", Record: &rec}); err != nil {
+		return err
+	}
+	vs.changes++
+	rec.Seq = vs.tick.Add(1)
+	if vs.Dim == 0 {
+		vs.Dim = rec.dim()
+	}
 
-				if h.Len() < k {
-					heap.Push(h, res)
-				} else if score > (*h)[0].Score {
-					heap.Pop(h)
-					heap.Push(h, res)
-				}
-			}
+	rec.Norm = 0
+	if vs.normalizing() {
+		rec.normalize()
+	}
+	vs.encode(&rec)
+	if len(vs.Records) == 0 {
+		vs.unitVectors = vs.normalizing()
+	}
 
-			results := make([]SearchResult, h.Len())
-			for idx := h.Len() - 1; idx >= 0; idx-- {
-				results[idx] = heap.Pop(h).(SearchResult)
-			}
-			workChan <- results
-		}(start, end)
+	if vs.hnsw != nil {
+		vs.hnsw.insert(rec.ID, rec.dense())
+	}
+	if idx, exists := vs.IDMap[rec.ID]; exists {
+		moved := vs.Records[idx].Namespace != rec.Namespace
+		if moved {
+			vs.unindexNamespace(idx)
+		}
+		vs.unindexMetadata(idx)
+		vs.Records[idx] = rec
+		if moved {
+			vs.indexNamespace(idx)
+		}
+		vs.indexMetadata(idx)
+	} else {
+		vs.IDMap[rec.ID] = len(vs.Records)
+		vs.Records = append(vs.Records, rec)
+		vs.indexNamespace(len(vs.Records) - 1)
+		vs.indexMetadata(len(vs.Records) - 1)
 	}
+	return nil
+}
 
-	go func() {
-		wg.Wait()
-		close(workChan)
-	}()
+// DeleteItem removes the record with the given ID and reports whether it
+// existed. The last record is swapped into the freed slot so only one
+// IDMap entry has to be rewritten, unless SoftDelete defers that to
+// Compact.
+func (vs *VectorStore) DeleteItem(id string) bool {
+	vs.Lock()
+	defer vs.Unlock()
 
-	finalHeap := &ResultHeap{}
-	heap.Init(finalHeap)
-	for chunk := range workChan {
-		for _, res := range chunk {
-			if finalHeap.Len() < k {
-				heap.Push(finalHeap, res)
-			} else if res.Score > (*finalHeap)[0].Score {
-				heap.Pop(finalHeap)
-				heap.Push(finalHeap, res)
-			}
+	if !vs.deleteLocked(id) {
+		return false
+	}
+	if err := vs.syncWAL(); err != nil {
+		log.Printf("delete %s: %v", id, err)
+	}
+	return true
+}
+
+// deleteLocked swap-removes or tombstones the record with the given ID.
+// Callers hold the write lock.
+func (vs *VectorStore) deleteLocked(id string) bool {
+	idx, exists := vs.IDMap[id]
+	if !exists || vs.closed {
+		return false
+	}
+	if err := vs.logOp(walOp{Op: "delete", ID: id}); err != nil {
+		log.Printf("delete %s: %v", id, err)
+	}
+	vs.changes++
+	if vs.lastAccess != nil {
+		vs.forget(id)
+	}
+	if vs.hnsw != nil {
+		vs.hnsw.remove(id)
+	}
+	if vs.SoftDelete {
+		vs.Records[idx].Deleted = true
+		vs.tombstones++
+		delete(vs.IDMap, id)
+		if vs.CompactThreshold > 0 && vs.tombstones >= vs.CompactThreshold {
+			vs.compactLocked()
+		}
+		return true
+	}
+	vs.unindexNamespace(idx)
+	vs.unindexMetadata(idx)
+	last := len(vs.Records) - 1
+	if idx != last {
+		vs.Records[idx] = vs.Records[last]
+		if !vs.Records[idx].Deleted {
+			vs.IDMap[vs.Records[idx].ID] = idx
 		}
+		vs.moveNamespaceEntry(last, idx)
+		vs.moveMetadataEntry(last, idx)
 	}
+	vs.Records[last] = Record{}
+	vs.Records = vs.Records[:last]
+	vs.nsPos = vs.nsPos[:last]
+	delete(vs.IDMap, id)
+	return true
+}
+
+// Compact removes the tombstones soft deletes left behind, keeping the
+// other records in order, rebuilds the indexes and returns how many went.
+func (vs *VectorStore) Compact() int {
+	vs.Lock()
+	defer vs.Unlock()
+	return vs.compactLocked()
+}
 
-	finalResults := make([]SearchResult, finalHeap.Len())
-	for i := finalHeap.Len() - 1; i >= 0; i-- {
-		finalResults[i] = heap.Pop(finalHeap).(SearchResult)
+func (vs *VectorStore) compactLocked() int {
+	n := vs.tombstones
+	if n > 0 {
+		vs.deleteWhereLocked(func(*Record) bool { return false })
 	}
-	return finalResults
+	return n
 }
 
-func (vs *VectorStore) Save(filename string) error {
-	vs.RLock()
-	defer vs.RUnlock()
-	data, err := json.Marshal(vs.Records)
-	if err != nil {
-		return err
+// OptimizeReport says what Optimize did. Before and After count the
+// record slots, tombstones included.
+type OptimizeReport struct {
+	Before    int  `json:"before"`
+	After     int  `json:"after"`
+	Reclaimed int  `json:"reclaimed"`
+	Sorted    bool `json:"sorted"`
+}
+
+// Optimize tidies the store after heavy churn: it compacts away the
+// tombstones, with byNamespace reorders the records so each namespace's
+// are contiguous, stably, then rebuilds IDMap, the secondary indexes and
+// the HNSW graph, which otherwise keeps removed nodes. Contiguous
+// namespaces make a namespaced scan walk memory in order.
+func (vs *VectorStore) Optimize(byNamespace bool) (OptimizeReport, error) {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return OptimizeReport{}, ErrClosed
+	}
+
+	report := OptimizeReport{Before: len(vs.Records), Sorted: byNamespace}
+	report.Reclaimed = vs.compactLocked()
+	byNS := func(a, b Record) int { return cmp.Compare(a.Namespace, b.Namespace) }
+	reordered := byNamespace && !slices.IsSortedFunc(vs.Records, byNS)
+	if reordered {
+		slices.SortStableFunc(vs.Records, byNS)
+	}
+	if report.Reclaimed > 0 || reordered {
+		// A new layout needs saving even when no record changed.
+		vs.changes++
 	}
-	return os.WriteFile(filename, data, 0644)
+	vs.rebuildIndexesLocked()
+	vs.rebuildHNSWLocked()
+	report.After = len(vs.Records)
+	return report, nil
 }
 
-func (vs *VectorStore) Load(filename string) error {
+// DeleteByFilter removes every record in namespace (all namespaces when
+// empty) whose metadata matches filter, and returns how many went. The
+// survivors keep their relative order and the indexes are rebuilt once,
+// rather than patched per record as DeleteItem does.
+func (vs *VectorStore) DeleteByFilter(namespace string, filter Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
 	vs.Lock()
 	defer vs.Unlock()
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return err
+	if vs.closed {
+		return 0, ErrClosed
 	}
-	err = json.Unmarshal(data, &vs.Records)
-	if err != nil {
-		return err
+
+	deleted := vs.deleteWhereLocked(func(rec *Record) bool {
+		return (namespace == "" || rec.Namespace == namespace) && filter.Matches(rec.Metadata, rec.Tags)
+	})
+	if deleted > 0 {
+		if err := vs.syncWAL(); err != nil {
+			log.Printf("delete by filter: %v", err)
+		}
+	}
+	return deleted, nil
+}
+
+// DropNamespace deletes every record in namespace in one pass and returns
+// how many went. Unlike DeleteByFilter, an empty namespace means the
+// records stored without one, not all of them. The indexes are rebuilt
+// without the namespace.
+func (vs *VectorStore) DropNamespace(namespace string) (int, error) {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return 0, ErrClosed
+	}
+
+	deleted := vs.deleteWhereLocked(func(rec *Record) bool { return rec.Namespace == namespace })
+	if deleted > 0 {
+		if err := vs.syncWAL(); err != nil {
+			log.Printf("drop namespace %s: %v", namespace, err)
+		}
 	}
+	return deleted, nil
+}
 
-	vs.IDMap = make(map[string]int)
-	for i, rec := range vs.Records {
-		vs.IDMap[rec.ID] = i
+// deleteWhereLocked removes every record drop selects, and any
+// tombstones, keeping the rest in order, and rebuilds the indexes once.
+// Callers hold the write lock and sync the log.
+func (vs *VectorStore) deleteWhereLocked(drop func(*Record) bool) int {
+	if vs.closed {
+		return 0
+	}
+	kept := vs.Records[:0]
+	deleted := 0
+	for i := range vs.Records {
+		rec := vs.Records[i]
+		if rec.Deleted {
+			// Logged when it was tombstoned.
+			continue
+		}
+		if !drop(&rec) {
+			kept = append(kept, rec)
+			continue
+		}
+		if err := vs.logOp(walOp{Op: "delete", ID: rec.ID}); err != nil {
+			log.Printf("delete %s: %v", rec.ID, err)
+		}
+		if vs.hnsw != nil {
+			vs.hnsw.remove(rec.ID)
+		}
+		deleted++
+	}
+	if deleted == 0 && vs.tombstones == 0 {
+		return 0
+	}
+	if deleted > 0 {
+		vs.changes++
+	}
+	clear(vs.Records[len(kept):])
+	vs.Records = kept
+	vs.tombstones = 0
+	vs.rebuildIndexesLocked()
+	return deleted
+}
+
+// SweepExpired deletes every record whose expiry has passed and returns
+// how many went.
+func (vs *VectorStore) SweepExpired() int {
+	vs.Lock()
+	defer vs.Unlock()
+
+	now := vs.clock()
+	deleted := vs.deleteWhereLocked(func(rec *Record) bool { return rec.expired(now) })
+	if deleted > 0 {
+		if err := vs.syncWAL(); err != nil {
+			log.Printf("sweep expired: %v", err)
+		}
+	}
+	return deleted
+}
+
+// StartExpirySweeper runs SweepExpired every interval until the returned
+// function is called; it waits for an in-flight sweep to finish.
+func (vs *VectorStore) StartExpirySweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				vs.SweepExpired()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// UpdateMetadata changes a record's metadata without touching its vector.
+// With merge set, keys in meta are added to or overwrite the existing
+// metadata; otherwise meta replaces it. It reports false for unknown IDs.
+func (vs *VectorStore) UpdateMetadata(id string, meta map[string]string, merge bool) bool {
+	vs.Lock()
+	defer vs.Unlock()
+
+	if !vs.updateMetadataLocked(id, meta, merge) {
+		return false
+	}
+	if err := vs.syncWAL(); err != nil {
+		log.Printf("update metadata %s: %v", id, err)
+	}
+	return true
+}
+
+// UpdateVector replaces the vector of the record id, keeping its ID,
+// metadata, tags, namespace and expiry, and reports whether it did. It is
+// false for an unknown or expired id and for a vector AddItem would
+// reject; setVector says which.
+func (vs *VectorStore) UpdateVector(id string, v Vector) bool {
+	return vs.setVector(id, v) == nil
+}
+
+// setVector is UpdateVector, failing with ErrNotFound for an unknown id.
+func (vs *VectorStore) setVector(id string, v Vector) error {
+	vs.Lock()
+	defer vs.Unlock()
+	return vs.replaceVectorLocked(id, v, anyVersion)
+}
+
+// anyVersion tells replaceVectorLocked to skip the version check.
+const anyVersion = -1
+
+// replaceVectorLocked swaps the vector of the record id, if it is at
+// version or version is anyVersion. The record is re-added as rewritten,
+// so it is normalized, encoded and logged like any insert and its version
+// moves on.
+func (vs *VectorStore) replaceVectorLocked(id string, v Vector, version int) error {
+	idx, ok := vs.IDMap[id]
+	if !ok || vs.Records[idx].expired(vs.clock()) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if current := vs.Records[idx].Version; version != anyVersion && current != version {
+		return fmt.Errorf("%w: %s is at version %d, not %d", ErrVersionConflict, id, current, version)
+	}
+	rec := vs.Records[idx].asInserted()
+	rec.Vector, rec.Sparse = v, nil
+	if err := vs.addLocked(rec); err != nil {
+		return err
+	}
+	return vs.syncWAL()
+}
+
+// updateMetadataLocked installs a fresh map rather than mutating the old
+// one, since search results may still reference it. Callers hold the
+// write lock.
+func (vs *VectorStore) updateMetadataLocked(id string, meta map[string]string, merge bool) bool {
+	idx, exists := vs.IDMap[id]
+	if !exists || vs.closed {
+		return false
+	}
+	if err := vs.logOp(walOp{Op: "metadata", ID: id, Metadata: meta, Merge: merge}); err != nil {
+		log.Printf("update metadata %s: %v", id, err)
+	}
+	vs.changes++
+
+	next := make(map[string]string, len(meta))
+	if merge {
+		maps.Copy(next, vs.Records[idx].Metadata)
+	}
+	maps.Copy(next, meta)
+	vs.unindexMetadata(idx)
+	vs.Records[idx].Metadata = next
+	vs.indexMetadata(idx)
+	vs.Records[idx].Version++
+	return true
+}
+
+// ErrNormalizedVectors is returned by Reindex when moving to a metric that
+// needs magnitudes some stored vectors no longer have: those loaded from
+// snapshots written before Record.Norm existed.
+var ErrNormalizedVectors = errors.New("stored vectors are normalized without their norms; re-add them to switch to a non-normalizing metric")
+
+// Reindex re-derives all metric- and quantization-dependent state from
+// the stored vectors: normalization, int8, binary and PQ codes,
+// projections, and the HNSW graph if one is built. Call it after changing
+// Metric, Normalize or QuantRange.
+// The PQ codebooks are kept as trained, and the projection matrix as
+// generated.
+// Leaving cosine restores each vector's original magnitude from its Norm.
+func (vs *VectorStore) Reindex() error {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return ErrClosed
+	}
+
+	normalize := vs.normalizing()
+	if vs.unitVectors && !normalize {
+		for i := range vs.Records {
+			if rec := &vs.Records[i]; rec.Norm == 0 && rec.magnitude() != 0 {
+				return ErrNormalizedVectors
+			}
+		}
+	}
+	for i := range vs.Records {
+		rec := &vs.Records[i]
+		switch {
+		case normalize && !vs.unitVectors:
+			rec.normalize()
+		case !normalize && vs.unitVectors:
+			rec.denormalize()
+		}
+		vs.encode(rec)
+	}
+	vs.unitVectors = normalize
+	vs.rebuildHNSWLocked()
+	vs.changes++
+	return nil
+}
+
+// rebuildHNSWLocked rebuilds the HNSW graph, if one is built, from the
+// live records with its current parameters, leaving out the nodes of
+// removed ones.
+func (vs *VectorStore) rebuildHNSWLocked() {
+	old := vs.hnsw
+	if old == nil {
+		return
+	}
+	h := newHNSW(vs.Metric, old.M, old.EfConstruction)
+	h.EfSearch = old.EfSearch
+	for i := range vs.Records {
+		if !vs.Records[i].Deleted {
+			h.insert(vs.Records[i].ID, vs.Records[i].dense())
+		}
+	}
+	vs.hnsw = h
+}
+
+// SearchOptions narrows and sizes a search.
+type SearchOptions struct {
+	K int
+	// Namespace restricts the search to one namespace; empty searches all.
+	Namespace string
+	// Namespaces restricts the search to any of several namespaces, merged
+	// into one top K. It combines with Namespace when both are set.
+	Namespaces []string
+	Filter     Filter
+	// IDPrefix, if set, restricts the search to IDs starting with it, e.g.
+	// "user123:" for one user's documents.
+	IDPrefix string
+	// IDs, if not nil, restricts the search to these IDs; an empty slice
+	// matches nothing. The scan then visits just those records.
+	IDs []string
+	// MinScore, if set, drops results scoring below it once the top K is
+	// known. Under MetricL2 it is a maximum distance instead.
+	MinScore *float32
+	// Rerank, when positive, replaces the store's RerankFactor for this
+	// search.
+	Rerank int
+	// Boost, if set, re-ranks the vector candidates by a metadata field;
+	// see boost.go. MinScore still applies to the vector score.
+	Boost *Boost
+	// After, if set, returns the page of results ranking strictly behind
+	// it in (score, ID) order; pass the last result of the previous page.
+	// Approximate modes page through their re-rank candidates, so pages
+	// beyond the RerankFactor come up short. It cannot be combined with
+	// Boost.
+	After *SearchResult
+	// OnCandidates, if set, receives each worker's partial top-K as it
+	// completes, before the final merge. It runs on the merging goroutine
+	// with the read lock held, so it should not block for long. In
+	// quantized mode with reranking the candidate scores are approximate.
+	OnCandidates func([]SearchResult)
+	// Explain, if set, is filled in with counters describing the search;
+	// see explain.go. Batch searches ignore it.
+	Explain *Explain
+	// NormalizeScores, if set, has SearchDetailed fill in each result's
+	// Normalized score; see scorenorm.go.
+	NormalizeScores ScoreNormalization
+	// IncludeVectors has SearchDetailed attach each result's vector as
+	// inserted (see Record.Original), for clients that re-rank
+	// themselves. At 4 bytes a dimension in memory, and roughly 10 per
+	// dimension as JSON, it dwarfs the rest of a result: 100 results of
+	// 1536 dimensions come to about 1.5 MB.
+	IncludeVectors bool
+
+	// ctx, set by the Context variants, cancels the scan; nil never does.
+	ctx context.Context
+}
+
+// Search is the single key/value form of SearchWithOptions. It returns
+// IDs and scores only; use SearchDetailed when the metadata is needed too.
+func (vs *VectorStore) Search(query Vector, k int, namespace string, filterKey, filterVal string) ([]SearchResult, error) {
+	opts := SearchOptions{K: k, Namespace: namespace}
+	if filterKey != "" {
+		opts.Filter.Conditions = []Condition{{Field: filterKey, Value: FilterValue(filterVal)}}
+	}
+	return vs.SearchWithOptions(query, opts)
+}
+
+// SearchWithOptions returns the top opts.K matches, best first. The slice
+// is never nil: an empty store or a filter matching nothing yields an
+// empty result.
+func (vs *VectorStore) SearchWithOptions(query Vector, opts SearchOptions) ([]SearchResult, error) {
+	return vs.SearchContext(context.Background(), query, opts)
+}
+
+// SearchContext is SearchWithOptions, abandoned once ctx is done: scan
+// workers check it before each block of records (see workers.go) and the
+// search then fails with ctx's error.
+func (vs *VectorStore) SearchContext(ctx context.Context, query Vector, opts SearchOptions) ([]SearchResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	q, err := vs.prepareQuery(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.ctx = ctx
+	results := vs.searchLocked(q, opts)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	vs.touch(results)
+	return results, nil
+}
+
+// prepareQuery validates opts and query and returns the query as the
+// scan expects it: normalized under the normalizing metrics.
+func (vs *VectorStore) prepareQuery(query Vector, opts SearchOptions) (Vector, error) {
+	if err := opts.validate(vs.Metric); err != nil {
+		return nil, err
+	}
+	if err := vs.checkDim(query); err != nil {
+		return nil, err
+	}
+	query, err := vs.checkFinite(query)
+	if err != nil {
+		return nil, err
+	}
+	if vs.normalizing() {
+		return Normalize(query), nil
+	}
+	return query, nil
+}
+
+// SearchDetailed is SearchWithOptions with each result joined to its
+// record's metadata and version under the same read lock, so a concurrent
+// delete or update cannot pair a score with another state of the record.
+func (vs *VectorStore) SearchDetailed(query Vector, opts SearchOptions) ([]DetailedResult, error) {
+	return vs.SearchDetailedContext(context.Background(), query, opts)
+}
+
+// SearchDetailedContext is SearchDetailed, abandoned once ctx is done as
+// in SearchContext.
+func (vs *VectorStore) SearchDetailedContext(ctx context.Context, query Vector, opts SearchOptions) ([]DetailedResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	q, err := vs.prepareQuery(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.ctx = ctx
+	results := vs.searchLocked(q, opts)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	vs.touch(results)
+	detailed := vs.detailLocked(results, opts)
+	normalizeScores(detailed, opts.NormalizeScores, vs.Metric.HigherIsBetter())
+	return detailed, nil
+}
+
+// detailLocked attaches metadata to the results of a search with opts via
+// the O(1) IDMap lookup, and vectors if opts asks for them.
+func (vs *VectorStore) detailLocked(results []SearchResult, opts SearchOptions) []DetailedResult {
+	boosted := opts.Boost != nil
+	out := make([]DetailedResult, 0, len(results))
+	for _, res := range results {
+		rec := &vs.Records[vs.IDMap[res.ID]]
+		d := DetailedResult{SearchResult: res, Metadata: rec.Metadata, Tags: rec.Tags, Version: rec.Version}
+		if dist, ok := vs.Metric.distance(res.Score); ok && !boosted && (vs.normalizing() || vs.Metric == MetricL2) {
+			d.Distance = &dist
+		}
+		if opts.IncludeVectors {
+			// A copy: the response is written after the lock is released.
+			d.Vector = slices.Clone(rec.Original())
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// SimilarTo returns the k records nearest to the stored record id, best
+// first, within namespace (all when empty). The record itself is left out,
+// though exact duplicates of it are not. An unknown or expired id fails
+// with ErrNotFound.
+func (vs *VectorStore) SimilarTo(id string, k int, namespace string) ([]SearchResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: got %d", ErrInvalidK, k)
+	}
+	idx, ok := vs.IDMap[id]
+	if !ok || vs.Records[idx].expired(vs.clock()) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	results := vs.similarLocked(idx, k, namespace)
+	vs.touch(results)
+	return results, nil
+}
+
+// SimilarToDetailed is SimilarTo with metadata joined under the same read
+// lock, as in SearchDetailed.
+func (vs *VectorStore) SimilarToDetailed(id string, k int, namespace string) ([]DetailedResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: got %d", ErrInvalidK, k)
+	}
+	idx, ok := vs.IDMap[id]
+	if !ok || vs.Records[idx].expired(vs.clock()) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	results := vs.similarLocked(idx, k, namespace)
+	vs.touch(results)
+	return vs.detailLocked(results, SearchOptions{}), nil
+}
+
+func (vs *VectorStore) similarLocked(idx, k int, namespace string) []SearchResult {
+	id := vs.Records[idx].ID
+	// Stored vectors are already normalized. Ask for one extra result in
+	// case the record ranks among its own neighbors, as it usually does.
+	results := vs.searchLocked(vs.Records[idx].dense(), SearchOptions{K: k + 1, Namespace: namespace})
+	results = slices.DeleteFunc(results, func(r SearchResult) bool { return r.ID == id })
+	return results[:min(len(results), k)]
+}
+
+// searchLocked runs a validated search for the prepared query q with the
+// read lock held.
+func (vs *VectorStore) searchLocked(q Vector, opts SearchOptions) []SearchResult {
+	if ex := opts.Explain; ex != nil {
+		opts.Explain = nil
+		results := vs.searchLocked(q, opts)
+		vs.explainLocked(ex, q, opts, results)
+		return results
+	}
+	if b := opts.Boost; b != nil {
+		k := opts.K
+		opts.Boost, opts.K = nil, k*boostCandidates
+		return vs.applyBoost(vs.searchLocked(q, opts), *b, k)
+	}
+	k := opts.K
+	match := vs.matcher(opts)
+	rerank := vs.RerankFactor
+	if opts.Rerank > 0 {
+		rerank = opts.Rerank
+	}
+
+	// The graph is approximate; if it cannot fill k matches (e.g. under
+	// a selective filter) fall back to the exact scan.
+	if vs.hnsw != nil {
+		if results := vs.hnsw.search(vs, q, k, k*max(rerank, 1), match, opts.After); len(results) >= k {
+			if opts.OnCandidates != nil {
+				opts.OnCandidates(results)
+			}
+			return vs.applyMinScore(results, opts.MinScore)
+		}
+	}
+	subset, match := vs.scanSet(opts, match)
+	return vs.applyMinScore(vs.scan(opts.ctx, q, k, rerank, subset, match, opts.After, opts.OnCandidates), opts.MinScore)
+}
+
+// errPagedBoost rejects a cursor on a boosted search, whose candidates are
+// drawn by vector score alone.
+var errPagedBoost = errors.New("paging cannot be combined with boost")
+
+// validate checks the options that do not depend on the query vector.
+func (opts SearchOptions) validate(m Metric) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if opts.K <= 0 {
+		return fmt.Errorf("%w: got %d", ErrInvalidK, opts.K)
+	}
+	if opts.Rerank < 0 {
+		return fmt.Errorf("rerank factor must be non-negative, got %d", opts.Rerank)
+	}
+	if err := opts.NormalizeScores.validate(); err != nil {
+		return err
+	}
+	if opts.Boost != nil {
+		if opts.After != nil {
+			return errPagedBoost
+		}
+		if err := opts.Boost.validate(m); err != nil {
+			return err
+		}
+	}
+	return opts.Filter.Validate()
+}
+
+// namespaces returns the distinct namespaces opts searches, or nil for
+// all of them.
+func (opts SearchOptions) namespaces() []string {
+	var out []string
+	if opts.Namespace != "" {
+		out = append(out, opts.Namespace)
+	}
+	for _, ns := range opts.Namespaces {
+		if ns != "" && !slices.Contains(out, ns) {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+// matcher returns the namespace and metadata predicate for opts. Records
+// past their expiry never match, whether or not they have been swept.
+func (vs *VectorStore) matcher(opts SearchOptions) func(*Record) bool {
+	now := vs.clock()
+	namespaces := opts.namespaces()
+	inScope := opts.idScope()
+	return func(rec *Record) bool {
+		if namespaces != nil && !slices.Contains(namespaces, rec.Namespace) {
+			return false
+		}
+		if rec.Deleted || rec.expired(now) || !inScope(rec.ID) {
+			return false
+		}
+		return opts.Filter.Matches(rec.Metadata, rec.Tags)
+	}
+}
+
+// idScope returns the predicate for opts.IDPrefix and opts.IDs.
+func (opts SearchOptions) idScope() func(id string) bool {
+	prefix := opts.IDPrefix
+	if opts.IDs == nil {
+		return func(id string) bool { return strings.HasPrefix(id, prefix) }
+	}
+	set := make(map[string]struct{}, len(opts.IDs))
+	for _, id := range opts.IDs {
+		set[id] = struct{}{}
+	}
+	return func(id string) bool {
+		_, ok := set[id]
+		return ok && strings.HasPrefix(id, prefix)
+	}
+}
+
+// idSubset returns the positions of the stored records among ids, each
+// once.
+func (vs *VectorStore) idSubset(ids []string) []int {
+	out := []int{}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if idx, ok := vs.IDMap[id]; ok && !seen[id] {
+			seen[id] = true
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+// subset returns the record indices of namespaces for scan, or nil to
+// visit every record. A namespaced search only visits those namespaces'
+// records.
+func (vs *VectorStore) subset(namespaces []string) []int {
+	switch len(namespaces) {
+	case 0:
+		return nil
+	case 1:
+		if idx := vs.nsIndex[namespaces[0]]; idx != nil {
+			return idx
+		}
+		return []int{}
+	}
+	out := []int{}
+	for _, ns := range namespaces {
+		out = append(out, vs.nsIndex[ns]...)
+	}
+	return out
+}
+
+// scanSet picks the record positions an exact scan visits and the
+// predicate it still applies to them. Under a metadata filter the matches
+// are collected first, so the scoring pass is sized and split by the
+// records that really need scoring: otherwise a filter whose hits cluster
+// in a few blocks would leave most workers idle, and one matching a
+// small fraction would still get a worker per minRecordsPerWorker
+// positions.
+func (vs *VectorStore) scanSet(opts SearchOptions, match func(*Record) bool) ([]int, func(*Record) bool) {
+	subset := vs.subset(opts.namespaces())
+	// An ID set is looked up directly; match re-checks the namespace.
+	if opts.IDs != nil && (subset == nil || len(opts.IDs) < len(subset)) {
+		subset = vs.idSubset(opts.IDs)
+	}
+	if len(opts.Filter.Conditions) == 0 {
+		return subset, match
+	}
+	// An indexed key narrows the pass to its posting lists, which match
+	// re-checks along with the namespace.
+	if candidates, ok := vs.filterCandidates(opts.Filter); ok && (subset == nil || len(candidates) < len(subset)) {
+		subset = candidates
+	}
+	return vs.matching(subset, match), matchAll
+}
+
+// matching returns the positions in subset (all records when nil) whose
+// record satisfies match. The pass runs on the block queue like a scan,
+// so the workers' result order is not preserved.
+func (vs *VectorStore) matching(subset []int, match func(*Record) bool) []int {
+	total := len(vs.Records)
+	if subset != nil {
+		total = len(subset)
+	}
+	parts := runWorkers(vs, total, func(claim func() (int, int, bool)) []int {
+		var hits []int
+		for s, e, ok := claim(); ok; s, e, ok = claim() {
+			for j := s; j < e; j++ {
+				idx := j
+				if subset != nil {
+					idx = subset[j]
+				}
+				if match(&vs.Records[idx]) {
+					hits = append(hits, idx)
+				}
+			}
+		}
+		return hits
+	})
+	out := []int{}
+	for part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func matchAll(*Record) bool { return true }
+
+// SearchBatch is the single key/value form of SearchBatchWithOptions.
+func (vs *VectorStore) SearchBatch(queries []Vector, k int, namespace string, filterKey, filterVal string) ([][]SearchResult, error) {
+	opts := SearchOptions{K: k, Namespace: namespace}
+	if filterKey != "" {
+		opts.Filter.Conditions = []Condition{{Field: filterKey, Value: FilterValue(filterVal)}}
+	}
+	return vs.SearchBatchWithOptions(queries, opts)
+}
+
+// SearchBatchWithOptions runs SearchWithOptions for each query under one
+// read lock, returning results parallel to queries. Each query is
+// normalized once up front, and exact searches share a single pass of the
+// worker pool: every worker scores its chunk of records against all
+// queries, so each stored vector is read once per batch rather than once
+// per query. HNSW and approximate modes fall back to searching the
+// queries one after another.
+func (vs *VectorStore) SearchBatchWithOptions(queries []Vector, opts SearchOptions) ([][]SearchResult, error) {
+	defer observeSearch(time.Now())
+	vs.RLock()
+	defer vs.RUnlock()
+
+	if err := opts.validate(vs.Metric); err != nil {
+		return nil, err
+	}
+	opts.Explain = nil
+	qs := make([]Vector, len(queries))
+	for i, query := range queries {
+		if err := vs.checkDim(query); err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		query, err := vs.checkFinite(query)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		qs[i] = query
+		if vs.normalizing() {
+			qs[i] = Normalize(query)
+		}
+	}
+
+	out := make([][]SearchResult, len(qs))
+	approximate := vs.Metric.approximable() && (vs.Metric != MetricL2 && (vs.UseBinary || vs.UseQuantized) || vs.UsePQ && vs.pq != nil || vs.proj != nil)
+	if vs.hnsw != nil || approximate || opts.OnCandidates != nil || opts.Boost != nil || opts.After != nil {
+		for i, q := range qs {
+			out[i] = vs.searchLocked(q, opts)
+			vs.touch(out[i])
+		}
+		return out, nil
+	}
+	subset, match := vs.scanSet(opts, vs.matcher(opts))
+	for i, results := range vs.scanBatch(qs, opts.K, subset, match) {
+		out[i] = vs.applyMinScore(results, opts.MinScore)
+		vs.touch(out[i])
+	}
+	return out, nil
+}
+
+// scanBatch is the exact scan for several queries at once: like scan it
+// splits the records across workers, but each worker keeps one heap per
+// query and scores every query against a record before moving on.
+func (vs *VectorStore) scanBatch(qs []Vector, k int, subset []int, match func(*Record) bool) [][]SearchResult {
+	higherIsBetter := vs.Metric.HigherIsBetter()
+	total := len(vs.Records)
+	if subset != nil {
+		total = len(subset)
+	}
+	workChan := runWorkers(vs, total, func(claim func() (int, int, bool)) [][]SearchResult {
+		heaps := make([]*ResultHeap, len(qs))
+		for qi := range heaps {
+			heaps[qi] = NewResultHeap(higherIsBetter)
+		}
+		for s, e, ok := claim(); ok; s, e, ok = claim() {
+			for j := s; j < e; j++ {
+				idx := j
+				if subset != nil {
+					idx = subset[j]
+				}
+				rec := &vs.Records[idx]
+				if !match(rec) {
+					continue
+				}
+				for qi, q := range qs {
+					heaps[qi].Offer(SearchResult{ID: rec.ID, Score: vs.scoreRecord(q, rec)}, k)
+				}
+			}
+		}
+
+		partial := make([][]SearchResult, len(qs))
+		for qi, h := range heaps {
+			partial[qi] = h.Drain()
+		}
+		return partial
+	})
+
+	final := make([]*ResultHeap, len(qs))
+	for qi := range final {
+		final[qi] = NewResultHeap(higherIsBetter)
+	}
+	for partial := range workChan {
+		for qi, chunk := range partial {
+			for _, res := range chunk {
+				final[qi].Offer(res, k)
+			}
+		}
+	}
+	out := make([][]SearchResult, len(qs))
+	for qi, h := range final {
+		out[qi] = h.Drain()
+	}
+	return out
+}
+
+// applyMinScore cuts best-first results at the first one past the
+// threshold.
+func (vs *VectorStore) applyMinScore(results []SearchResult, minScore *float32) []SearchResult {
+	if minScore == nil {
+		return results
+	}
+	higherIsBetter := vs.Metric.HigherIsBetter()
+	for i, res := range results {
+		if higherIsBetter && res.Score < *minScore || !higherIsBetter && res.Score > *minScore {
+			return results[:i]
+		}
+	}
+	return results
+}
+
+// scan is the brute-force search path: records are split into blocks that
+// workers claim and score in parallel (see workers.go), and the
+// per-worker heaps are merged into the top k. Approximate modes gather
+// k*rerank candidates and re-score them exactly (see RerankFactor).
+// When subset is non-nil only those record indices are visited, and after
+// is the page cursor (see SearchOptions.After). Once ctx, if not nil, is
+// done the workers stop claiming blocks and the results are incomplete.
+func (vs *VectorStore) scan(ctx context.Context, q Vector, k, rerank int, subset []int, match func(*Record) bool, after *SearchResult, onCandidates func([]SearchResult)) []SearchResult {
+	higherIsBetter := vs.Metric.HigherIsBetter()
+
+	// Custom metrics and MetricAngular are always scored exactly.
+	builtin := vs.Metric.approximable()
+	useBinary := builtin && vs.UseBinary && vs.Metric != MetricL2
+	usePQ := builtin && vs.UsePQ && vs.pq != nil && !useBinary
+	useProjection := builtin && vs.proj != nil && !useBinary && !usePQ
+	useQuantized := builtin && vs.UseQuantized && vs.Metric != MetricL2 && !useBinary && !usePQ && !useProjection
+	var qq quantizedQuery
+	var qb []uint64
+	var qp pqQuery
+	var qr Vector
+	candidates := k
+	switch {
+	case useBinary:
+		qb = QuantizeBinary(q)
+		candidates = k * defaultBinaryRerank
+		if rerank > 0 {
+			candidates = k * rerank
+		}
+	case usePQ:
+		qp = vs.pq.query(q, vs.Metric == MetricL2)
+		candidates = k * defaultPQRerank
+		if rerank > 0 {
+			candidates = k * rerank
+		}
+	case useProjection:
+		qr = vs.proj.apply(q)
+		candidates = k * defaultProjectionRerank
+		if rerank > 0 {
+			candidates = k * rerank
+		}
+	case useQuantized:
+		qq = newQuantizedQuery(q)
+		if rerank > 1 {
+			candidates = k * rerank
+		}
+	}
+
+	total := len(vs.Records)
+	if subset != nil {
+		total = len(subset)
+	}
+	workChan := runWorkers(vs, total, func(claim func() (int, int, bool)) []SearchResult {
+		claim = cancellable(ctx, claim)
+		h := NewResultHeap(higherIsBetter)
+		if candidates == k {
+			// These scores are final, so the cursor applies here.
+			h.After = after
+		}
+		for s, e, ok := claim(); ok; s, e, ok = claim() {
+			for j := s; j < e; j++ {
+				idx := j
+				if subset != nil {
+					idx = subset[j]
+				}
+				rec := &vs.Records[idx]
+				if !match(rec) {
+					continue
+				}
+
+				var score float32
+				switch {
+				case useBinary:
+					score = float32(HammingScore(qb, rec.Binary))
+				case rec.Sparse != nil:
+					score = vs.scoreRecord(q, rec)
+				case usePQ:
+					score = qp.score(rec.PQ)
+				case useProjection:
+					score = vs.score(qr, rec.Projected)
+				case useQuantized:
+					score = qq.dot(rec)
+				default:
+					score = vs.score(q, rec.Vector)
+				}
+				h.Offer(SearchResult{ID: rec.ID, Score: score}, candidates)
+			}
+		}
+		return h.Drain()
+	})
+
+	finalHeap := NewResultHeap(higherIsBetter)
+	for chunk := range workChan {
+		if onCandidates != nil && len(chunk) > 0 {
+			onCandidates(chunk)
+		}
+		for _, res := range chunk {
+			finalHeap.Offer(res, candidates)
+		}
+	}
+	if candidates == k {
+		return finalHeap.Drain()
+	}
+
+	// Re-rank the approximate candidates at full precision.
+	reranked := NewResultHeap(higherIsBetter)
+	reranked.After = after
+	for _, res := range finalHeap.Items {
+		rec := &vs.Records[vs.IDMap[res.ID]]
+		reranked.Offer(SearchResult{ID: res.ID, Score: vs.scoreRecord(q, rec)}, k)
+	}
+	return reranked.Drain()
+}
+
+// List returns up to limit records from namespace (all when empty) after
+// skipping offset matches. Order follows the record slice, which is stable
+// between mutations; a delete moves the last record into the freed slot.
+// A non-positive limit returns everything after offset. Metadata maps are
+// copied so callers may retain the results.
+func (vs *VectorStore) List(namespace string, limit, offset int) []Record {
+	vs.RLock()
+	defer vs.RUnlock()
+
+	out := []Record{}
+	skipped := 0
+	for i := range vs.Records {
+		rec := vs.Records[i]
+		if rec.Deleted || namespace != "" && rec.Namespace != namespace {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		rec.Metadata = maps.Clone(rec.Metadata)
+		rec.Tags = cloneTags(rec.Tags)
+		out = append(out, rec)
+	}
+	return out
+}
+
+// Snapshot returns a deep copy of every record, taken under the read lock,
+// that the caller may iterate or modify while writes continue.
+func (vs *VectorStore) Snapshot() []Record {
+	vs.RLock()
+	defer vs.RUnlock()
+
+	out := make([]Record, 0, len(vs.Records)-vs.tombstones)
+	for _, rec := range vs.Records {
+		if rec.Deleted {
+			continue
+		}
+		rec.Vector = slices.Clone(rec.Vector)
+		rec.Quantized = slices.Clone(rec.Quantized)
+		rec.Binary = slices.Clone(rec.Binary)
+		rec.PQ = slices.Clone(rec.PQ)
+		rec.Projected = slices.Clone(rec.Projected)
+		rec.Sparse = rec.Sparse.clone()
+		rec.Metadata = maps.Clone(rec.Metadata)
+		rec.Tags = cloneTags(rec.Tags)
+		out = append(out, rec)
+	}
+	return out
+}
+
+// ForEach calls fn for each record under the read lock, stopping early when
+// fn returns false. Nothing is copied, so fn must not modify the record's
+// vector or metadata, and must not write to the store, which would
+// deadlock. Writers are blocked until ForEach returns.
+func (vs *VectorStore) ForEach(fn func(Record) bool) {
+	vs.RLock()
+	defer vs.RUnlock()
+
+	for _, rec := range vs.Records {
+		if rec.Deleted {
+			continue
+		}
+		if !fn(rec) {
+			return
+		}
+	}
+}
+
+// ForEachChunk copies up to size records from namespace (all when empty)
+// under the read lock, releases it and hands the copies to fn, repeating
+// until every record has been visited or fn returns an error, which is
+// passed back. Writers only wait for one chunk at a time, so the walk is
+// not a point-in-time view: records added meanwhile may appear, and a
+// delete, which moves the last record into its slot, can cause one not
+// yet visited to be skipped. Vectors are returned as inserted (see
+// Original) and metadata is cloned.
+func (vs *VectorStore) ForEachChunk(namespace string, size int, fn func([]Record) error) error {
+	if size <= 0 {
+		size = 1
+	}
+	for pos := 0; ; {
+		chunk, next := vs.chunkAt(namespace, pos, size)
+		if len(chunk) > 0 {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+		pos = next
+	}
+}
+
+// chunkAt collects up to size matching records starting at slice position
+// pos, returning them and the position to resume from, or -1 at the end.
+func (vs *VectorStore) chunkAt(namespace string, pos, size int) ([]Record, int) {
+	vs.RLock()
+	defer vs.RUnlock()
+
+	out := make([]Record, 0, size)
+	for ; pos < len(vs.Records); pos++ {
+		if len(out) == size {
+			return out, pos
+		}
+		rec := &vs.Records[pos]
+		if rec.Deleted || namespace != "" && rec.Namespace != namespace {
+			continue
+		}
+		out = append(out, rec.asInserted())
+	}
+	return out, -1
+}
+
+// asInserted returns a copy of rec holding only what a client supplies
+// plus its version, with the vector as inserted.
+func (rec *Record) asInserted() Record {
+	var vec Vector
+	var sparse *SparseVector
+	switch {
+	case rec.Sparse != nil:
+		sparse = rec.originalSparse()
+	case rec.Norm == 0:
+		vec = slices.Clone(rec.Vector)
+	default:
+		vec = rec.Original()
+	}
+	return Record{
+		ID:        rec.ID,
+		Vector:    vec,
+		Sparse:    sparse,
+		Metadata:  maps.Clone(rec.Metadata),
+		Tags:      cloneTags(rec.Tags),
+		Namespace: rec.Namespace,
+		Version:   rec.Version,
+		ExpiresAt: rec.ExpiresAt,
+	}
+}
+
+// Get returns a copy of the record id with its vector as inserted, as
+// ForEachChunk yields it; ok is false if id is unknown or has expired.
+func (vs *VectorStore) Get(id string) (rec Record, ok bool) {
+	vs.RLock()
+	defer vs.RUnlock()
+	idx, ok := vs.IDMap[id]
+	if !ok || vs.Records[idx].expired(vs.clock()) {
+		return Record{}, false
+	}
+	return vs.Records[idx].asInserted(), true
+}
+
+// Generation returns the store's mutation counter, which changes with
+// every write, so anything derived from the store at one generation is
+// stale once it moves on.
+func (vs *VectorStore) Generation() uint64 {
+	vs.RLock()
+	defer vs.RUnlock()
+	return vs.changes
+}
+
+// Len returns the number of records, not counting tombstones.
+func (vs *VectorStore) Len() int {
+	vs.RLock()
+	defer vs.RUnlock()
+	return len(vs.Records) - vs.tombstones
+}
+
+// StoreStats summarizes the store's contents.
+type StoreStats struct {
+	Total      int            `json:"total"`
+	Namespaces map[string]int `json:"namespaces"`
+	Dim        int            `json:"dim"`
+	// MemoryBytes approximates the heap held by records: vectors, codes,
+	// IDs and metadata strings, ignoring map and slice header overhead.
+	// Tombstones count until compacted.
+	MemoryBytes int64 `json:"memory_bytes"`
+	Tombstones  int   `json:"tombstones"`
+}
+
+// Stats recomputes the summary on demand with a single pass over the
+// records; nothing is cached, so it is always consistent with the store.
+func (vs *VectorStore) Stats() StoreStats {
+	vs.RLock()
+	defer vs.RUnlock()
+
+	stats := StoreStats{Total: len(vs.Records) - vs.tombstones, Namespaces: make(map[string]int), Dim: vs.Dim, Tombstones: vs.tombstones}
+	for i := range vs.Records {
+		rec := &vs.Records[i]
+		if !rec.Deleted {
+			stats.Namespaces[rec.Namespace]++
+		}
+		size := 4*(len(rec.Vector)+len(rec.Projected)) + len(rec.Quantized) + 8*len(rec.Binary) + len(rec.PQ) + len(rec.ID) + len(rec.Namespace)
+		if rec.Sparse != nil {
+			size += 8 * len(rec.Sparse.Indices)
+		}
+		for k, v := range rec.Metadata {
+			size += len(k) + len(v)
+		}
+		for k, tags := range rec.Tags {
+			size += len(k)
+			for _, tag := range tags {
+				size += len(tag)
+			}
+		}
+		stats.MemoryBytes += int64(size)
+	}
+	return stats
+}
+
+func (vs *VectorStore) Save(filename string) error {
+	vs.RLock()
+	defer vs.RUnlock()
+	return vs.saveLocked(filename)
+}
+
+// saveLocked atomically writes a binary snapshot (see persist.go), or a
+// directory of them under PerNamespaceFiles, and marks the store clean.
+// Callers hold at least the read lock.
+func (vs *VectorStore) saveLocked(filename string) error {
+	vs.saveMu.Lock()
+	defer vs.saveMu.Unlock()
+	var err error
+	if vs.PerNamespaceFiles {
+		err = vs.saveNamespaceDirLocked(filename)
+	} else {
+		err = writeFileAtomic(filename, func(w io.Writer) error {
+			return writeSnapshot(w, vs.liveRecordsLocked(), snapshotMeta{PQ: vs.pq, Projection: vs.proj})
+		})
+	}
+	if err == nil {
+		vs.saved.Store(vs.changes)
+	}
+	return err
+}
+
+// liveRecordsLocked returns the records minus any tombstones, sharing
+// their contents with the store.
+func (vs *VectorStore) liveRecordsLocked() []Record {
+	if vs.tombstones == 0 {
+		return vs.Records
+	}
+	return slices.DeleteFunc(slices.Clone(vs.Records), func(rec Record) bool { return rec.Deleted })
+}
+
+// Dirty reports whether the store has changed since it was last saved or
+// loaded.
+func (vs *VectorStore) Dirty() bool {
+	vs.RLock()
+	defer vs.RUnlock()
+	return vs.changes != vs.saved.Load()
+}
+
+// SaveIfDirty saves to filename only when the store has changed since the
+// last save, and reports whether it wrote.
+func (vs *VectorStore) SaveIfDirty(filename string) (bool, error) {
+	vs.RLock()
+	defer vs.RUnlock()
+	if vs.changes == vs.saved.Load() {
+		return false, nil
+	}
+	return true, vs.saveLocked(filename)
+}
+
+// StartSnapshots runs SaveIfDirty every interval until stop is called.
+// stop waits for a snapshot in progress, so a final save made after it
+// returns cannot race the background one.
+func (vs *VectorStore) StartSnapshots(filename string, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := vs.SaveIfDirty(filename); err != nil {
+					log.Printf("snapshot: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// SaveJSON writes the records as a JSON array, the legacy snapshot format.
+// Load still reads it, which makes it handy for debugging. PQ codebooks
+// and the projection are not included, so a store loaded from it has to
+// be trained and projected again.
+func (vs *VectorStore) SaveJSON(filename string) error {
+	vs.RLock()
+	defer vs.RUnlock()
+	data, err := json.Marshal(vs.liveRecordsLocked())
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Load reads a snapshot in either the binary or the legacy JSON format,
+// or under PerNamespaceFiles a snapshot directory. A missing file or
+// manifest is a fresh start and leaves the store empty. Close saves back
+// to filename.
+func (vs *VectorStore) Load(filename string) error {
+	vs.Lock()
+	defer vs.Unlock()
+	if len(vs.LoadNamespaces) > 0 && !vs.PerNamespaceFiles {
+		return errors.New("LoadNamespaces requires PerNamespaceFiles")
+	}
+	vs.path = filename
+	vs.unloaded = nil
+	var (
+		records []Record
+		meta    snapshotMeta
+		err     error
+	)
+	if vs.PerNamespaceFiles {
+		records, meta, vs.unloaded, err = readNamespaceDir(filename, vs.LoadNamespaces, vs.MmapSnapshots)
+	} else {
+		records, meta, err = readSnapshotFile(filename, vs.MmapSnapshots)
+	}
+	switch {
+	case err == nil:
+		records, dropped := dedupeByID(records)
+		if dropped > 0 {
+			log.Printf("load %s: dropped %d records with duplicate IDs, keeping the last of each", filename, dropped)
+		}
+		dim, mixed := dominantDim(records)
+		if mixed > 0 {
+			if vs.StrictDimensions {
+				return fmt.Errorf("load %s: %w: %d records are not %d-dimensional like the rest", filename, ErrDimensionMismatch, mixed, dim)
+			}
+			records = slices.DeleteFunc(records, func(rec Record) bool { return rec.dim() != dim })
+			log.Printf("load %s: dropped %d records whose dimension is not %d, that of the rest", filename, mixed, dim)
+		}
+		vs.Records, vs.pq, vs.proj = records, meta.PQ, meta.Projection
+	case errors.Is(err, os.ErrNotExist):
+		// No snapshot yet: the store is new, or the log alone holds the
+		// data.
+		vs.Records, vs.pq, vs.proj = []Record{}, nil, nil
+	default:
+		return err
+	}
+
+	vs.tombstones = 0
+	vs.rebuildIndexesLocked()
+	vs.saved.Store(vs.changes)
+	vs.hnsw = nil
+	vs.unitVectors = vs.normalizing()
+	vs.Dim, _ = dominantDim(vs.Records)
+	vs.tick.Store(0)
+	vs.lastAccess = nil
+	for i := range vs.Records {
+		rec := &vs.Records[i]
+		if rec.Seq > vs.tick.Load() {
+			vs.tick.Store(rec.Seq)
+		}
+		rec.Binary = QuantizeBinary(rec.dense())
+		switch {
+		case rec.Sparse != nil:
+			rec.PQ = nil
+		case vs.pq == nil:
+			// Codes without codebooks, e.g. from a JSON snapshot, are
+			// meaningless.
+			rec.PQ = nil
+		case len(rec.PQ) != vs.pq.M:
+			rec.PQ = vs.pq.encode(rec.Vector)
+		}
+		if vs.proj != nil && rec.Sparse == nil {
+			rec.Projected = vs.proj.apply(rec.Vector)
+		}
+		if rec.Version == 0 {
+			// Written before records were versioned.
+			rec.Version = 1
+		}
+	}
+	if vs.wal != nil {
+		if vs.unloaded != nil {
+			empty, err := vs.wal.empty()
+			if err != nil {
+				return err
+			}
+			if !empty {
+				return errPartialWAL
+			}
+		}
+		if err := vs.replayWAL(); err != nil {
+			return err
+		}
+	}
+	// MaxRecords may have been lowered since the snapshot was written.
+	if vs.evictLocked() > 0 {
+		return vs.syncWAL()
+	}
+	return nil
+}
+
+// dedupeByID removes every record whose ID appears again later in
+// records, in place, and reports how many went. A snapshot written by this
+// package never repeats an ID, but a hand-edited one might, and IDMap can
+// only point at one of the copies while the scan would score both.
+func dedupeByID(records []Record) ([]Record, int) {
+	last := make(map[string]int, len(records))
+	for i := range records {
+		last[records[i].ID] = i
+	}
+	if len(last) == len(records) {
+		return records, 0
+	}
+	kept := records[:0]
+	for i := range records {
+		if last[records[i].ID] == i {
+			kept = append(kept, records[i])
+		}
+	}
+	clear(records[len(kept):])
+	return kept, len(records) - len(kept)
+}
+
+// dominantDim returns the dimension most of records have, the earliest
+// one on a tie, and how many records have another. It is 0 for no
+// records. Records of another dimension would otherwise be scored against
+// queries of the wrong length, as happens when a snapshot written with
+// one embedding model is loaded and extended under another.
+func dominantDim(records []Record) (dim, others int) {
+	counts := make(map[int]int)
+	for i := range records {
+		d := records[i].dim()
+		counts[d]++
+		if counts[d] > counts[dim] {
+			dim = d
+		}
+	}
+	return dim, len(records) - counts[dim]
+}
+
+// Close makes the store durable and read-only: it saves a snapshot to the
+// file given to Load, folding in and closing the write-ahead log, after
+// which writes fail with ErrClosed (or report nothing changed, for the
+// methods without an error result). Searches keep working. If the save
+// fails the store stays open so Close can be retried; closing again is a
+// no-op.
+func (vs *VectorStore) Close() error {
+	vs.Lock()
+	defer vs.Unlock()
+	if vs.closed {
+		return nil
+	}
+	if vs.path != "" {
+		if err := vs.saveLocked(vs.path); err != nil {
+			return err
+		}
+	}
+	if vs.wal != nil {
+		// A fresh snapshot holds everything logged so far.
+		if vs.path != "" {
+			if err := vs.wal.truncate(); err != nil {
+				return err
+			}
+		}
+		if err := vs.wal.close(); err != nil {
+			return err
+		}
+		vs.wal = nil
 	}
+	vs.closed = true
 	return nil
 }
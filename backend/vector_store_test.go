@@ -0,0 +1,1481 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func resultIDs(results []SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func mustSearch(t *testing.T, store *VectorStore, query Vector, k int) []SearchResult {
+	t.Helper()
+	results, err := store.Search(query, k, "", "", "")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	return results
+}
+
+func assertIDs(t *testing.T, got []SearchResult, want ...string) {
+	t.Helper()
+	ids := resultIDs(got)
+	if len(ids) != len(want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("got %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestSearchMetricsOrderDiffers(t *testing.T) {
+	query := Vector{1, 0}
+	cases := []struct {
+		metric Metric
+		want   []string
+	}{
+		{MetricCosine, []string{"same-dir", "close", "big"}},
+		{MetricDot, []string{"big", "same-dir", "close"}},
+		{MetricL2, []string{"close", "same-dir", "big"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.metric), func(t *testing.T) {
+			store := NewVectorStore()
+			store.Metric = tc.metric
+			store.AddItem("big", Vector{10, 10}, nil, "")
+			store.AddItem("close", Vector{1, 0.5}, nil, "")
+			store.AddItem("same-dir", Vector{3, 0}, nil, "")
+
+			assertIDs(t, mustSearch(t, store, query, 3), tc.want...)
+		})
+	}
+}
+
+func TestAngularDistance(t *testing.T) {
+	store := NewVectorStore()
+	store.Metric = MetricAngular
+	want := map[string]float32{"same": 0, "45deg": 0.25, "60deg": 1.0 / 3, "right": 0.5, "opposite": 1}
+	store.AddItem("same", Vector{5, 0}, nil, "")
+	store.AddItem("45deg", Vector{3, 3}, nil, "")
+	store.AddItem("60deg", Vector{0.5, float32(math.Sqrt(3)) / 2}, nil, "")
+	store.AddItem("right", Vector{0, 2}, nil, "")
+	store.AddItem("opposite", Vector{-2, 0}, nil, "")
+
+	check := func(name string) {
+		t.Helper()
+		got, err := store.SearchDetailed(Vector{1, 0}, SearchOptions{K: 5})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ranked := make([]SearchResult, len(got))
+		for i, res := range got {
+			ranked[i] = res.SearchResult
+		}
+		assertIDs(t, ranked, "same", "45deg", "60deg", "right", "opposite")
+		for _, res := range got {
+			if math.Abs(float64(res.Score-want[res.ID])) > 1e-6 {
+				t.Errorf("%s: %s scored %v, want %v", name, res.ID, res.Score, want[res.ID])
+			}
+			if res.Distance == nil || *res.Distance != res.Score {
+				t.Errorf("%s: %s distance %v, want the score", name, res.ID, res.Distance)
+			}
+		}
+	}
+	check("scan")
+	store.BuildHNSW(4, 16)
+	check("hnsw")
+
+	// Float error can take the cosine of parallel vectors past 1.
+	for _, cos := range []float32{1.0000001, -1.0000001} {
+		if d := AngularDistance(cos); math.IsNaN(float64(d)) || d < 0 || d > 1 {
+			t.Errorf("AngularDistance(%v) = %v", cos, d)
+		}
+	}
+}
+
+func TestAddItemNormalizesOnlyForCosine(t *testing.T) {
+	for _, metric := range []Metric{MetricDot, MetricL2} {
+		store := NewVectorStore()
+		store.Metric = metric
+		store.AddItem("a", Vector{3, 4}, nil, "")
+		if got := store.Records[0].Vector; got[0] != 3 || got[1] != 4 {
+			t.Fatalf("%s: stored vector %v was modified", metric, got)
+		}
+	}
+
+	store := NewVectorStore()
+	store.AddItem("a", Vector{3, 4}, nil, "")
+	if got := store.Records[0].Vector; got[0] != 0.6 || got[1] != 0.8 {
+		t.Fatalf("cosine: stored vector %v not normalized", got)
+	}
+}
+
+// TestNormalizeOff turns off normalization under cosine: vectors keep
+// their magnitudes, which then count towards the scores, and Reindex
+// moves between the two.
+func TestNormalizeOff(t *testing.T) {
+	store := NewVectorStore()
+	store.Normalize = false
+	store.AddItem("long", Vector{3, 4}, nil, "")
+	store.AddItem("unit", Vector{0.6, 0.8}, nil, "")
+	if got := store.Records[0].Vector; got[0] != 3 || got[1] != 4 {
+		t.Fatalf("stored vector %v was normalized", got)
+	}
+
+	got, err := store.SearchDetailed(Vector{3, 4}, SearchOptions{K: 2})
+	if err != nil {
+		t.Fatalf("SearchDetailed: %v", err)
+	}
+	if got[0].ID != "long" || got[1].ID != "unit" || got[0].Score != 25 || math.Abs(float64(got[1].Score)-5) > 1e-5 {
+		t.Fatalf("raw dot-product results = %+v, want long 25, unit 5", got)
+	}
+	if got[0].Distance != nil {
+		t.Fatalf("distance %v reported for raw scores", *got[0].Distance)
+	}
+
+	// Turned back on, the two point the same way and tie.
+	store.Normalize = true
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	for _, res := range mustSearch(t, store, Vector{3, 4}, 2) {
+		if math.Abs(float64(res.Score)-1) > 1e-6 {
+			t.Fatalf("normalized score for %s = %v, want 1", res.ID, res.Score)
+		}
+	}
+}
+
+func TestDeleteItemKeepsIDMapConsistent(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0, 0}, map[string]string{"name": "a"}, "")
+	store.AddItem("b", Vector{0, 1, 0}, map[string]string{"name": "b"}, "")
+	store.AddItem("c", Vector{0, 0, 1}, map[string]string{"name": "c"}, "")
+
+	if !store.DeleteItem("b") {
+		t.Fatal("DeleteItem(b) = false, want true")
+	}
+	if store.DeleteItem("b") {
+		t.Fatal("second DeleteItem(b) = true, want false")
+	}
+	if len(store.Records) != 2 || len(store.IDMap) != 2 {
+		t.Fatalf("got %d records / %d map entries, want 2", len(store.Records), len(store.IDMap))
+	}
+	for id, idx := range store.IDMap {
+		if store.Records[idx].ID != id || store.Records[idx].Metadata["name"] != id {
+			t.Fatalf("IDMap[%s] = %d points at %+v", id, idx, store.Records[idx])
+		}
+	}
+
+	assertIDs(t, mustSearch(t, store, Vector{0, 0, 1}, 1), "c")
+	assertIDs(t, mustSearch(t, store, Vector{1, 0, 0}, 1), "a")
+	if got := mustSearch(t, store, Vector{0, 1, 0}, 3); len(got) != 2 {
+		t.Fatalf("search after delete returned %v", resultIDs(got))
+	}
+}
+
+func TestDimensionGuard(t *testing.T) {
+	store := NewVectorStore()
+	if err := store.AddItem("a", Vector{1, 0, 0}, nil, ""); err != nil {
+		t.Fatalf("first insert: %v", err)
+	}
+	if store.Dim != 3 {
+		t.Fatalf("Dim = %d, want 3", store.Dim)
+	}
+
+	if err := store.AddItem("b", Vector{1, 0}, nil, ""); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("mismatched insert err = %v, want ErrDimensionMismatch", err)
+	}
+	if len(store.Records) != 1 {
+		t.Fatalf("mismatched insert was stored: %d records", len(store.Records))
+	}
+
+	if _, err := store.Search(Vector{1, 0, 0, 0}, 1, "", "", ""); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("mismatched query err = %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestBatchAddItem(t *testing.T) {
+	store := NewVectorStore()
+	records := make([]Record, 0, 101)
+	for i := 0; i < 100; i++ {
+		records = append(records, Record{ID: fmt.Sprintf("id-%d", i), Vector: Vector{float32(i), 1}})
+	}
+	records = append(records, Record{ID: "id-7", Vector: Vector{1, 0}, Metadata: map[string]string{"v": "2"}})
+	records = append(records, Record{ID: "bad", Vector: Vector{1, 0, 0}})
+
+	errs := store.BatchAddItem(records)
+	for i, err := range errs[:101] {
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+	}
+	if !errors.Is(errs[101], ErrDimensionMismatch) {
+		t.Fatalf("bad record err = %v, want ErrDimensionMismatch", errs[101])
+	}
+	if len(store.Records) != 100 {
+		t.Fatalf("got %d records, want 100", len(store.Records))
+	}
+	if got := store.Records[store.IDMap["id-7"]]; got.Metadata["v"] != "2" {
+		t.Fatalf("duplicate ID did not update: %+v", got)
+	}
+}
+
+func TestQuantizeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	v := make(Vector, 768)
+	for i := range v {
+		v[i] = rng.Float32()*4 - 2
+	}
+	v = Normalize(v)
+
+	q, scale, offset := Quantize(v)
+	got := Dequantize(q, scale, offset)
+
+	// Rounding to the nearest level bounds the error by half a step.
+	eps := scale/2 + 1e-6
+	for i := range v {
+		if d := float32(math.Abs(float64(got[i] - v[i]))); d > eps {
+			t.Fatalf("component %d: |%f - %f| = %g exceeds %g", i, got[i], v[i], d, eps)
+		}
+	}
+
+	flat, scale, offset := Quantize(Vector{0.5, 0.5})
+	if got := Dequantize(flat, scale, offset); got[0] != 0.5 || got[1] != 0.5 {
+		t.Fatalf("constant vector round-tripped to %v", got)
+	}
+}
+
+// Un-normalized components must saturate, never wrap around the int8
+// range.
+func TestQuantizeClamps(t *testing.T) {
+	q, scale := QuantizeRange(Vector{2.0, -3.0, 0.5, -0.5}, 1)
+	if want := []int8{127, -128, 64, -64}; !slices.Equal(q, want) {
+		t.Fatalf("QuantizeRange = %v, want %v", q, want)
+	}
+	if scale != 1./127 {
+		t.Fatalf("scale = %v", scale)
+	}
+
+	// Over its own range a raw vector spans the codes exactly.
+	q, _, _ = Quantize(Vector{2.0, -3.0, 0})
+	if q[0] != 127 || q[1] != -128 {
+		t.Fatalf("Quantize = %v, want the extremes at 127 and -128", q)
+	}
+}
+
+func randomVectors(rng *rand.Rand, n, dim int) []Vector {
+	vecs := make([]Vector, n)
+	for i := range vecs {
+		vecs[i] = make(Vector, dim)
+		for j := range vecs[i] {
+			vecs[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vecs
+}
+
+// overlap returns the fraction of want's IDs that also appear in got.
+func overlap(got, want []SearchResult) float64 {
+	seen := make(map[string]bool, len(got))
+	for _, r := range got {
+		seen[r.ID] = true
+	}
+	hits := 0
+	for _, r := range want {
+		if seen[r.ID] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(want))
+}
+
+func TestQuantizedSearchOverlap(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 2000, 128) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+
+	const k = 10
+	var approx, reranked float64
+	queries := randomVectors(rng, 20, 128)
+	for _, q := range queries {
+		store.UseQuantized, store.RerankFactor = false, 0
+		exact := mustSearch(t, store, q, k)
+
+		store.UseQuantized = true
+		approx += overlap(mustSearch(t, store, q, k), exact)
+		store.RerankFactor = 4
+		reranked += overlap(mustSearch(t, store, q, k), exact)
+	}
+	approx /= float64(len(queries))
+	reranked /= float64(len(queries))
+
+	if approx < 0.9 {
+		t.Fatalf("quantized top-%d overlap = %.2f, want >= 0.9", k, approx)
+	}
+	if reranked < approx {
+		t.Fatalf("rerank overlap %.2f below approximate-only %.2f", reranked, approx)
+	}
+}
+
+func TestStatsPerNamespace(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0}, map[string]string{"k": "v"}, "docs")
+	store.AddItem("b", Vector{0, 1}, nil, "docs")
+	store.AddItem("c", Vector{1, 1}, nil, "notes")
+
+	stats := store.Stats()
+	if stats.Total != 3 || stats.Dim != 2 {
+		t.Fatalf("got total=%d dim=%d, want 3 and 2", stats.Total, stats.Dim)
+	}
+	if stats.Namespaces["docs"] != 2 || stats.Namespaces["notes"] != 1 || len(stats.Namespaces) != 2 {
+		t.Fatalf("namespaces = %v", stats.Namespaces)
+	}
+	if stats.MemoryBytes <= 0 {
+		t.Fatalf("MemoryBytes = %d", stats.MemoryBytes)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	store := NewVectorStore()
+	for i := 0; i < 5; i++ {
+		store.AddItem(fmt.Sprintf("a-%d", i), Vector{1, float32(i)}, nil, "a")
+		store.AddItem(fmt.Sprintf("b-%d", i), Vector{1, float32(i)}, nil, "b")
+	}
+
+	var seen []string
+	for offset := 0; ; offset += 2 {
+		page := store.List("a", 2, offset)
+		if len(page) == 0 {
+			break
+		}
+		for _, rec := range page {
+			if rec.Namespace != "a" {
+				t.Fatalf("List(a) returned %s from %q", rec.ID, rec.Namespace)
+			}
+			seen = append(seen, rec.ID)
+		}
+	}
+	if len(seen) != 5 || seen[0] != "a-0" || seen[4] != "a-4" {
+		t.Fatalf("paged through %v", seen)
+	}
+
+	if got := store.List("", 0, 0); len(got) != 10 {
+		t.Fatalf("List all returned %d records", len(got))
+	}
+	if got := store.List("b", 3, 100); got == nil || len(got) != 0 {
+		t.Fatalf("offset past end returned %v", got)
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0}, map[string]string{"text": "hello", "status": "new"}, "")
+	before := store.Records[0].Vector
+
+	if !store.UpdateMetadata("a", map[string]string{"status": "archived", "tag": "x"}, true) {
+		t.Fatal("merge update reported unknown ID")
+	}
+	got := store.Records[store.IDMap["a"]].Metadata
+	if got["text"] != "hello" || got["status"] != "archived" || got["tag"] != "x" {
+		t.Fatalf("after merge: %v", got)
+	}
+
+	store.UpdateMetadata("a", map[string]string{"only": "this"}, false)
+	got = store.Records[store.IDMap["a"]].Metadata
+	if len(got) != 1 || got["only"] != "this" {
+		t.Fatalf("after replace: %v", got)
+	}
+	if &store.Records[0].Vector[0] != &before[0] {
+		t.Fatal("vector was rewritten")
+	}
+
+	if store.UpdateMetadata("missing", map[string]string{"k": "v"}, true) {
+		t.Fatal("update of missing ID reported success")
+	}
+}
+
+func TestSearchEdgeCases(t *testing.T) {
+	empty := NewVectorStore()
+	if got := mustSearch(t, empty, Vector{1, 0}, 5); got == nil || len(got) != 0 {
+		t.Fatalf("empty store returned %#v", got)
+	}
+
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0}, map[string]string{"lang": "en"}, "")
+	got, err := store.Search(Vector{1, 0}, 5, "", "lang", "fr")
+	if err != nil || got == nil || len(got) != 0 {
+		t.Fatalf("all-filtered search returned %#v, %v", got, err)
+	}
+
+	for _, k := range []int{0, -3} {
+		if _, err := store.Search(Vector{1, 0}, k, "", "", ""); !errors.Is(err, ErrInvalidK) {
+			t.Fatalf("k=%d: err = %v, want ErrInvalidK", k, err)
+		}
+	}
+}
+
+func TestL2RanksClustersByDistance(t *testing.T) {
+	points := map[string]Vector{
+		"near-1": {1, 1.2}, "near-2": {1.25, 1}, "near-3": {0.9, 1.1},
+		"far-1": {10, 10.1}, "far-2": {10.1, 10}, "far-3": {9.9, 10},
+	}
+	query := Vector{1, 1}
+
+	build := func(metric Metric) *VectorStore {
+		store := NewVectorStore()
+		store.Metric = metric
+		for id, v := range points {
+			store.AddItem(id, v, nil, "")
+		}
+		return store
+	}
+
+	l2 := build(MetricL2)
+	got := mustSearch(t, l2, query, 4)
+	assertIDs(t, got, "near-3", "near-1", "near-2", "far-3")
+	if d := got[0].Score; math.Abs(float64(d)-math.Sqrt(0.02)) > 1e-6 {
+		t.Fatalf("nearest distance = %f, want %f", d, math.Sqrt(0.02))
+	}
+
+	// The same data ranked by angle favors the far cluster, which lies
+	// closer to the query's direction.
+	for _, r := range mustSearch(t, build(MetricCosine), query, 3) {
+		if r.ID[:3] != "far" {
+			t.Fatalf("cosine top-3 contains %s", r.ID)
+		}
+	}
+
+	l2.BuildHNSW(4, 16)
+	assertIDs(t, mustSearch(t, l2, query, 4), "near-3", "near-1", "near-2", "far-3")
+}
+
+func TestSearchMinScore(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("same", Vector{1, 0}, nil, "")
+	store.AddItem("close", Vector{1, 0.3}, nil, "")
+	store.AddItem("orthogonal", Vector{0, 1}, nil, "")
+	store.AddItem("opposite", Vector{-1, 0}, nil, "")
+
+	threshold := float32(0.7)
+	got, err := store.SearchWithOptions(Vector{1, 0}, SearchOptions{K: 4, MinScore: &threshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIDs(t, got, "same", "close")
+
+	store.BuildHNSW(4, 16)
+	got, _ = store.SearchWithOptions(Vector{1, 0}, SearchOptions{K: 4, MinScore: &threshold})
+	assertIDs(t, got, "same", "close")
+
+	l2 := NewVectorStore()
+	l2.Metric = MetricL2
+	l2.AddItem("a", Vector{0, 0}, nil, "")
+	l2.AddItem("b", Vector{1, 0}, nil, "")
+	l2.AddItem("c", Vector{5, 0}, nil, "")
+	maxDist := float32(2)
+	got, _ = l2.SearchWithOptions(Vector{0, 0}, SearchOptions{K: 3, MinScore: &maxDist})
+	assertIDs(t, got, "a", "b")
+}
+
+func TestSnapshotIsIndependent(t *testing.T) {
+	store := NewVectorStore()
+	store.Metric = MetricDot
+	store.AddItem("a", Vector{1, 2}, map[string]string{"v": "1"}, "")
+	store.AddItem("b", Vector{3, 4}, nil, "")
+
+	snap := store.Snapshot()
+	store.DeleteItem("a")
+	store.AddItem("b", Vector{9, 9}, nil, "")
+	store.AddItem("c", Vector{5, 6}, nil, "")
+	store.UpdateMetadata("b", map[string]string{"v": "2"}, false)
+
+	if len(snap) != 2 || snap[0].ID != "a" || snap[1].ID != "b" {
+		t.Fatalf("snapshot changed: %+v", snap)
+	}
+	if snap[0].Metadata["v"] != "1" || snap[1].Vector[0] != 3 {
+		t.Fatalf("snapshot contents changed: %+v", snap)
+	}
+
+	// Mutating the snapshot must not reach the store either.
+	snap[1].Vector[0] = 100
+	if got := mustSearch(t, store, Vector{1, 0}, 1); got[0].Score == 100 {
+		t.Fatal("snapshot shares vector memory with the store")
+	}
+}
+
+func TestForEachStopsEarly(t *testing.T) {
+	store := NewVectorStore()
+	for i := range 5 {
+		store.AddItem(fmt.Sprint(i), Vector{1, float32(i)}, nil, "")
+	}
+	var seen []string
+	store.ForEach(func(rec Record) bool {
+		seen = append(seen, rec.ID)
+		return len(seen) < 3
+	})
+	if len(seen) != 3 {
+		t.Fatalf("visited %v, want 3 records", seen)
+	}
+}
+
+func TestDeleteByFilter(t *testing.T) {
+	store := NewVectorStore()
+	for i := range 30 {
+		ns := []string{"temp", "keep", ""}[i%3]
+		status := "fresh"
+		if i%2 == 0 {
+			status = "stale"
+		}
+		store.AddItem(fmt.Sprint(i), Vector{1, float32(i)}, map[string]string{"status": status}, ns)
+	}
+	store.BuildHNSW(4, 16)
+
+	n, err := store.DeleteByFilter("temp", Filter{})
+	if err != nil || n != 10 {
+		t.Fatalf("deleted %d, %v; want the 10 temp records", n, err)
+	}
+	checkIndexes(t, store)
+	if got := store.Stats().Namespaces["temp"]; got != 0 {
+		t.Fatalf("%d temp records remain", got)
+	}
+
+	stale := Filter{Conditions: []Condition{{Field: "status", Value: "stale"}}}
+	n, _ = store.DeleteByFilter("", stale)
+	if n != 10 || len(store.Records) != 10 {
+		t.Fatalf("deleted %d stale records, %d remain; want 10 and 10", n, len(store.Records))
+	}
+	checkIndexes(t, store)
+	for _, r := range mustSearch(t, store, Vector{1, 1}, 10) {
+		idx := store.IDMap[r.ID]
+		if store.Records[idx].Metadata["status"] != "fresh" || store.Records[idx].Namespace == "temp" {
+			t.Fatalf("deleted record %s still searchable", r.ID)
+		}
+	}
+
+	bad := Filter{Conditions: []Condition{{Field: "status", Op: "regex"}}}
+	if _, err := store.DeleteByFilter("", bad); err == nil {
+		t.Fatal("invalid filter accepted")
+	}
+}
+
+func TestFloat64RoundTrip(t *testing.T) {
+	src := []float64{0.123456789012345, -1e-9, 3.141592653589793, 12345.678901234, -0.5}
+	store := NewVectorStore()
+	store.Metric = MetricDot
+	if err := store.AddItem("np", Float64ToVector(src), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	back := store.Snapshot()[0].Vector
+	for i, want := range src {
+		got := float64(back[i])
+		// float32 rounding is exact to half an ulp: 2^-24 relative.
+		if rel := math.Abs(got-want) / math.Abs(want); rel > 0x1p-24 {
+			t.Fatalf("element %d: %v came back as %v (relative error %g)", i, want, got, rel)
+		}
+	}
+	if v := Float64ToVector([]float64{1e39}); !math.IsInf(float64(v[0]), 1) {
+		t.Fatalf("out-of-range value became %v, want +Inf", v[0])
+	}
+}
+
+func TestReindexRequantizes(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	store := NewVectorStore()
+	for i, v := range randomVectors(rng, 50, 16) {
+		store.AddItem(fmt.Sprint(i), v, nil, "")
+	}
+	before := store.Snapshot()
+
+	store.QuantRange = 0.5
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	for i, rec := range store.Records {
+		wantQ, wantScale := QuantizeRange(rec.Vector, 0.5)
+		if rec.QScale != wantScale || rec.QOffset != 0 || !slices.Equal(rec.Quantized, wantQ) {
+			t.Fatalf("record %s not re-quantized: scale %v offset %v", rec.ID, rec.QScale, rec.QOffset)
+		}
+		if slices.Equal(rec.Quantized, before[i].Quantized) {
+			t.Fatalf("record %s kept its old codes", rec.ID)
+		}
+		if !slices.Equal(rec.Vector, before[i].Vector) {
+			t.Fatalf("record %s vector changed", rec.ID)
+		}
+	}
+}
+
+func TestReindexAfterMetricChange(t *testing.T) {
+	store := NewVectorStore()
+	store.Metric = MetricDot
+	store.AddItem("long", Vector{10, 0}, nil, "")
+	store.AddItem("angled", Vector{1, 1}, nil, "")
+	store.BuildHNSW(4, 16)
+	assertIDs(t, mustSearch(t, store, Vector{1, 0}, 2), "long", "angled")
+
+	store.Metric = MetricCosine
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+	got := mustSearch(t, store, Vector{1, 0}, 2)
+	assertIDs(t, got, "long", "angled")
+	if math.Abs(float64(got[0].Score)-1) > 1e-6 || math.Abs(float64(got[1].Score)-math.Sqrt2/2) > 1e-6 {
+		t.Fatalf("scores after reindex are not cosines: %+v", got)
+	}
+
+	// Going back restores the magnitudes from each record's Norm.
+	store.Metric = MetricDot
+	if err := store.Reindex(); err != nil {
+		t.Fatalf("cosine -> dot: %v", err)
+	}
+	got = mustSearch(t, store, Vector{1, 0}, 2)
+	if math.Abs(float64(got[0].Score)-10) > 1e-5 || math.Abs(float64(got[1].Score)-1) > 1e-5 {
+		t.Fatalf("dot scores after round trip: %+v", got)
+	}
+
+	// Records normalized without a Norm, as in old snapshots, cannot be.
+	store.Metric = MetricCosine
+	store.Reindex()
+	for i := range store.Records {
+		store.Records[i].Norm = 0
+	}
+	store.Metric = MetricDot
+	if err := store.Reindex(); !errors.Is(err, ErrNormalizedVectors) {
+		t.Fatalf("legacy cosine -> dot: err = %v, want ErrNormalizedVectors", err)
+	}
+}
+
+func TestOriginalVectorSurvivesNormalization(t *testing.T) {
+	orig := Vector{3, -4, 12}
+	store := NewVectorStore()
+	store.AddItem("a", slices.Clone(orig), nil, "")
+	if Magnitude(store.Records[0].Vector) > 1+1e-6 {
+		t.Fatal("cosine store did not normalize")
+	}
+
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*VectorStore{store, loaded} {
+		got := s.List("", 0, 0)[0].Original()
+		for i := range orig {
+			if math.Abs(float64(got[i]-orig[i])) > 1e-5 {
+				t.Fatalf("original came back as %v, want %v", got, orig)
+			}
+		}
+	}
+}
+
+func TestForEachChunk(t *testing.T) {
+	store := NewVectorStore()
+	for i := 0; i < 10; i++ {
+		ns := "even"
+		if i%2 == 1 {
+			ns = "odd"
+		}
+		store.AddItem(fmt.Sprint(i), Vector{1, float32(i)}, nil, ns)
+	}
+
+	var sizes []int
+	seen := 0
+	store.ForEachChunk("odd", 2, func(chunk []Record) error {
+		sizes = append(sizes, len(chunk))
+		for _, rec := range chunk {
+			if rec.Namespace != "odd" {
+				t.Fatalf("got %s from namespace %q", rec.ID, rec.Namespace)
+			}
+		}
+		seen += len(chunk)
+		// The lock is released between chunks, so writes go through.
+		return store.AddItem(fmt.Sprintf("new-%d", seen), Vector{0, 1}, nil, "even")
+	})
+	if seen != 5 || len(sizes) != 3 {
+		t.Fatalf("saw %d records in chunks %v, want 5 in 3", seen, sizes)
+	}
+}
+
+func TestSearchBatchMatchesSearch(t *testing.T) {
+	for _, m := range []Metric{MetricCosine, MetricL2} {
+		t.Run(string(m), func(t *testing.T) {
+			store := NewVectorStore()
+			store.Metric = m
+			for i := 0; i < 300; i++ {
+				store.AddItem(fmt.Sprint(i), Vector{float32(i % 13), float32(i % 7), 1}, map[string]string{"odd": fmt.Sprint(i%2 == 1)}, "")
+			}
+			queries := []Vector{{1, 0, 0}, {0, 1, 1}, {3, 2, 1}}
+
+			got, err := store.SearchBatch(queries, 5, "", "odd", "true")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(queries) {
+				t.Fatalf("got %d result sets, want %d", len(got), len(queries))
+			}
+			for i, q := range queries {
+				want, _ := store.Search(q, 5, "", "odd", "true")
+				if len(got[i]) != len(want) {
+					t.Fatalf("query %d: got %d results, want %d", i, len(got[i]), len(want))
+				}
+				for j := range want {
+					if got[i][j].Score != want[j].Score {
+						t.Fatalf("query %d result %d: got %+v, want %+v", i, j, got[i][j], want[j])
+					}
+				}
+			}
+
+			if _, err := store.SearchBatch([]Vector{{1, 0, 0}, {1, 0}}, 5, "", "", ""); !errors.Is(err, ErrDimensionMismatch) {
+				t.Fatalf("mismatched query: err = %v", err)
+			}
+		})
+	}
+}
+
+func TestAddRecordIfVersion(t *testing.T) {
+	store := NewVectorStore()
+	if err := store.AddRecordIfVersion(Record{ID: "a", Vector: Vector{1, 0}}, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if v := store.Version("a"); v != 1 {
+		t.Fatalf("version after create = %d, want 1", v)
+	}
+	if err := store.AddRecordIfVersion(Record{ID: "a", Vector: Vector{0, 1}}, 1); err != nil {
+		t.Fatalf("conditional update: %v", err)
+	}
+	if err := store.AddRecordIfVersion(Record{ID: "a", Vector: Vector{1, 1}}, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale update: err = %v, want ErrVersionConflict", err)
+	}
+	if res, _ := store.Search(Vector{0, 1}, 1, "", "", ""); res[0].Score < 0.99 {
+		t.Fatalf("stale update was applied: %+v", res)
+	}
+
+	store.UpdateMetadata("a", map[string]string{"k": "v"}, true)
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	if v := store.Version("a"); v != 4 {
+		t.Fatalf("version = %d, want 4", v)
+	}
+}
+
+func TestRecordExpiry(t *testing.T) {
+	store := NewVectorStore()
+	now := time.Unix(1_000_000, 0)
+	store.now = func() time.Time { return now }
+
+	store.AddItem("keep", Vector{1, 0}, nil, "")
+	store.AddRecord(Record{ID: "brief", Vector: Vector{1, 0.1}, ExpiresAt: now.Add(time.Minute)})
+
+	ids := func() []string {
+		res, _ := store.Search(Vector{1, 0}, 5, "", "", "")
+		return resultIDs(res)
+	}
+	if got := ids(); len(got) != 2 {
+		t.Fatalf("before expiry: %v", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := ids(); len(got) != 1 || got[0] != "keep" {
+		t.Fatalf("after expiry, before sweep: %v", got)
+	}
+	if batch, _ := store.SearchBatch([]Vector{{1, 0}}, 5, "", "", ""); len(batch[0]) != 1 {
+		t.Fatalf("batch search returned expired record: %v", batch)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("expired record removed before the sweep")
+	}
+
+	stop := store.StartExpirySweeper(time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for store.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not remove the expired record")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := ids(); len(got) != 1 || got[0] != "keep" {
+		t.Fatalf("after sweep: %v", got)
+	}
+}
+
+func TestNonFiniteVectors(t *testing.T) {
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	store := NewVectorStore()
+	store.Metric = MetricDot
+	store.AddItem("low", Vector{1, 0}, nil, "")
+	store.AddItem("high", Vector{3, 0}, nil, "")
+	store.AddItem("mid", Vector{2, 0}, nil, "")
+
+	for _, bad := range []Vector{{nan, 1}, {1, inf}, {float32(math.Inf(-1)), 0}} {
+		if err := store.AddItem("bad", bad, nil, ""); !errors.Is(err, ErrNonFinite) {
+			t.Fatalf("AddItem(%v): err = %v, want ErrNonFinite", bad, err)
+		}
+		if _, err := store.Search(bad, 3, "", "", ""); !errors.Is(err, ErrNonFinite) {
+			t.Fatalf("Search(%v): err = %v, want ErrNonFinite", bad, err)
+		}
+		if _, err := store.SearchBatch([]Vector{{1, 0}, bad}, 3, "", "", ""); !errors.Is(err, ErrNonFinite) {
+			t.Fatalf("SearchBatch(%v): err = %v, want ErrNonFinite", bad, err)
+		}
+	}
+	res, _ := store.Search(Vector{1, 0}, 3, "", "", "")
+	if got := resultIDs(res); !slices.Equal(got, []string{"high", "mid", "low"}) {
+		t.Fatalf("order after rejected inserts = %v", got)
+	}
+
+	store.SanitizeNonFinite = true
+	if err := store.AddItem("cleaned", Vector{nan, 5}, nil, ""); err != nil {
+		t.Fatalf("sanitized insert: %v", err)
+	}
+	res, err := store.Search(Vector{1, inf}, 4, "", "", "")
+	if err != nil {
+		t.Fatalf("sanitized search: %v", err)
+	}
+	if got := resultIDs(res); !slices.Equal(got, []string{"high", "mid", "low", "cleaned"}) {
+		t.Fatalf("sanitized order = %v", got)
+	}
+}
+
+func TestReplaceVectorConflict(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	store.AddItem("a", Vector{0, 1}, nil, "")
+	if err := store.ReplaceVector("a", Vector{1, 1}, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("replacing from a stale version = %v, want ErrVersionConflict", err)
+	}
+	if err := store.ReplaceVector("missing", Vector{1, 1}, 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("replacing a missing record = %v, want ErrNotFound", err)
+	}
+	// Like UpdateVector, it leaves an expired record alone.
+	store.AddRecord(Record{ID: "b", Vector: Vector{1, 0}, ExpiresAt: time.Now().Add(-time.Second)})
+	if err := store.ReplaceVector("b", Vector{1, 1}, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("replacing an expired record = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTiesBreakByID(t *testing.T) {
+	store := NewVectorStore()
+	ids := []string{"m", "c", "x", "a", "q", "f", "b", "z"}
+	for i := 0; i < 2000; i++ {
+		a := float64(i)
+		store.AddItem(fmt.Sprintf("far-%04d", i), Vector{-0.5, float32(math.Cos(a)), float32(math.Sin(a))}, nil, "")
+	}
+	for _, id := range ids {
+		store.AddItem(id, Vector{1, 0, 0}, nil, "")
+	}
+	prev := minRecordsPerWorker
+	minRecordsPerWorker = 100
+	t.Cleanup(func() { minRecordsPerWorker = prev })
+	store.MaxWorkers = 4
+
+	want := []string{"a", "b", "c", "f", "m"}
+	for i := 0; i < 20; i++ {
+		res, _ := store.Search(Vector{1, 0, 0}, 5, "", "", "")
+		if got := resultIDs(res); !slices.Equal(got, want) {
+			t.Fatalf("run %d: got %v, want %v", i, got, want)
+		}
+	}
+
+	// The graph may not reach every duplicate, but what it finds must
+	// come back in ID order.
+	store.BuildHNSW(8, 64)
+	res, _ := store.Search(Vector{1, 0, 0}, 5, "", "", "")
+	if got := resultIDs(res); !slices.IsSorted(got) {
+		t.Fatalf("hnsw: tied results %v not in ID order", got)
+	}
+}
+
+func TestRerankOption(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	store := NewVectorStore()
+	// A range far wider than the data leaves only a few int8 levels in
+	// use, so the approximate ranking is visibly coarse.
+	store.UseQuantized, store.QuantRange = true, 20
+	for i, v := range randomVectors(rng, 2000, 64) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+
+	const k = 10
+	var approx, reranked float64
+	queries := randomVectors(rng, 20, 64)
+	for _, q := range queries {
+		store.UseQuantized = false
+		exact := mustSearch(t, store, q, k)
+		store.UseQuantized = true
+
+		res, _ := store.SearchWithOptions(q, SearchOptions{K: k, Rerank: 1})
+		approx += overlap(res, exact)
+		res, _ = store.SearchWithOptions(q, SearchOptions{K: k, Rerank: 10})
+		reranked += overlap(res, exact)
+	}
+	approx /= float64(len(queries))
+	reranked /= float64(len(queries))
+	if reranked <= approx || reranked < 0.95 {
+		t.Fatalf("top-%d overlap: rerank %.2f, approximate-only %.2f", k, reranked, approx)
+	}
+
+	if _, err := store.SearchWithOptions(queries[0], SearchOptions{K: k, Rerank: -1}); err == nil {
+		t.Fatal("negative rerank accepted")
+	}
+}
+
+func TestSearchMultipleNamespaces(t *testing.T) {
+	store := NewVectorStore()
+	for i, ns := range []string{"user:123", "shared", "user:456"} {
+		for j := 0; j < 3; j++ {
+			store.AddItem(fmt.Sprintf("%s/%d", ns, j), Vector{1, float32(i*3 + j)}, nil, ns)
+		}
+	}
+
+	opts := SearchOptions{K: 10, Namespaces: []string{"user:123", "shared"}}
+	for _, batch := range []bool{false, true} {
+		var res []SearchResult
+		if batch {
+			out, _ := store.SearchBatchWithOptions([]Vector{{1, 8}}, opts)
+			res = out[0]
+		} else {
+			res, _ = store.SearchWithOptions(Vector{1, 8}, opts)
+		}
+		if len(res) != 6 {
+			t.Fatalf("batch=%v: got %v, want the 6 records of two namespaces", batch, resultIDs(res))
+		}
+		for _, r := range res {
+			if strings.HasPrefix(r.ID, "user:456") {
+				t.Fatalf("batch=%v: %s from an unrequested namespace", batch, r.ID)
+			}
+		}
+	}
+
+	// The single-string form still works and combines with the list.
+	res, _ := store.SearchWithOptions(Vector{1, 8}, SearchOptions{K: 10, Namespace: "user:456", Namespaces: []string{"shared"}})
+	if len(res) != 6 || res[0].ID != "user:456/2" {
+		t.Fatalf("combined namespaces: %v", resultIDs(res))
+	}
+}
+
+func TestSimilarTo(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("self", Vector{1, 0}, nil, "a")
+	store.AddItem("near", Vector{1, 0.1}, nil, "a")
+	store.AddItem("mid", Vector{1, 1}, nil, "a")
+	store.AddItem("far", Vector{0, 1}, nil, "a")
+	store.AddItem("other-ns", Vector{1, 0.05}, nil, "b")
+
+	got, err := store.SimilarTo("self", 3, "a")
+	if err != nil {
+		t.Fatalf("SimilarTo: %v", err)
+	}
+	assertIDs(t, got, "near", "mid", "far")
+
+	// Without a namespace every record is a candidate, still minus self.
+	got, _ = store.SimilarTo("self", 2, "")
+	assertIDs(t, got, "other-ns", "near")
+
+	if _, err := store.SimilarTo("missing", 3, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown id: err = %v, want ErrNotFound", err)
+	}
+	if _, err := store.SimilarTo("self", 0, ""); !errors.Is(err, ErrInvalidK) {
+		t.Fatalf("k=0: err = %v, want ErrInvalidK", err)
+	}
+}
+
+func TestSoftDeleteSkipsTombstones(t *testing.T) {
+	store := NewVectorStore()
+	store.SoftDelete = true
+	store.AddItem("a", Vector{1, 0}, nil, "ns")
+	store.AddItem("b", Vector{1, 0.1}, nil, "ns")
+	store.AddItem("c", Vector{0, 1}, nil, "ns")
+
+	if !store.DeleteItem("a") || store.DeleteItem("a") {
+		t.Fatal("DeleteItem should succeed once")
+	}
+	if len(store.Records) != 3 || store.Len() != 2 {
+		t.Fatalf("soft delete: %d slots, Len %d; want 3 and 2", len(store.Records), store.Len())
+	}
+	got, _ := store.Search(Vector{1, 0}, 3, "ns", "", "")
+	assertIDs(t, got, "b", "c")
+	if recs := store.List("", 0, 0); len(recs) != 2 {
+		t.Fatalf("List returned %d records, want 2", len(recs))
+	}
+	if store.Stats().Namespaces["ns"] != 2 || store.Stats().Tombstones != 1 {
+		t.Fatalf("stats = %+v", store.Stats())
+	}
+
+	// The ID is free again at once, with a fresh version.
+	store.AddItem("a", Vector{1, 0}, nil, "ns")
+	if v := store.Version("a"); v != 1 {
+		t.Fatalf("re-added version = %d, want 1", v)
+	}
+	got, _ = store.Search(Vector{1, 0}, 3, "ns", "", "")
+	assertIDs(t, got, "a", "b", "c")
+}
+
+func TestCompactReclaimsTombstones(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	store := NewVectorStore()
+	store.SoftDelete = true
+	for i, v := range randomVectors(rng, 100, 8) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, fmt.Sprintf("ns-%d", i%2))
+	}
+	before := store.Stats().MemoryBytes
+	for i := 0; i < 100; i += 3 {
+		store.DeleteItem(fmt.Sprintf("id-%d", i))
+	}
+
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if n := store.Compact(); n != 34 {
+		t.Fatalf("Compact reclaimed %d, want 34", n)
+	}
+	if len(store.Records) != 66 || store.Stats().MemoryBytes >= before || store.Stats().Tombstones != 0 {
+		t.Fatalf("after compaction: %d slots, stats %+v", len(store.Records), store.Stats())
+	}
+	for i, rec := range store.Records {
+		if rec.Deleted || store.IDMap[rec.ID] != i {
+			t.Fatalf("slot %d (%s) is stale after compaction", i, rec.ID)
+		}
+	}
+	q := randomVectors(rng, 1, 8)[0]
+	got, _ := store.Search(q, 5, "ns-1", "", "")
+	for _, r := range got {
+		if store.Records[store.IDMap[r.ID]].Namespace != "ns-1" {
+			t.Fatalf("namespace index stale: %s", r.ID)
+		}
+	}
+
+	// The snapshot taken before compaction already left the tombstones out.
+	loaded := NewVectorStore()
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Records, store.Records) {
+		t.Fatal("snapshot differs from the compacted store")
+	}
+
+	store.CompactThreshold = 3
+	store.DeleteItem("id-1")
+	store.DeleteItem("id-2")
+	if len(store.Records) != 66 {
+		t.Fatal("compacted below the threshold")
+	}
+	store.DeleteItem("id-4")
+	if len(store.Records) != 63 || store.Len() != 63 {
+		t.Fatalf("threshold compaction left %d slots", len(store.Records))
+	}
+}
+
+// TestOptimize churns a store through several add/delete cycles and
+// checks Optimize leaves it tombstone-free, grouped by namespace and with
+// every index, the HNSW graph included, matching the records.
+func TestOptimize(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	store := NewVectorStore()
+	store.SoftDelete = true
+	store.AddIndexedKey("kind")
+	store.BuildHNSW(8, 32)
+	live := map[string]bool{}
+	for cycle := range 4 {
+		for i, v := range randomVectors(rng, 50, 8) {
+			id := fmt.Sprintf("c%d-%d", cycle, i)
+			meta := map[string]string{"kind": fmt.Sprint(i % 3)}
+			if err := store.AddItem(id, v, meta, fmt.Sprintf("ns-%d", i%3)); err != nil {
+				t.Fatalf("AddItem: %v", err)
+			}
+			live[id] = true
+		}
+		for id := range live {
+			if rng.Intn(2) == 0 {
+				store.DeleteItem(id)
+				delete(live, id)
+			}
+		}
+	}
+	tombstones := store.Stats().Tombstones
+	if tombstones == 0 {
+		t.Fatal("churn left no tombstones to reclaim")
+	}
+
+	report, err := store.Optimize(true)
+	if err != nil {
+		t.Fatalf("Optimize: %v", err)
+	}
+	want := OptimizeReport{Before: len(live) + tombstones, After: len(live), Reclaimed: tombstones, Sorted: true}
+	if report != want {
+		t.Fatalf("report = %+v, want %+v", report, want)
+	}
+	if store.Stats().Tombstones != 0 || len(store.Records) != len(live) {
+		t.Fatalf("after Optimize: %d slots, stats %+v", len(store.Records), store.Stats())
+	}
+	if !slices.IsSortedFunc(store.Records, func(a, b Record) int { return cmp.Compare(a.Namespace, b.Namespace) }) {
+		t.Fatal("records not grouped by namespace")
+	}
+	checkIndexes(t, store)
+	checkMetaIndex(t, store)
+	if got, wantIDs := storedIDs(store), slices.Sorted(maps.Keys(live)); !slices.Equal(got, wantIDs) {
+		t.Fatalf("stored %v, want %v", got, wantIDs)
+	}
+	if n := len(store.hnsw.nodes); n != len(live) {
+		t.Fatalf("HNSW graph has %d nodes for %d records", n, len(live))
+	}
+	q := randomVectors(rng, 1, 8)[0]
+	got, err := store.SearchWithOptions(q, SearchOptions{K: 5, Namespace: "ns-1"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	for _, r := range got {
+		if !live[r.ID] || store.Records[store.IDMap[r.ID]].Namespace != "ns-1" {
+			t.Fatalf("search returned %s after Optimize", r.ID)
+		}
+	}
+
+	store.Close()
+	if _, err := store.Optimize(false); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Optimize after Close = %v, want ErrClosed", err)
+	}
+}
+
+// TestOptimizeDirty checks an Optimize that compacts or reorders leaves
+// the store to be saved, and one with nothing to do does not.
+func TestOptimizeDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.db")
+	store := NewVectorStore()
+	store.SoftDelete = true
+	store.AddItem("a", Vector{1, 0}, nil, "ns-b")
+	store.AddItem("b", Vector{0, 1}, nil, "ns-a")
+	store.AddItem("c", Vector{1, 1}, nil, "ns-b")
+	store.DeleteItem("c")
+
+	for _, step := range []struct {
+		name        string
+		byNamespace bool
+		dirty       bool
+	}{
+		{"compact", false, true},
+		{"sort", true, true},
+		{"already tidy", true, false},
+	} {
+		if _, err := store.SaveIfDirty(path); err != nil {
+			t.Fatalf("SaveIfDirty: %v", err)
+		}
+		if _, err := store.Optimize(step.byNamespace); err != nil {
+			t.Fatalf("%s: Optimize: %v", step.name, err)
+		}
+		if store.Dirty() != step.dirty {
+			t.Errorf("%s: Dirty() = %t, want %t", step.name, store.Dirty(), step.dirty)
+		}
+	}
+}
+
+// TestSearchPaging pages through every record and checks the pages join
+// up into the single-search ranking, ties included, with or without the
+// HNSW graph.
+func TestSearchPaging(t *testing.T) {
+	for _, metric := range []Metric{MetricCosine, MetricL2} {
+		t.Run(string(metric), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(10))
+			store := NewVectorStore()
+			store.Metric = metric
+			vecs := randomVectors(rng, 60, 8)
+			for i, v := range vecs {
+				store.AddItem(fmt.Sprintf("id-%02d", i), v, nil, "")
+			}
+			// Exact duplicates tie on score, so only the ID orders them.
+			for i := range 5 {
+				store.AddItem(fmt.Sprintf("dup-%d", i), vecs[3], nil, "")
+			}
+			q := vecs[3]
+			want := mustSearch(t, store, q, 65)
+
+			for _, graph := range []bool{false, true} {
+				if graph {
+					store.BuildHNSW(8, 50)
+				}
+				var got []SearchResult
+				opts := SearchOptions{K: 7}
+				for {
+					page, err := store.SearchWithOptions(q, opts)
+					if err != nil {
+						t.Fatalf("SearchWithOptions: %v", err)
+					}
+					got = append(got, page...)
+					if len(page) < opts.K {
+						break
+					}
+					opts.After = &page[len(page)-1]
+				}
+				if !slices.Equal(resultIDs(got), resultIDs(want)) {
+					t.Fatalf("hnsw=%t: paged %v, want %v", graph, resultIDs(got), resultIDs(want))
+				}
+			}
+		})
+	}
+
+	store := NewVectorStore()
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	_, err := store.SearchWithOptions(Vector{1, 0}, SearchOptions{K: 1, After: &SearchResult{ID: "a"}, Boost: &Boost{Field: "x"}})
+	if !errors.Is(err, errPagedBoost) {
+		t.Fatalf("paged boost: err = %v, want errPagedBoost", err)
+	}
+}
+
+// TestConcurrentWritesAndSearches hammers a store with adds, overwrites,
+// deletes and detailed searches at once; run it with -race. Every result
+// must carry the metadata of the record it scored.
+func TestConcurrentWritesAndSearches(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(*VectorStore)
+	}{
+		{"flat", func(*VectorStore) {}},
+		{"hnsw", func(vs *VectorStore) { vs.BuildHNSW(4, 16) }},
+		{"soft delete", func(vs *VectorStore) { vs.SoftDelete, vs.CompactThreshold = true, 20 }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const dim, ids = 8, 50
+			store := NewVectorStore()
+			store.AddIndexedKey("id")
+			rng := rand.New(rand.NewSource(8))
+			for i, v := range randomVectors(rng, ids, dim) {
+				id := fmt.Sprintf("id-%d", i)
+				store.AddItem(id, v, map[string]string{"id": id}, "")
+			}
+			tc.setup(store)
+
+			var wg sync.WaitGroup
+			for w := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(w)))
+					for range 300 {
+						id := fmt.Sprintf("id-%d", rng.Intn(ids))
+						if rng.Intn(3) == 0 {
+							store.DeleteItem(id)
+							continue
+						}
+						v := randomVectors(rng, 1, dim)[0]
+						if err := store.AddItem(id, v, map[string]string{"id": id}, ""); err != nil {
+							t.Errorf("AddItem(%s): %v", id, err)
+							return
+						}
+					}
+				}()
+			}
+			for r := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(100 + r)))
+					for range 300 {
+						q := randomVectors(rng, 1, dim)[0]
+						opts := SearchOptions{K: 5}
+						if r%2 == 1 {
+							id := fmt.Sprintf("id-%d", rng.Intn(ids))
+							opts.Filter.Conditions = []Condition{{Field: "id", Value: FilterValue(id)}}
+						}
+						results, err := store.SearchDetailed(q, opts)
+						if err != nil {
+							t.Errorf("SearchDetailed: %v", err)
+							return
+						}
+						similar, err := store.SimilarToDetailed(fmt.Sprintf("id-%d", rng.Intn(ids)), 5, "")
+						if err != nil && !errors.Is(err, ErrNotFound) {
+							t.Errorf("SimilarToDetailed: %v", err)
+							return
+						}
+						for _, res := range append(results, similar...) {
+							if res.Metadata["id"] != res.ID {
+								t.Errorf("result %s carries metadata %v", res.ID, res.Metadata)
+								return
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			store.Compact()
+			checkIndexes(t, store)
+			checkMetaIndex(t, store)
+		})
+	}
+}
+
+// TestSearchDetailedMatchesManualJoin checks SearchDetailed against
+// SearchWithOptions followed by the IDMap lookup the handlers used to do.
+func TestSearchDetailedMatchesManualJoin(t *testing.T) {
+	for _, metric := range []Metric{MetricCosine, MetricDot} {
+		t.Run(string(metric), func(t *testing.T) {
+			store := NewVectorStore()
+			store.Metric = metric
+			rng := rand.New(rand.NewSource(9))
+			for i, v := range randomVectors(rng, 100, 8) {
+				store.AddItem(fmt.Sprintf("id-%d", i), v, map[string]string{"popularity": fmt.Sprint(i)}, "")
+			}
+			store.UpdateMetadata("id-3", map[string]string{"note": "edited"}, true)
+			q := randomVectors(rng, 1, 8)[0]
+
+			for _, opts := range []SearchOptions{
+				{K: 10},
+				{K: 10, Boost: &Boost{Field: "popularity", Weight: 0.2}},
+			} {
+				results, err := store.SearchWithOptions(q, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := make([]DetailedResult, 0, len(results))
+				for _, res := range results {
+					rec := store.Records[store.IDMap[res.ID]]
+					d := DetailedResult{SearchResult: res, Metadata: rec.Metadata, Tags: rec.Tags, Version: rec.Version}
+					if dist, ok := store.Metric.distance(res.Score); ok && opts.Boost == nil {
+						d.Distance = &dist
+					}
+					want = append(want, d)
+				}
+
+				got, err := store.SearchDetailed(q, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("boost=%v: SearchDetailed = %+v, want %+v", opts.Boost != nil, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	store := NewVectorStore()
+	store.AddItem("a", Vector{3, 4}, map[string]string{"k": "v"}, "ns")
+	store.AddRecord(Record{ID: "gone", Vector: Vector{1, 0}, ExpiresAt: time.Now().Add(-time.Minute)})
+
+	rec, ok := store.Get("a")
+	if !ok || rec.Namespace != "ns" || rec.Metadata["k"] != "v" || rec.Version != 1 || !approxEqual(rec.Vector, Vector{3, 4}) {
+		t.Fatalf("Get(a) = %+v, %t", rec, ok)
+	}
+	// The copy is the caller's.
+	rec.Metadata["k"] = "changed"
+	rec.Vector[0] = 0
+	if again, _ := store.Get("a"); again.Metadata["k"] != "v" || again.Vector[0] == 0 {
+		t.Fatalf("Get shares memory with the store: %+v", again)
+	}
+	for _, id := range []string{"missing", "gone"} {
+		if _, ok := store.Get(id); ok {
+			t.Errorf("Get(%s) found a record", id)
+		}
+	}
+}
+
+func TestSearchContextCancel(t *testing.T) {
+	const n = 100000
+	var scored atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Scores like the dot product and cancels the search partway in.
+	err := RegisterMetric("test-cancelling", func(a, b Vector) float32 {
+		if scored.Add(1) == 1000 {
+			cancel()
+		}
+		return DotProduct(a, b)
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewVectorStore()
+	store.Metric = "test-cancelling"
+	store.MaxWorkers = 4
+	rng := rand.New(rand.NewSource(8))
+	for i, v := range randomVectors(rng, n, 8) {
+		store.AddItem(fmt.Sprintf("id-%d", i), v, nil, "")
+	}
+	q := randomVectors(rng, 1, 8)[0]
+
+	if _, err := store.SearchContext(ctx, q, SearchOptions{K: 10}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SearchContext = %v, want context.Canceled", err)
+	}
+	// Each worker finishes at most the block it was on.
+	if got := scored.Load(); got > 1000+4*scanBlockSize {
+		t.Errorf("scored %d of %d records after cancelling", got, n)
+	}
+
+	scored.Store(0)
+	if _, err := store.SearchDetailedContext(ctx, q, SearchOptions{K: 10}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SearchDetailedContext on a cancelled context = %v", err)
+	}
+	if got := scored.Load(); got != 0 {
+		t.Errorf("scored %d records for a search cancelled up front", got)
+	}
+
+	got, err := store.SearchContext(context.Background(), q, SearchOptions{K: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mustSearch(t, store, q, 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchContext = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateVector(t *testing.T) {
+	store := NewVectorStore()
+	store.AddIndexedKey("k")
+	store.AddRecord(Record{ID: "a", Vector: Vector{3, 4}, Metadata: map[string]string{"k": "v"}, Tags: map[string][]string{"t": {"x"}}, Namespace: "ns"})
+	store.AddItem("b", Vector{0, 1}, nil, "ns")
+	if got := resultIDs(mustSearch(t, store, Vector{1, 0}, 2)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("before: %v", got)
+	}
+
+	if !store.UpdateVector("a", Vector{-2, 0}) {
+		t.Fatal("UpdateVector failed")
+	}
+	rec, _ := store.Get("a")
+	if !reflect.DeepEqual(rec.Vector, Vector{-2, 0}) || rec.Metadata["k"] != "v" || rec.Tags["t"][0] != "x" || rec.Namespace != "ns" || rec.Version != 2 {
+		t.Errorf("after update: %+v", rec)
+	}
+	// Every mode scores the new vector.
+	for _, quantized := range []bool{false, true} {
+		store.UseQuantized = quantized
+		if got := resultIDs(mustSearch(t, store, Vector{1, 0}, 2)); !reflect.DeepEqual(got, []string{"b", "a"}) {
+			t.Errorf("quantized=%t: after: %v", quantized, got)
+		}
+	}
+	checkIndexes(t, store)
+	checkMetaIndex(t, store)
+
+	if store.UpdateVector("missing", Vector{1, 0}) {
+		t.Error("unknown ID updated")
+	}
+	if err := store.setVector("missing", Vector{1, 0}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("setVector(missing) = %v, want ErrNotFound", err)
+	}
+	if err := store.setVector("a", Vector{1, 0, 0}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("setVector with the wrong dimension = %v, want ErrDimensionMismatch", err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// walOp is one line of the write-ahead log.
+type walOp struct {
+	Op       string            `json:"op"` // "add", "delete" or "metadata"
+	Record   *Record           `json:"record,omitempty"`
+	ID       string            `json:"id,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Merge    bool              `json:"merge,omitempty"`
+}
+
+// writeAheadLog appends JSON-encoded operations to a file. It is only
+// touched while the store's write lock is held.
+type writeAheadLog struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func openWAL(path string) (*writeAheadLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &writeAheadLog{path: path, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (l *writeAheadLog) append(op walOp) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = l.w.Write(data)
+	return err
+}
+
+// sync flushes buffered operations and fsyncs them to disk.
+func (l *writeAheadLog) sync() error {
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// truncate discards every logged operation, once they are in a snapshot.
+func (l *writeAheadLog) truncate() error {
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// close flushes buffered operations and closes the file.
+func (l *writeAheadLog) close() error {
+	if err := l.sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// EnableWAL makes every subsequent AddItem, BatchAddItem, DeleteItem and
+// UpdateMetadata durable by appending it to the log at path before it is
+// applied. Call it before Load so that Load replays operations logged
+// since the last snapshot.
+func (vs *VectorStore) EnableWAL(path string) error {
+	vs.Lock()
+	defer vs.Unlock()
+
+	l, err := openWAL(path)
+	if err != nil {
+		return err
+	}
+	vs.wal = l
+	return nil
+}
+
+// logOp appends op to the WAL, if enabled. Callers hold the write lock.
+func (vs *VectorStore) logOp(op walOp) error {
+	if vs.wal == nil {
+		return nil
+	}
+	if err := vs.wal.append(op); err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// syncWAL makes logged operations durable. Callers hold the write lock.
+func (vs *VectorStore) syncWAL() error {
+	if vs.wal == nil {
+		return nil
+	}
+	if err := vs.wal.sync(); err != nil {
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// replayWAL re-applies the logged operations on top of the loaded
+// snapshot. Replayed operations are not logged again. A torn final line,
+// as left by a crash mid-append, ends the replay. Callers hold the write
+// lock.
+func (vs *VectorStore) replayWAL() error {
+	f, err := os.Open(vs.wal.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := vs.wal
+	vs.wal = nil
+	defer func() { vs.wal = w }()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	replayed := 0
+	for sc.Scan() {
+		var op walOp
+		if err := json.Unmarshal(sc.Bytes(), &op); err != nil {
+			log.Printf("wal: stopping replay at corrupt entry %d: %v", replayed+1, err)
+			break
+		}
+		switch op.Op {
+		case "add":
+			if op.Record != nil {
+				vs.addLocked(*op.Record)
+			}
+		case "delete":
+			vs.deleteLocked(op.ID)
+		case "metadata":
+			vs.updateMetadataLocked(op.ID, op.Metadata, op.Merge)
+		}
+		replayed++
+	}
+	if replayed > 0 {
+		log.Printf("wal: replayed %d operations from %s", replayed, w.path)
+	}
+	return sc.Err()
+}
+
+// CompactWAL folds the log into a fresh snapshot at snapshotPath and
+// truncates it. Writes are blocked while the snapshot is written.
+func (vs *VectorStore) CompactWAL(snapshotPath string) error {
+	vs.Lock()
+	defer vs.Unlock()
+
+	if vs.wal == nil {
+		return errors.New("write-ahead log not enabled")
+	}
+	if err := vs.saveLocked(snapshotPath); err != nil {
+		return err
+	}
+	return vs.wal.truncate()
+}
+
+// StartWALCompaction runs CompactWAL every interval until stop is called.
+// stop waits for a compaction in progress, so the store can be closed as
+// soon as it returns.
+func (vs *VectorStore) StartWALCompaction(snapshotPath string, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := vs.CompactWAL(snapshotPath); err != nil {
+					log.Printf("wal: compaction failed: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWALRecoversOpsAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	snap, walPath := filepath.Join(dir, "vectors.json"), filepath.Join(dir, "vectors.wal")
+
+	store := NewVectorStore()
+	if err := store.EnableWAL(walPath); err != nil {
+		t.Fatalf("EnableWAL: %v", err)
+	}
+	store.AddItem("a", Vector{1, 0}, nil, "")
+	store.AddItem("b", Vector{0, 1}, map[string]string{"v": "1"}, "")
+	if err := store.CompactWAL(snap); err != nil {
+		t.Fatalf("CompactWAL: %v", err)
+	}
+	store.AddItem("c", Vector{1, 1}, nil, "ns")
+	store.DeleteItem("a")
+	store.BatchAddItem([]Record{{ID: "b", Vector: Vector{0, 2}, Metadata: map[string]string{"v": "2"}}})
+	// Crash: no Save, no Close.
+
+	recovered := NewVectorStore()
+	if err := recovered.EnableWAL(walPath); err != nil {
+		t.Fatalf("EnableWAL: %v", err)
+	}
+	if err := recovered.Load(snap); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if len(recovered.Records) != 2 {
+		t.Fatalf("recovered %d records, want 2", len(recovered.Records))
+	}
+	if _, ok := recovered.IDMap["a"]; ok {
+		t.Fatal("deleted record a came back")
+	}
+	if got := recovered.Records[recovered.IDMap["b"]]; got.Metadata["v"] != "2" {
+		t.Fatalf("b = %+v, want the batch update", got)
+	}
+	if got := recovered.Records[recovered.IDMap["c"]]; got.Namespace != "ns" {
+		t.Fatalf("c = %+v", got)
+	}
+
+	// Replay must not append the replayed ops to the log again.
+	again := NewVectorStore()
+	again.EnableWAL(walPath)
+	again.Load(snap)
+	if len(again.Records) != 2 {
+		t.Fatalf("second recovery has %d records", len(again.Records))
+	}
+}
+
+func TestWALWithoutSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "vectors.wal")
+
+	store := NewVectorStore()
+	store.EnableWAL(walPath)
+	store.AddItem("a", Vector{1, 0}, nil, "")
+
+	recovered := NewVectorStore()
+	recovered.EnableWAL(walPath)
+	if err := recovered.Load(filepath.Join(dir, "missing.json")); err != nil {
+		t.Fatalf("Load without snapshot: %v", err)
+	}
+	if len(recovered.Records) != 1 {
+		t.Fatalf("recovered %d records, want 1", len(recovered.Records))
+	}
+}
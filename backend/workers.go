@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Brute-force scans split the visited records into fixed-size blocks that
+// workers claim from a shared counter, so a worker that lands on cheap
+// blocks (e.g. ones a filter mostly rejects) simply claims more, instead
+// of idling while another grinds through an equal static share.
+
+// scanBlockSize is how many record positions a worker claims at once: big
+// enough that the counter is not contended, small enough to even out
+// uneven blocks.
+const scanBlockSize = 512
+
+// minRecordsPerWorker keeps small scans from paying goroutine and merge
+// overhead for a handful of records each; a scan only gets another worker
+// per this many records. Benchmarks lower it to compare.
+var minRecordsPerWorker = 4096
+
+// blockQueue hands out consecutive [start, end) blocks of [0, total).
+type blockQueue struct {
+	next  atomic.Int64
+	total int
+}
+
+// claim returns the next unclaimed block, or ok false once all are taken.
+func (q *blockQueue) claim() (start, end int, ok bool) {
+	end = int(q.next.Add(scanBlockSize))
+	start = end - scanBlockSize
+	if start >= q.total {
+		return 0, 0, false
+	}
+	return start, min(end, q.total), true
+}
+
+// workerCount is how many goroutines a scan of total records uses: one
+// per minRecordsPerWorker, capped by MaxWorkers or the CPU count.
+func (vs *VectorStore) workerCount(total int) int {
+	limit := vs.MaxWorkers
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	return max(1, min(limit, total/minRecordsPerWorker))
+}
+
+// runWorkers splits [0, total) into blocks for work, which is called once
+// per worker with the shared claim function and returns that worker's
+// result. Each result is sent on the returned channel, which is closed
+// once all workers are done. A single worker runs on the calling
+// goroutine before runWorkers returns.
+func runWorkers[T any](vs *VectorStore, total int, work func(claim func() (int, int, bool)) T) <-chan T {
+	q := &blockQueue{total: total}
+	n := vs.workerCount(total)
+	out := make(chan T, n)
+	if n == 1 {
+		out <- work(q.claim)
+		close(out)
+		return out
+	}
+
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out <- work(q.claim)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// cancellable wraps claim to hand out no more blocks once ctx is done, so
+// a cancelled scan stops within a block per worker. A nil ctx never is.
+func cancellable(ctx context.Context, claim func() (int, int, bool)) func() (int, int, bool) {
+	if ctx == nil {
+		return claim
+	}
+	return func() (int, int, bool) {
+		if ctx.Err() != nil {
+			return 0, 0, false
+		}
+		return claim()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBlockQueueCoversEachPositionOnce(t *testing.T) {
+	total := 10*scanBlockSize + 7
+	q := &blockQueue{total: total}
+	seen := make([]int, total)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s, e, ok := q.claim(); ok; s, e, ok = q.claim() {
+				for i := s; i < e; i++ {
+					seen[i]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("position %d claimed %d times", i, n)
+		}
+	}
+}
+
+func TestWorkerCount(t *testing.T) {
+	vs := NewVectorStore()
+	vs.MaxWorkers = 4
+	for _, tc := range []struct{ total, want int }{
+		{0, 1},
+		{50, 1},
+		{minRecordsPerWorker * 2, 2},
+		{minRecordsPerWorker * 100, 4},
+	} {
+		if got := vs.workerCount(tc.total); got != tc.want {
+			t.Errorf("workerCount(%d) = %d, want %d", tc.total, got, tc.want)
+		}
+	}
+}
+
+func TestParallelScanMatchesSingleWorker(t *testing.T) {
+	store := NewVectorStore()
+	for i := 0; i < 3000; i++ {
+		store.AddItem(fmt.Sprint(i), Vector{float32(i % 97), float32(i % 31), 1}, nil, "")
+	}
+	query := Vector{3, 1, 2}
+	want, _ := store.Search(query, 10, "", "", "")
+
+	prev := minRecordsPerWorker
+	minRecordsPerWorker = 100
+	t.Cleanup(func() { minRecordsPerWorker = prev })
+	store.MaxWorkers = 6
+	got, _ := store.Search(query, 10, "", "", "")
+	for i := range want {
+		if got[i].Score != want[i].Score {
+			t.Fatalf("result %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMatchingCollectsFilteredPositions(t *testing.T) {
+	store := NewVectorStore()
+	store.Metric = MetricDot
+	for i := 0; i < 5000; i++ {
+		store.AddItem(fmt.Sprint(i), Vector{1, float32(i)}, map[string]string{"hot": fmt.Sprint(i < 600)}, "")
+	}
+	prev := minRecordsPerWorker
+	minRecordsPerWorker = 500
+	t.Cleanup(func() { minRecordsPerWorker = prev })
+	store.MaxWorkers = 4
+
+	opts := SearchOptions{K: 5, Filter: Filter{Conditions: []Condition{{Field: "hot", Value: "true"}}}}
+	store.RLock()
+	hits := store.matching(nil, store.matcher(opts))
+	store.RUnlock()
+	if len(hits) != 600 {
+		t.Fatalf("got %d matches, want 600", len(hits))
+	}
+	for _, idx := range hits {
+		if store.Records[idx].Metadata["hot"] != "true" {
+			t.Fatalf("position %d does not match", idx)
+		}
+	}
+
+	res, _ := store.SearchWithOptions(Vector{0, 1}, opts)
+	if len(res) != 5 || res[0].ID != "599" {
+		t.Fatalf("filtered search = %v", resultIDs(res))
+	}
+}